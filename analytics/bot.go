@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultBotUserAgents lists User-Agent substrings of crawlers, link unfurlers
+// and scanners. Matching ignores case, so "bot" also covers Googlebot, Slackbot,
+// Twitterbot, TelegramBot and the like. Generic HTTP libraries such as
+// Go-http-client and python-requests are left out: API clients use them to
+// follow links on behalf of people.
+var DefaultBotUserAgents = []string{
+	"bot",
+	"crawl",
+	"spider",
+	"slurp",
+	"facebookexternalhit",
+	"facebookcatalog",
+	"whatsapp",
+	"skypeuripreview",
+	"embedly",
+	"iframely",
+	"preview",
+	"pinterest",
+	"vkshare",
+	"mastodon",
+	"headlesschrome",
+	"lighthouse",
+	"scanner",
+}
+
+// BotFilter classifies redirect requests as automated or human.
+type BotFilter struct {
+	tokens []string
+}
+
+// NewBotFilter returns a filter treating User-Agents that contain any of tokens,
+// ignoring case, as bots.
+func NewBotFilter(tokens []string) *BotFilter {
+	filter := &BotFilter{}
+	for _, token := range tokens {
+		if token = strings.ToLower(strings.TrimSpace(token)); token != "" {
+			filter.tokens = append(filter.tokens, token)
+		}
+	}
+	return filter
+}
+
+// IsBot reports whether r looks automated: a HEAD request, a browser prefetch or
+// preview, or a User-Agent matching one of the filter's tokens.
+func (f *BotFilter) IsBot(r *http.Request) bool {
+	if r.Method == http.MethodHead || isPrefetch(r.Header) {
+		return true
+	}
+	userAgent := strings.ToLower(r.UserAgent())
+	for _, token := range f.tokens {
+		if strings.Contains(userAgent, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrefetch reports whether header marks a speculative load rather than a
+// navigation: Sec-Purpose and Purpose from Chromium, X-Moz from Firefox and
+// X-Purpose from Safari.
+func isPrefetch(header http.Header) bool {
+	for _, name := range []string{"Sec-Purpose", "Purpose", "X-Moz", "X-Purpose"} {
+		value := strings.ToLower(header.Get(name))
+		if strings.HasPrefix(value, "prefetch") || strings.HasPrefix(value, "prerender") || strings.HasPrefix(value, "preview") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotFilter_IsBot(t *testing.T) {
+	const chrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+	tests := []struct {
+		name      string
+		method    string
+		userAgent string
+		header    map[string]string
+		want      bool
+	}{
+		{name: "Browser navigation", method: http.MethodGet, userAgent: chrome, want: false},
+		{name: "Slack unfurler", method: http.MethodGet, userAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", want: true},
+		{name: "Facebook previewer", method: http.MethodGet, userAgent: "facebookexternalhit/1.1", want: true},
+		{name: "Case is ignored", method: http.MethodGet, userAgent: "Mozilla/5.0 (compatible; GOOGLEBOT/2.1)", want: true},
+		{name: "Custom token", method: http.MethodGet, userAgent: "AcmeLinkChecker/2.0", want: true},
+		{name: "Go HTTP client", method: http.MethodGet, userAgent: "Go-http-client/1.1", want: false},
+		{name: "Python requests", method: http.MethodGet, userAgent: "python-requests/2.31.0", want: false},
+		{name: "Missing User-Agent", method: http.MethodGet, userAgent: "", want: false},
+		// Test case: Heuristics apply even to browser User-Agents
+		{name: "HEAD request", method: http.MethodHead, userAgent: chrome, want: true},
+		{name: "Chromium prefetch", method: http.MethodGet, userAgent: chrome, header: map[string]string{"Sec-Purpose": "prefetch;prerender"}, want: true},
+		{name: "Legacy prefetch", method: http.MethodGet, userAgent: chrome, header: map[string]string{"Purpose": "prefetch"}, want: true},
+		{name: "Firefox prefetch", method: http.MethodGet, userAgent: chrome, header: map[string]string{"X-Moz": "prefetch"}, want: true},
+		{name: "Safari preview", method: http.MethodGet, userAgent: chrome, header: map[string]string{"X-Purpose": "preview"}, want: true},
+	}
+
+	filter := NewBotFilter(append([]string{" linkchecker "}, DefaultBotUserAgents...))
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/abc123", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			assert.Equal(t, tt.want, filter.IsBot(req))
+		})
+	}
+}
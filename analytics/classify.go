@@ -0,0 +1,137 @@
+package analytics
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/Codedude1/shorty/models"
+)
+
+// Breakdown dimensions, in the order Classify returns their values.
+const (
+	DimensionReferrer = "referrer"
+	DimensionBrowser  = "browser"
+	DimensionOS       = "os"
+	DimensionDevice   = "device"
+	DimensionCountry  = "country"
+)
+
+// Dimensions lists every breakdown dimension.
+var Dimensions = []string{DimensionReferrer, DimensionBrowser, DimensionOS, DimensionDevice, DimensionCountry}
+
+// Values reported for clicks that carry no usable information for a dimension.
+const (
+	ValueDirect  = "direct"
+	ValueUnknown = "unknown"
+	ValueOther   = "other"
+)
+
+// Device classes reported for the device dimension.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+)
+
+// Classify returns the value of event for each of Dimensions, in order.
+func Classify(event models.ClickEvent) []string {
+	agent := ParseUserAgent(event.UserAgent)
+	country := event.Country
+	if country == "" {
+		country = ValueUnknown
+	}
+	return []string{ReferrerDomain(event.Referrer), agent.Browser, agent.OS, agent.Device, country}
+}
+
+// ReferrerDomain returns the lower-cased host of a Referer header without a
+// leading "www.", ValueDirect if there is none, or ValueUnknown if it cannot be parsed.
+func ReferrerDomain(referrer string) string {
+	if referrer == "" {
+		return ValueDirect
+	}
+	parsedURL, err := url.Parse(referrer)
+	if err != nil || parsedURL.Hostname() == "" {
+		return ValueUnknown
+	}
+	return strings.TrimPrefix(strings.ToLower(parsedURL.Hostname()), "www.")
+}
+
+// UserAgent is the family of a User-Agent header.
+type UserAgent struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+// userAgentRule maps a User-Agent substring to a family name. Rules are tried
+// in order, so more specific tokens come before the ones they contain; Edge and
+// Opera, for example, also send "Chrome/".
+type userAgentRule struct {
+	token string
+	name  string
+}
+
+var browserRules = []userAgentRule{
+	{"Edg", "Edge"},
+	{"OPR/", "Opera"},
+	{"Opera", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"},
+	{"MSIE ", "Internet Explorer"},
+	{"Trident/", "Internet Explorer"},
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+}
+
+var osRules = []userAgentRule{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Macintosh", "macOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// ParseUserAgent classifies a User-Agent header by browser, operating system
+// and device class. Unrecognized parts are reported as ValueOther, and an empty
+// header as ValueUnknown.
+func ParseUserAgent(userAgent string) UserAgent {
+	if userAgent == "" {
+		return UserAgent{Browser: ValueUnknown, OS: ValueUnknown, Device: ValueUnknown}
+	}
+	agent := UserAgent{
+		Browser: matchRule(browserRules, userAgent),
+		OS:      matchRule(osRules, userAgent),
+	}
+	switch {
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet") ||
+		(agent.OS == "Android" && !strings.Contains(userAgent, "Mobile")):
+		agent.Device = DeviceTablet
+	case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPod"):
+		agent.Device = DeviceMobile
+	case agent.OS == "Windows" || agent.OS == "macOS" || agent.OS == "Linux" || agent.OS == "ChromeOS":
+		agent.Device = DeviceDesktop
+	default:
+		agent.Device = ValueOther
+	}
+	return agent
+}
+
+// matchRule returns the name of the first rule whose token occurs in userAgent.
+func matchRule(rules []userAgentRule, userAgent string) string {
+	for _, rule := range rules {
+		if strings.Contains(userAgent, rule.token) {
+			return rule.name
+		}
+	}
+	return ValueOther
+}
@@ -0,0 +1,106 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferrerDomain(t *testing.T) {
+	tests := []struct {
+		referrer string
+		want     string
+	}{
+		{"", ValueDirect}, // Test case: No Referer header
+		{"https://www.Google.com/search?q=x", "google.com"}, // Test case: www. and case are dropped
+		{"https://news.ycombinator.com/item?id=1", "news.ycombinator.com"},
+		{"android-app://com.slack", "com.slack"},
+		{"not a url", ValueUnknown}, // Test case: No host
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.referrer, func(t *testing.T) {
+			assert.Equal(t, tt.want, ReferrerDomain(tt.referrer))
+		})
+	}
+}
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      UserAgent
+	}{
+		{
+			name:      "Chrome on Windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want:      UserAgent{Browser: "Chrome", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name:      "Edge on Windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			want:      UserAgent{Browser: "Edge", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name:      "Safari on iPhone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			want:      UserAgent{Browser: "Safari", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			name:      "Safari on iPad",
+			userAgent: "Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			want:      UserAgent{Browser: "Safari", OS: "iOS", Device: DeviceTablet},
+		},
+		{
+			name:      "Chrome on Android phone",
+			userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			want:      UserAgent{Browser: "Chrome", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name:      "Samsung Internet on Android tablet",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36",
+			want:      UserAgent{Browser: "Samsung Internet", OS: "Android", Device: DeviceTablet},
+		},
+		{
+			name:      "Firefox on Linux",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want:      UserAgent{Browser: "Firefox", OS: "Linux", Device: DeviceDesktop},
+		},
+		{
+			name:      "Safari on macOS",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+			want:      UserAgent{Browser: "Safari", OS: "macOS", Device: DeviceDesktop},
+		},
+		{
+			name:      "curl",
+			userAgent: "curl/8.4.0",
+			want:      UserAgent{Browser: "curl", OS: ValueOther, Device: ValueOther},
+		},
+		{
+			name:      "Empty",
+			userAgent: "",
+			want:      UserAgent{Browser: ValueUnknown, OS: ValueUnknown, Device: ValueUnknown},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseUserAgent(tt.userAgent))
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	values := Classify(models.ClickEvent{
+		Referrer:  "https://t.co/abc",
+		UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		Country:   "DE",
+	})
+	assert.Equal(t, []string{"t.co", "Firefox", "Linux", DeviceDesktop, "DE"}, values)
+
+	// Test case: Missing country is reported as unknown
+	assert.Equal(t, ValueUnknown, Classify(models.ClickEvent{})[len(Dimensions)-1])
+}
@@ -0,0 +1,47 @@
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Codedude1/shorty/models"
+)
+
+// FileSink appends click events to a file as JSON lines, one event per line.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens (or creates) the access log at path for appending.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open access log: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+// WriteClicks appends events to the access log through a buffered writer.
+func (s *FileSink) WriteClicks(events []models.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writer := bufio.NewWriter(s.file)
+	encoder := json.NewEncoder(writer)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("encode click event: %w", err)
+		}
+	}
+	return writer.Flush()
+}
+
+// Close closes the access log.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// geoRange maps an inclusive range of addresses to a country code.
+type geoRange struct {
+	start   netip.Addr
+	end     netip.Addr
+	country string
+}
+
+// GeoIP resolves IP addresses to ISO 3166 country codes from a database held
+// in memory, so lookups never touch the network.
+type GeoIP struct {
+	ranges []geoRange
+}
+
+// LoadGeoIP reads a country database in the CSV layout of the free DB-IP
+// "IP to Country Lite" download: one "start_ip,end_ip,country_code" line per
+// range, for IPv4 and IPv6 alike. Lines starting with # are ignored.
+func LoadGeoIP(path string) (*GeoIP, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open GeoIP database: %w", err)
+	}
+	defer file.Close()
+	return ReadGeoIP(file)
+}
+
+// ReadGeoIP parses a country database in the format accepted by LoadGeoIP.
+func ReadGeoIP(r io.Reader) (*GeoIP, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	db := &GeoIP{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read GeoIP database: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 3 {
+			return nil, fmt.Errorf("GeoIP database line %d: expected start_ip,end_ip,country_code", line)
+		}
+		start, startErr := netip.ParseAddr(strings.TrimSpace(record[0]))
+		end, endErr := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err := errors.Join(startErr, endErr); err != nil {
+			return nil, fmt.Errorf("GeoIP database line %d: %w", line, err)
+		}
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("GeoIP database line %d: invalid range %s-%s", line, start, end)
+		}
+		db.ranges = append(db.ranges, geoRange{start: start, end: end, country: strings.ToUpper(strings.TrimSpace(record[2]))})
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+	return db, nil
+}
+
+// Country returns the country code of ip, or "" if ip is invalid or not covered.
+func (db *GeoIP) Country(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	// IPv4-mapped IPv6 addresses are looked up in the IPv4 ranges.
+	addr = addr.Unmap()
+	// Find the last range starting at or before addr.
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].start)
+	}) - 1
+	if i < 0 || db.ranges[i].end.Less(addr) {
+		return ""
+	}
+	return db.ranges[i].country
+}
+
+// Len returns the number of ranges in the database.
+func (db *GeoIP) Len() int {
+	return len(db.ranges)
+}
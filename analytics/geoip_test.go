@@ -0,0 +1,57 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGeoIPDatabase = `# start_ip,end_ip,country_code
+1.0.0.0,1.0.0.255,au
+203.0.113.0,203.0.113.255,DE
+198.51.100.0,198.51.100.127,FR
+2001:db8::,2001:db8::ffff,NL
+`
+
+func TestGeoIP_Country(t *testing.T) {
+	db, err := ReadGeoIP(strings.NewReader(testGeoIPDatabase))
+	require.NoError(t, err)
+	assert.Equal(t, 4, db.Len())
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.7", "DE"},        // Test case: Inside a range
+		{"1.0.0.0", "AU"},            // Test case: Range start, upper-cased
+		{"198.51.100.127", "FR"},     // Test case: Range end
+		{"198.51.100.128", ""},       // Test case: Just past a range
+		{"9.9.9.9", ""},              // Test case: Not covered
+		{"0.0.0.1", ""},              // Test case: Before the first range
+		{"2001:db8::1", "NL"},        // Test case: IPv6
+		{"::ffff:203.0.113.9", "DE"}, // Test case: IPv4-mapped IPv6
+		{"2001:db9::1", ""},          // Test case: IPv6 not covered
+		{"not-an-ip", ""},            // Test case: Invalid address
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.want, db.Country(tt.ip))
+		})
+	}
+}
+
+func TestReadGeoIP_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"1.0.0.0,1.0.0.255\n",         // Missing country
+		"1.0.0.x,1.0.0.255,AU\n",      // Bad address
+		"1.0.0.255,1.0.0.0,AU\n",      // Reversed range
+		"1.0.0.0,2001:db8::ffff,AU\n", // Mixed families
+	} {
+		_, err := ReadGeoIP(strings.NewReader(data))
+		assert.Error(t, err, data)
+	}
+}
@@ -0,0 +1,139 @@
+package analytics
+
+import (
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+)
+
+const (
+	// DefaultBufferSize is the number of click events queued before new ones are dropped.
+	DefaultBufferSize = 10000
+
+	// batchSize caps how many events are handed to the sinks in one write.
+	batchSize = 256
+
+	// flushInterval bounds how long a partial batch waits before it is written.
+	flushInterval = time.Second
+)
+
+// droppedClicks counts click events discarded because the buffer was full. It is
+// published through expvar and served at /debug/vars.
+var droppedClicks = expvar.NewInt("click_events_dropped_total")
+
+// DroppedClicks returns the number of click events dropped since startup.
+func DroppedClicks() int64 {
+	return droppedClicks.Value()
+}
+
+// Sink persists batches of click events.
+type Sink interface {
+	WriteClicks(events []models.ClickEvent) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(events []models.ClickEvent) error
+
+// WriteClicks calls f(events).
+func (f SinkFunc) WriteClicks(events []models.ClickEvent) error {
+	return f(events)
+}
+
+// Recorder hands click events to its sinks on a background goroutine, so
+// recording never blocks the request path. Events are queued in a bounded
+// buffer; when the sinks fall behind and the buffer is full, new events are
+// dropped and counted instead of slowing down redirects.
+type Recorder struct {
+	events chan models.ClickEvent
+	sinks  []Sink
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewRecorder starts a Recorder that buffers up to bufferSize events for sinks.
+func NewRecorder(bufferSize int, sinks ...Sink) *Recorder {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	r := &Recorder{
+		events: make(chan models.ClickEvent, bufferSize),
+		sinks:  sinks,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record queues event without blocking and reports whether it was accepted.
+func (r *Recorder) Record(event models.ClickEvent) bool {
+	select {
+	case r.events <- event:
+		return true
+	default:
+		droppedClicks.Add(1)
+		return false
+	}
+}
+
+// Close writes every queued event and stops the background goroutine. Events
+// recorded after Close are discarded.
+func (r *Recorder) Close() error {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	<-r.done
+	return nil
+}
+
+// run batches queued events until the recorder is closed.
+func (r *Recorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ClickEvent, 0, batchSize)
+	for {
+		select {
+		case event := <-r.events:
+			batch = append(batch, event)
+			if len(batch) == batchSize {
+				batch = r.flush(batch)
+			}
+		case <-ticker.C:
+			batch = r.flush(batch)
+		case <-r.stop:
+			// Drain what is already queued before exiting
+			for {
+				select {
+				case event := <-r.events:
+					batch = append(batch, event)
+					if len(batch) == batchSize {
+						batch = r.flush(batch)
+					}
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes batch to every sink and returns it emptied for reuse. A failing
+// sink loses the batch but does not stop the others.
+func (r *Recorder) flush(batch []models.ClickEvent) []models.ClickEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+	for _, sink := range r.sinks {
+		if err := sink.WriteClicks(batch); err != nil {
+			log.Printf("[ERROR] Failed to write %d click events: %v", len(batch), err)
+		}
+	}
+	return batch[:0]
+}
@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink collects written events, optionally blocking until released.
+type memorySink struct {
+	mu      sync.Mutex
+	events  []models.ClickEvent
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *memorySink) WriteClicks(events []models.ClickEvent) error {
+	if s.release != nil {
+		select {
+		case s.entered <- struct{}{}:
+		default:
+		}
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memorySink) written() []models.ClickEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.ClickEvent(nil), s.events...)
+}
+
+func TestRecorder_WritesToEverySink(t *testing.T) {
+	first, second := &memorySink{}, &memorySink{}
+	recorder := NewRecorder(100, first, second)
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, recorder.Record(models.ClickEvent{ShortCode: "abc123", AccessedAt: time.Now()}))
+	}
+
+	// Close flushes everything that was queued
+	assert.NoError(t, recorder.Close())
+	assert.Equal(t, 10, len(first.written()))
+	assert.Equal(t, 10, len(second.written()))
+
+	// Closing twice is safe
+	assert.NoError(t, recorder.Close())
+}
+
+func TestRecorder_DropsWhenFull(t *testing.T) {
+	sink := &memorySink{entered: make(chan struct{}, 1), release: make(chan struct{})}
+	recorder := NewRecorder(batchSize, sink)
+
+	// A full batch is flushed right away and then blocks in the sink
+	for i := 0; i < batchSize; i++ {
+		require.True(t, recorder.Record(models.ClickEvent{ShortCode: "blocked"}))
+	}
+	<-sink.entered
+	for len(recorder.events) < cap(recorder.events) {
+		require.True(t, recorder.Record(models.ClickEvent{ShortCode: "blocked"}))
+	}
+
+	before := DroppedClicks()
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		if recorder.Record(models.ClickEvent{ShortCode: "abc123"}) {
+			accepted++
+		}
+		assert.Less(t, time.Since(start), 100*time.Millisecond, "Recording must not block")
+	}
+	assert.Zero(t, accepted, "No events fit once the buffer is full")
+	assert.Equal(t, int64(20), DroppedClicks()-before, "Dropped events should be counted")
+
+	close(sink.release)
+	assert.NoError(t, recorder.Close())
+	assert.Equal(t, 2*batchSize, len(sink.written()), "Accepted events should still be written")
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+
+	events := []models.ClickEvent{
+		{ShortCode: "abc123", AccessedAt: time.Now().UTC(), Referrer: "https://news.example.com/", IPAddress: "203.0.113.7"},
+		{ShortCode: "abc123", AccessedAt: time.Now().UTC(), UserAgent: "curl/8.0", AcceptLanguage: "en-GB"},
+	}
+	assert.NoError(t, sink.WriteClicks(events))
+	assert.NoError(t, sink.Close())
+
+	// Each event is a JSON line
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var decoded []models.ClickEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event models.ClickEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		decoded = append(decoded, event)
+	}
+	require.Len(t, decoded, 2)
+	assert.Equal(t, "https://news.example.com/", decoded[0].Referrer)
+	assert.Equal(t, "en-GB", decoded[1].AcceptLanguage)
+}
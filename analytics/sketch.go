@@ -0,0 +1,196 @@
+package analytics
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	// sketchPrecision is the number of hash bits that select a register. 2^12
+	// registers give a standard error of about 1.6%.
+	sketchPrecision = 12
+	sketchRegisters = 1 << sketchPrecision
+
+	// sketchSparseLimit is the number of registers a sketch tracks individually
+	// before switching to a full register array. Most links and buckets see few
+	// visitors, so they stay far smaller than the 4 KiB dense form.
+	sketchSparseLimit = sketchRegisters / 8
+
+	sketchVersion     = 1
+	sketchModeSparse  = 0
+	sketchModeDense   = 1
+	sketchHeaderSize  = 3
+	sketchSparseEntry = 3
+)
+
+// ErrInvalidSketch is returned when decoding bytes that were not produced by Sketch.MarshalBinary.
+var ErrInvalidSketch = errors.New("invalid visitor sketch")
+
+// Sketch is a HyperLogLog cardinality estimator for visitor IDs. Sketches are
+// mergeable: the union of the visitors seen by several sketches, for example
+// on different instances or in adjacent time buckets, is estimated by merging
+// them. The zero value is an empty sketch.
+type Sketch struct {
+	sparse map[uint16]uint8
+	dense  []uint8
+}
+
+// NewSketch returns an empty sketch.
+func NewSketch() *Sketch {
+	return &Sketch{}
+}
+
+// Add records a visitor ID.
+func (s *Sketch) Add(visitorID string) {
+	hash := hashVisitor(visitorID)
+	index := uint16(hash >> (64 - sketchPrecision))
+	// The rank is the position of the first set bit in the remaining hash bits.
+	rank := uint8(bits.LeadingZeros64(hash<<sketchPrecision|1<<(sketchPrecision-1)) + 1)
+	s.set(index, rank)
+}
+
+// Merge folds other into s, so s estimates the union of both.
+func (s *Sketch) Merge(other *Sketch) {
+	if other.dense != nil {
+		for index, rank := range other.dense {
+			if rank > 0 {
+				s.set(uint16(index), rank)
+			}
+		}
+		return
+	}
+	for index, rank := range other.sparse {
+		s.set(index, rank)
+	}
+}
+
+// Empty reports whether no visitor has been added.
+func (s *Sketch) Empty() bool {
+	return s.dense == nil && len(s.sparse) == 0
+}
+
+// Estimate returns the approximate number of distinct visitors added.
+func (s *Sketch) Estimate() int64 {
+	if s.Empty() {
+		return 0
+	}
+	var (
+		sum   float64
+		zeros int
+	)
+	if s.dense != nil {
+		for _, rank := range s.dense {
+			sum += math.Ldexp(1, -int(rank))
+			if rank == 0 {
+				zeros++
+			}
+		}
+	} else {
+		zeros = sketchRegisters - len(s.sparse)
+		sum = float64(zeros)
+		for _, rank := range s.sparse {
+			sum += math.Ldexp(1, -int(rank))
+		}
+	}
+
+	m := float64(sketchRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Linear counting is more accurate while many registers are still empty.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// MarshalBinary encodes the sketch in its sparse or dense form, whichever it is in.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	if s.dense != nil {
+		data := make([]byte, sketchHeaderSize, sketchHeaderSize+sketchRegisters)
+		data[0], data[1], data[2] = sketchVersion, sketchPrecision, sketchModeDense
+		return append(data, s.dense...), nil
+	}
+	data := make([]byte, sketchHeaderSize, sketchHeaderSize+sketchSparseEntry*len(s.sparse))
+	data[0], data[1], data[2] = sketchVersion, sketchPrecision, sketchModeSparse
+	for index, rank := range s.sparse {
+		data = binary.BigEndian.AppendUint16(data, index)
+		data = append(data, rank)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary replaces the sketch with one encoded by MarshalBinary.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < sketchHeaderSize || data[0] != sketchVersion || data[1] != sketchPrecision {
+		return ErrInvalidSketch
+	}
+	*s = Sketch{}
+	body := data[sketchHeaderSize:]
+	switch data[2] {
+	case sketchModeDense:
+		if len(body) != sketchRegisters {
+			return ErrInvalidSketch
+		}
+		s.dense = append([]uint8(nil), body...)
+	case sketchModeSparse:
+		if len(body)%sketchSparseEntry != 0 {
+			return ErrInvalidSketch
+		}
+		for i := 0; i < len(body); i += sketchSparseEntry {
+			index := binary.BigEndian.Uint16(body[i:])
+			if index >= sketchRegisters {
+				return ErrInvalidSketch
+			}
+			s.set(index, body[i+2])
+		}
+	default:
+		return ErrInvalidSketch
+	}
+	return nil
+}
+
+// set raises register index to rank, switching to the dense form once the
+// sparse one holds sketchSparseLimit registers.
+func (s *Sketch) set(index uint16, rank uint8) {
+	if s.dense != nil {
+		if rank > s.dense[index] {
+			s.dense[index] = rank
+		}
+		return
+	}
+	if s.sparse == nil {
+		s.sparse = make(map[uint16]uint8)
+	}
+	if rank > s.sparse[index] {
+		s.sparse[index] = rank
+	}
+	if len(s.sparse) > sketchSparseLimit {
+		s.dense = make([]uint8, sketchRegisters)
+		for i, r := range s.sparse {
+			s.dense[i] = r
+		}
+		s.sparse = nil
+	}
+}
+
+// hashVisitor spreads a visitor ID over 64 bits using FNV-1a followed by the
+// splitmix64 finalizer, which fixes FNV's weak high bits.
+func hashVisitor(visitorID string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	hash := uint64(offset64)
+	for i := 0; i < len(visitorID); i++ {
+		hash ^= uint64(visitorID[i])
+		hash *= prime64
+	}
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+	return hash
+}
@@ -0,0 +1,98 @@
+package analytics
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sketchOf returns a sketch of the visitors "v<from>" to "v<to-1>".
+func sketchOf(from int, to int) *Sketch {
+	sketch := NewSketch()
+	for i := from; i < to; i++ {
+		sketch.Add("v" + strconv.Itoa(i))
+	}
+	return sketch
+}
+
+func TestSketch_Estimate(t *testing.T) {
+	tests := []struct {
+		name      string
+		visitors  int
+		tolerance float64
+	}{
+		{
+			// Test case: Empty sketch
+			name:     "Empty",
+			visitors: 0,
+		},
+		{
+			// Test case: Few visitors are counted exactly by linear counting
+			name:     "Sparse",
+			visitors: 20,
+		},
+		{
+			// Test case: Large cardinalities stay within a few standard errors
+			name:      "Dense",
+			visitors:  100000,
+			tolerance: 0.05,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sketch := sketchOf(0, tt.visitors)
+			// Repeat visits must not change the estimate
+			sketch.Merge(sketchOf(0, tt.visitors/2))
+			assert.InDelta(t, tt.visitors, sketch.Estimate(), tt.tolerance*float64(tt.visitors))
+		})
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	// Two overlapping halves, as seen by two instances
+	a, b := sketchOf(0, 6000), sketchOf(4000, 10000)
+	a.Merge(b)
+	assert.InDelta(t, 10000, a.Estimate(), 500)
+
+	// Merging a sparse sketch into a dense one and vice versa
+	sparse := sketchOf(10000, 10010)
+	sparse.Merge(a)
+	assert.InDelta(t, 10010, sparse.Estimate(), 500)
+}
+
+func TestSketch_MarshalBinary(t *testing.T) {
+	for _, original := range []*Sketch{sketchOf(0, 50), sketchOf(0, 5000)} {
+		data, err := original.MarshalBinary()
+		require.NoError(t, err)
+
+		var decoded Sketch
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		assert.Equal(t, original.Estimate(), decoded.Estimate())
+	}
+
+	// Test case: Sparse sketches stay small
+	data, _ := sketchOf(0, 50).MarshalBinary()
+	assert.Less(t, len(data), 200)
+
+	// Test case: Foreign or truncated data is rejected
+	var decoded Sketch
+	assert.ErrorIs(t, decoded.UnmarshalBinary([]byte("HYLL")), ErrInvalidSketch)
+	data, _ = sketchOf(0, 5000).MarshalBinary()
+	assert.ErrorIs(t, decoded.UnmarshalBinary(data[:100]), ErrInvalidSketch)
+}
+
+func TestVisitorID(t *testing.T) {
+	key := []byte("secret")
+	id := VisitorID(key, "203.0.113.7", "Mozilla/5.0")
+
+	assert.Len(t, id, 2*visitorIDSize)
+	assert.Equal(t, id, VisitorID(key, "203.0.113.7", "Mozilla/5.0"), "IDs should be stable")
+	assert.NotContains(t, id, "203.0.113.7")
+	assert.NotEqual(t, id, VisitorID(key, "203.0.113.8", "Mozilla/5.0"))
+	assert.NotEqual(t, id, VisitorID(key, "203.0.113.7", "curl/8.0"))
+	assert.NotEqual(t, id, VisitorID([]byte("other"), "203.0.113.7", "Mozilla/5.0"))
+}
@@ -0,0 +1,23 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// visitorIDSize is the number of HMAC bytes kept in a visitor ID. 64 bits are
+// plenty for cardinality estimation and too few to be useful as a lookup key.
+const visitorIDSize = 8
+
+// VisitorID returns a pseudonymous fingerprint of a client for unique visitor
+// counts. It is a keyed hash of the IP address and User-Agent, so the raw values
+// are never stored and the ID cannot be recomputed without key. Instances must
+// share the key for their counts to combine.
+func VisitorID(key []byte, ipAddress string, userAgent string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(ipAddress))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	return hex.EncodeToString(mac.Sum(nil)[:visitorIDSize])
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+	"github.com/Codedude1/shorty/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultInterstitialDelay is how long the interstitial counts down before
+// continuing to the destination.
+const DefaultInterstitialDelay = 5 * time.Second
+
+// continueParam is the query parameter of the interstitial's continue link. It
+// carries a token showing the visitor was warned, and is never passed on to the
+// destination.
+const continueParam = "confirm"
+
+// continueTTL is how long a continue link stays valid once its countdown ends.
+const continueTTL = 10 * time.Minute
+
+// interstitialTemplate is the file LoadInterstitialTemplate looks up in its directory.
+const interstitialTemplate = "interstitial.html"
+
+// defaultInterstitialPage warns visitors before sending them on. With a delay
+// it continues by itself once the countdown ends.
+var defaultInterstitialPage = template.Must(template.New(interstitialTemplate).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+{{if .Delay}}<meta http-equiv="refresh" content="{{.Delay}}; url={{.ContinueURL}}">
+{{end}}<title>You are leaving {{.Origin}}</title>
+</head>
+<body>
+<main>
+<h1>You are leaving {{.Origin}}</h1>
+<p role="alert">{{.Reason}}</p>
+{{if .Destination}}<p>This link leads to <strong>{{.Host}}</strong>:</p>
+<p><code>{{.Destination}}</code></p>
+{{else}}<p>Where this link leads is hidden until you continue.</p>
+{{end}}{{if .Delay}}<p>Continuing in <span id="countdown">{{.Delay}}</span> seconds.</p>
+{{end}}<p><a href="{{.ContinueURL}}" rel="noreferrer" role="button">Continue</a></p>
+</main>
+{{if .Delay}}<script>
+let remaining = {{.Delay}};
+const countdown = document.getElementById("countdown");
+setInterval(() => { if (remaining > 0) countdown.textContent = --remaining; }, 1000);
+</script>
+{{end}}</body>
+</html>
+`))
+
+// interstitial is the data available to the interstitial template.
+type interstitial struct {
+	Origin      string // Host of the short link
+	ShortURL    string
+	Destination string // Empty for click-limited links, whose destination is hidden
+	Host        string // Host of the destination
+	ContinueURL string // Follows the link past the page; the visit is counted then
+	Reason      string // Why the visitor is warned, from the WarningPolicy
+	Delay       int    // Seconds before continuing by itself; 0 waits for the visitor
+}
+
+// LoadInterstitialTemplate parses the .html files in dir and returns the one
+// named interstitial.html, so deployments can restyle the page. The other
+// files may hold templates it includes. The template is tried out on sample
+// data, so mistakes surface at startup rather than on a redirect.
+func LoadInterstitialTemplate(dir string) (*template.Template, error) {
+	templates, err := template.ParseGlob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	page := templates.Lookup(interstitialTemplate)
+	if page == nil {
+		return nil, errors.New(interstitialTemplate + " not found in " + dir)
+	}
+	sample := interstitial{
+		Origin:      "sho.rt",
+		ShortURL:    "https://sho.rt/abc123",
+		Destination: "https://www.example.com/",
+		Host:        "www.example.com",
+		ContinueURL: "/abc123?" + continueParam + "=0.sample",
+		Reason:      "This link leads to an external site.",
+		Delay:       5,
+	}
+	if err := page.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("%s: %w", interstitialTemplate, err)
+	}
+	return page, nil
+}
+
+// renderInterstitial writes the interstitial page warning, for reason, about a
+// redirect of urlModel to destination. Its continue link repeats the request,
+// with rawQuery as the query string, for this client only.
+func renderInterstitial(c *gin.Context, cfg *config, urlModel *models.URL, destination *url.URL, rawQuery string, reason string) {
+	expires := time.Now().Add(cfg.interstitialDelay + continueTTL)
+	query := continueParam + "=" + continueToken(cfg.continueKey, urlModel.ShortCode, c.ClientIP(), expires)
+	// A stale continue link is replaced rather than repeated
+	if rawQuery = services.RemoveQueryParam(rawQuery, continueParam); rawQuery != "" {
+		query = rawQuery + "&" + query
+	}
+	data := interstitial{
+		Origin:      c.Request.Host,
+		ShortURL:    constructShortURL(c, urlModel.ShortCode),
+		ContinueURL: c.Request.URL.EscapedPath() + "?" + query,
+		Reason:      reason,
+		Delay:       int(math.Ceil(cfg.interstitialDelay.Seconds())),
+	}
+	// Reading the destination of click-limited links takes a click
+	if urlModel.MaxClicks == 0 {
+		data.Destination = destination.String()
+		data.Host = destination.Hostname()
+	}
+
+	var page bytes.Buffer
+	if err := cfg.interstitialPage.Execute(&page, data); err != nil {
+		log.Printf("[ERROR] Failed to render interstitial page: %v", err)
+		utils.RespondWithError(c, http.StatusInternalServerError, "Failed to render interstitial page")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// continueToken returns the token of a continue link for shortCode, valid for
+// clientIP until expires.
+func continueToken(key []byte, shortCode string, clientIP string, expires time.Time) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%d", shortCode, clientIP, expires.Unix())
+	return strconv.FormatInt(expires.Unix(), 10) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// continued reports whether the request follows a continue link the
+// interstitial gave this client for shortCode, and the link has not expired.
+func continued(c *gin.Context, cfg *config, shortCode string) bool {
+	token, exists := c.GetQuery(continueParam)
+	if !exists {
+		return false
+	}
+	unix, _, _ := strings.Cut(token, ".")
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || time.Now().Unix() > seconds {
+		return false
+	}
+	expected := continueToken(cfg.continueKey, shortCode, c.ClientIP(), time.Unix(seconds, 0))
+	return hmac.Equal([]byte(token), []byte(expected))
+}
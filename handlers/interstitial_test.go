@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+	"github.com/Codedude1/shorty/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectHandler_Interstitial(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	for _, urlModel := range []*models.URL{
+		{BaseURL: models.BaseURL{LongURL: "https://docs.example.com/guide"}, ShortCode: "inside1", Alias: true},
+		{BaseURL: models.BaseURL{LongURL: "https://www.other.net/page?a=1&b=2"}, ShortCode: "outside1", Alias: true},
+		{BaseURL: models.BaseURL{LongURL: "https://docs.example.com/login"}, ShortCode: "flagged1", Alias: true, Flagged: true},
+	} {
+		_, _, err := store.CreateURL(urlModel)
+		require.NoError(t, err)
+	}
+	policy := services.NewAllowlistPolicy([]string{"example.com"})
+
+	tests := []struct {
+		name             string
+		shortCode        string
+		opts             []Option
+		expectedStatus   int
+		expectedLocation string
+		contains         []string
+		notContains      []string
+	}{
+		{
+			name:             "Allowed Host",
+			shortCode:        "inside1",
+			opts:             []Option{WithInterstitial(policy, 5*time.Second)},
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://docs.example.com/guide",
+		},
+		{
+			name:           "External Host",
+			shortCode:      "outside1",
+			opts:           []Option{WithInterstitial(policy, 5*time.Second)},
+			expectedStatus: http.StatusOK,
+			contains: []string{
+				"<h1>You are leaving example.com</h1>",
+				services.WarningExternal,
+				"<strong>www.other.net</strong>",
+				"<code>https://www.other.net/page?a=1&amp;b=2</code>",
+				`<meta http-equiv="refresh" content="5; url=/outside1?confirm=`,
+				`<a href="/outside1?confirm=`,
+			},
+		},
+		{
+			name:           "Flagged Link",
+			shortCode:      "flagged1",
+			opts:           []Option{WithInterstitial(policy, 5*time.Second)},
+			expectedStatus: http.StatusOK,
+			contains:       []string{services.WarningFlagged},
+		},
+		{
+			name:           "Flagged By Default",
+			shortCode:      "flagged1",
+			expectedStatus: http.StatusOK,
+			contains:       []string{services.WarningFlagged},
+		},
+		{
+			name:           "No Countdown",
+			shortCode:      "outside1",
+			opts:           []Option{WithInterstitial(policy, 0)},
+			expectedStatus: http.StatusOK,
+			notContains:    []string{`http-equiv="refresh"`, "<script>"},
+		},
+		{
+			name:             "No Policy",
+			shortCode:        "flagged1",
+			opts:             []Option{WithInterstitial(nil, 0)},
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://docs.example.com/login",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.Default()
+			router.GET("/:shortCode", RedirectHandler(store, tt.opts...))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tt.shortCode, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			if tt.expectedStatus == http.StatusOK {
+				assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+				assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			}
+			for _, text := range tt.contains {
+				assert.Contains(t, w.Body.String(), text)
+			}
+			for _, text := range tt.notContains {
+				assert.NotContains(t, w.Body.String(), text)
+			}
+		})
+	}
+
+	// Test case: Showing the interstitial is not a visit
+	urlModel, _ := store.GetURL("outside1")
+	assert.Equal(t, 0, urlModel.AccessCount)
+}
+
+// continueLink returns the target of the Continue button on an interstitial page.
+func continueLink(t *testing.T, page string) string {
+	match := regexp.MustCompile(`<a href="([^"]+)" rel="noreferrer" role="button">Continue</a>`).FindStringSubmatch(page)
+	require.Len(t, match, 2, "Page should have a Continue button")
+	return html.UnescapeString(match[1])
+}
+
+func TestRedirectHandler_InterstitialContinue(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	for _, urlModel := range []*models.URL{
+		{BaseURL: models.BaseURL{LongURL: "https://www.other.net/page"}, ShortCode: "outside1", Alias: true, QueryMode: services.QueryModeMerge},
+		{BaseURL: models.BaseURL{LongURL: "https://www.other.net/secret"}, ShortCode: "once1", Alias: true, MaxClicks: 1},
+	} {
+		_, _, err := store.CreateURL(urlModel)
+		require.NoError(t, err)
+	}
+	newProtectedLink(t, store, "locked1", "https://www.other.net/locked", "open sesame")
+
+	handler := RedirectHandler(store, WithInterstitial(services.NewAllowlistPolicy([]string{"example.com"}), 0), WithPasswordLockout(nil))
+	router := gin.Default()
+	router.GET("/:shortCode", handler)
+	router.POST("/:shortCode", handler)
+	get := func(target string, clientIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = clientIP + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Test case: The visit is counted when the visitor continues, not when warned
+	w := get("/outside1?q=%7E&ref=a+b", "203.0.113.7")
+	require.Equal(t, http.StatusOK, w.Code)
+	link := continueLink(t, w.Body.String())
+	assert.True(t, strings.HasPrefix(link, "/outside1?q=%7E&ref=a+b&confirm="), link)
+	urlModel, _ := store.GetURL("outside1")
+	assert.Equal(t, 0, urlModel.AccessCount)
+
+	w = get(link, "203.0.113.7")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://www.other.net/page?q=%7E&ref=a+b", w.Header().Get("Location"), "The continue token is not passed on")
+	urlModel, _ = store.GetURL("outside1")
+	assert.Equal(t, 1, urlModel.AccessCount)
+
+	// Test case: Continue links only work for the client they were given to
+	w = get(link, "198.51.100.2")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case: Forged and expired tokens get the warning again
+	forged := strings.Replace(link, "confirm=", "confirm=1", 1)
+	cfg := newConfig(nil)
+	expired := "/outside1?confirm=" + continueToken(cfg.continueKey, "outside1", "203.0.113.7", time.Now().Add(-time.Second))
+	for _, target := range []string{forged, expired, "/outside1?confirm="} {
+		w = get(target, "203.0.113.7")
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.Equal(t, 1, strings.Count(continueLink(t, w.Body.String()), "confirm="), "Stale tokens should be replaced")
+	}
+	urlModel, _ = store.GetURL("outside1")
+	assert.Equal(t, 1, urlModel.AccessCount)
+
+	// Test case: One-time links hide the destination until the click is used up
+	w = get("/once1", "203.0.113.7")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+	link = continueLink(t, w.Body.String())
+	urlModel, _ = store.GetURL("once1")
+	assert.Equal(t, 0, urlModel.AccessCount)
+	w = get(link, "203.0.113.7")
+	assert.Equal(t, "https://www.other.net/secret", w.Header().Get("Location"))
+	w = get("/once1", "203.0.113.7")
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	// Test case: Visitors who entered the password continue without it
+	req := httptest.NewRequest(http.MethodPost, "/locked1", strings.NewReader(url.Values{"password": {"open sesame"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "203.0.113.7:1234"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	link = continueLink(t, w.Body.String())
+	assert.NotContains(t, link, "sesame")
+	w = get(link, "203.0.113.7")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://www.other.net/locked", w.Header().Get("Location"))
+	w = get("/locked1", "203.0.113.7")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLoadInterstitialTemplate(t *testing.T) {
+	// Test case: Custom templates may include others from the directory
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "interstitial.html"),
+		[]byte(`{{template "brand.html"}} leaving for {{.Host}}: {{.Reason}}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "brand.html"), []byte(`<b>Acme</b>`), 0o644))
+	page, err := LoadInterstitialTemplate(dir)
+	require.NoError(t, err)
+
+	store := storage.NewStorage()
+	_, _, err = store.CreateURL(&models.URL{BaseURL: models.BaseURL{LongURL: "https://www.other.net/"}, ShortCode: "flagged1", Alias: true, Flagged: true})
+	require.NoError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/:shortCode", RedirectHandler(store, WithInterstitialTemplate(page)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/flagged1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<b>Acme</b> leaving for www.other.net: "+services.WarningFlagged, w.Body.String())
+
+	// Test case: The directory must hold interstitial.html
+	_, err = LoadInterstitialTemplate(t.TempDir())
+	assert.Error(t, err)
+
+	// Test case: Templates using unknown fields are rejected at load time
+	dir = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "interstitial.html"), []byte(`{{.Missing}}`), 0o644))
+	_, err = LoadInterstitialTemplate(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+	"github.com/Codedude1/shorty/storage"
+	"github.com/Codedude1/shorty/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxListLimit caps the page size clients may request from ListLinksHandler.
+const maxListLimit = 100
+
+// errLinkExpired aborts an update of a link that expired before the sweep removed it.
+var errLinkExpired = errors.New("short URL has expired")
+
+// errInvalidWindow aborts an update that would leave a link expiring before it activates.
+var errInvalidWindow = errors.New("activation time must be before the expiry")
+
+// ListLinksHandler returns a page of links. Query parameters select the order
+// (sort, order), the filters (host, status, created_after, created_before) and
+// the page (limit, cursor).
+func ListLinksHandler(store storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := storage.ListQuery{
+			SortBy:     c.DefaultQuery("sort", storage.SortCreatedAt),
+			Descending: true,
+			Host:       c.Query("host"),
+			Status:     c.Query("status"),
+			Limit:      storage.DefaultListLimit,
+			Cursor:     c.Query("cursor"),
+		}
+
+		switch order := c.Query("order"); order {
+		case "", "desc":
+		case "asc":
+			query.Descending = false
+		default:
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid order")
+			return
+		}
+		if limit := c.Query("limit"); limit != "" {
+			parsed, err := strconv.Atoi(limit)
+			if err != nil || parsed < 1 || parsed > maxListLimit {
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+			query.Limit = parsed
+		}
+		var err error
+		if query.CreatedFrom, err = parseTimeQuery(c, "created_after"); err != nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid created_after")
+			return
+		}
+		if query.CreatedTo, err = parseTimeQuery(c, "created_before"); err != nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid created_before")
+			return
+		}
+
+		page, err := store.QueryURLs(query)
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		if errors.Is(err, storage.ErrInvalidQuery) {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid sort or status")
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] Failed to list links: %v", err)
+			utils.RespondWithError(c, http.StatusInternalServerError, "Error listing short URLs")
+			return
+		}
+
+		response := models.ListLinksResponse{
+			Links:      make([]models.LinkResponse, 0, len(page.URLs)),
+			NextCursor: page.NextCursor,
+		}
+		for _, urlModel := range page.URLs {
+			response.Links = append(response.Links, linkResponse(c, urlModel))
+		}
+		utils.RespondWithJSON(c, http.StatusOK, response)
+	}
+}
+
+// GetLinkHandler returns the link resource for a short code.
+func GetLinkHandler(store storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shortCode := c.Param("shortCode")
+
+		urlModel, exists := store.GetURL(shortCode)
+		if !exists || isExpired(urlModel) {
+			utils.RespondWithError(c, http.StatusNotFound, "Short URL not found")
+			return
+		}
+
+		utils.RespondWithJSON(c, http.StatusOK, linkResponse(c, urlModel))
+	}
+}
+
+// UpdateLinkHandler changes the destination, expiry, password, flagged or disabled state of a link.
+func UpdateLinkHandler(store storage.Store, opts ...Option) gin.HandlerFunc {
+	cfg := newConfig(opts)
+	return func(c *gin.Context) {
+		shortCode := c.Param("shortCode")
+
+		var request models.UpdateLinkRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		if request.URL == nil && request.ExpiryInMins == nil && request.ActivatesAt == nil && request.ExpiresAt == nil &&
+			request.Disabled == nil && request.Flagged == nil && request.RedirectCode == nil && request.QueryMode == nil && request.ForwardPath == nil &&
+			request.MaxClicks == nil && request.Password == nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "No fields to update")
+			return
+		}
+		if request.URL != nil && !services.IsValidURL(*request.URL) {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid URL")
+			return
+		}
+		if request.URL != nil {
+			// Store internationalized hosts in their punycode form
+			normalized, err := services.NormalizeURL(*request.URL)
+			if err != nil {
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid URL")
+				return
+			}
+			request.URL = &normalized
+		}
+		if request.URL != nil && cfg.domains != nil && !cfg.domains.Allowed(*request.URL) {
+			utils.RespondWithError(c, http.StatusForbidden, "Destination is not allowed")
+			return
+		}
+		var flagged bool
+		if request.URL != nil {
+			var ok bool
+			if flagged, ok = guardDestination(c, cfg, *request.URL); !ok {
+				return
+			}
+			var suspicious bool
+			if suspicious, ok = checkHomographs(c, cfg, *request.URL); !ok {
+				return
+			}
+			flagged = flagged || suspicious
+		}
+		if request.ExpiryInMins != nil && *request.ExpiryInMins < 0 {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid expiry")
+			return
+		}
+		var activatesAt, expiresAt time.Time
+		if request.ActivatesAt != nil {
+			var err error
+			if activatesAt, err = parseTimestamp(*request.ActivatesAt); err != nil {
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid activation time")
+				return
+			}
+		}
+		if request.ExpiresAt != nil {
+			// expires_at and expiry_in_mins are alternatives
+			var err error
+			expiresAt, err = parseTimestamp(*request.ExpiresAt)
+			if err != nil || request.ExpiryInMins != nil || (!expiresAt.IsZero() && !expiresAt.After(time.Now())) {
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid expiry")
+				return
+			}
+		}
+		if request.RedirectCode != nil && *request.RedirectCode != 0 && !services.IsValidRedirectCode(*request.RedirectCode) {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid redirect code")
+			return
+		}
+		if request.MaxClicks != nil && *request.MaxClicks < 0 {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid click limit")
+			return
+		}
+		var queryMode string
+		if request.QueryMode != nil {
+			var err error
+			if queryMode, err = services.ParseQueryMode(*request.QueryMode); err != nil {
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid query mode")
+				return
+			}
+		}
+		// Hash a new password before the update; "" removes the protection
+		var passwordHash string
+		if request.Password != nil && *request.Password != "" {
+			var err error
+			if passwordHash, err = services.HashPassword(*request.Password); err != nil {
+				if errors.Is(err, services.ErrInvalidPassword) {
+					utils.RespondWithError(c, http.StatusBadRequest, "Invalid password")
+					return
+				}
+				log.Printf("[ERROR] Failed to hash password for short code %s: %v", shortCode, err)
+				utils.RespondWithError(c, http.StatusInternalServerError, "Error updating short URL")
+				return
+			}
+		}
+
+		urlModel, err := store.UpdateURL(shortCode, func(urlModel *models.URL) error {
+			if isExpired(urlModel) {
+				return errLinkExpired
+			}
+			if request.URL != nil {
+				urlModel.LongURL = *request.URL
+			}
+			if request.ExpiryInMins != nil {
+				// Zero clears the expiry
+				urlModel.ExpiresAt = time.Time{}
+				if *request.ExpiryInMins > 0 {
+					urlModel.ExpiresAt = time.Now().Add(time.Duration(*request.ExpiryInMins) * time.Minute)
+				}
+			}
+			if request.ExpiresAt != nil {
+				urlModel.ExpiresAt = expiresAt
+			}
+			if request.ActivatesAt != nil {
+				urlModel.ActivatesAt = activatesAt
+			}
+			if !validWindow(urlModel.ActivatesAt, urlModel.ExpiresAt) {
+				return errInvalidWindow
+			}
+			if request.Disabled != nil {
+				urlModel.Disabled = *request.Disabled
+			}
+			if request.Flagged != nil {
+				urlModel.Flagged = *request.Flagged
+			}
+			// Retargeting to an internal or suspicious destination flags the link,
+			// whatever the request asks for
+			urlModel.Flagged = urlModel.Flagged || flagged
+			if request.RedirectCode != nil {
+				// Zero reverts to the server default
+				urlModel.RedirectCode = *request.RedirectCode
+			}
+			if request.QueryMode != nil {
+				urlModel.QueryMode = queryMode
+			}
+			if request.ForwardPath != nil {
+				urlModel.ForwardPath = *request.ForwardPath
+			}
+			if request.MaxClicks != nil {
+				// Zero removes the limit
+				urlModel.MaxClicks = *request.MaxClicks
+			}
+			if request.Password != nil {
+				urlModel.PasswordHash = passwordHash
+			}
+			return nil
+		})
+		if errors.Is(err, errInvalidWindow) {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid activation window")
+			return
+		}
+		if errors.Is(err, storage.ErrURLNotFound) || errors.Is(err, errLinkExpired) {
+			utils.RespondWithError(c, http.StatusNotFound, "Short URL not found")
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] Failed to update short code %s: %v", shortCode, err)
+			utils.RespondWithError(c, http.StatusInternalServerError, "Error updating short URL")
+			return
+		}
+
+		utils.RespondWithJSON(c, http.StatusOK, linkResponse(c, urlModel))
+	}
+}
+
+// DeleteLinkHandler removes a link.
+func DeleteLinkHandler(store storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shortCode := c.Param("shortCode")
+
+		if _, exists := store.GetURL(shortCode); !exists {
+			utils.RespondWithError(c, http.StatusNotFound, "Short URL not found")
+			return
+		}
+		if err := store.DeleteURL(shortCode); err != nil {
+			log.Printf("[ERROR] Failed to delete short code %s: %v", shortCode, err)
+			utils.RespondWithError(c, http.StatusInternalServerError, "Error deleting short URL")
+			return
+		}
+
+		log.Printf("[INFO] Deleted short code %s", shortCode)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// linkResponse builds the link resource for urlModel.
+func linkResponse(c *gin.Context, urlModel *models.URL) models.LinkResponse {
+	queryMode := urlModel.QueryMode
+	if queryMode == "" {
+		queryMode = "none"
+	}
+	response := models.LinkResponse{
+		BaseURL:      urlModel.BaseURL,
+		ShortCode:    urlModel.ShortCode,
+		ShortURL:     constructShortURL(c, urlModel.ShortCode),
+		ActivatesAt:  activationTime(urlModel),
+		Alias:        urlModel.Alias,
+		Disabled:     urlModel.Disabled,
+		Flagged:      urlModel.Flagged,
+		RedirectCode: urlModel.RedirectCode,
+		QueryMode:    queryMode,
+		ForwardPath:  urlModel.ForwardPath,
+		MaxClicks:    urlModel.MaxClicks,
+		Protected:    urlModel.PasswordHash != "",
+		Tags:         urlModel.Tags,
+	}
+	if hidesDestination(urlModel) {
+		response.LongURL = ""
+	}
+	return response
+}
+
+// activationTime returns the activation time of urlModel for responses, or nil
+// if the link is not scheduled.
+func activationTime(urlModel *models.URL) *time.Time {
+	if urlModel.ActivatesAt.IsZero() {
+		return nil
+	}
+	activatesAt := urlModel.ActivatesAt
+	return &activatesAt
+}
+
+// hidesDestination reports whether responses leave out the destination of
+// urlModel. Protected links reveal it only to visitors who enter the password,
+// and click-limited links only to visitors who use up a click.
+func hidesDestination(urlModel *models.URL) bool {
+	return urlModel.PasswordHash != "" || urlModel.MaxClicks > 0
+}
+
+// parseTimeQuery parses the RFC 3339 query parameter name, returning the zero
+// time if it is not set.
+func parseTimeQuery(c *gin.Context, name string) (time.Time, error) {
+	return parseTimestamp(c.Query(name))
+}
+
+// parseTimestamp parses an RFC 3339 timestamp, returning the zero time for "".
+func parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// validWindow reports whether a link activating at activatesAt and expiring at
+// expiresAt, either of which may be zero, can ever resolve.
+func validWindow(activatesAt time.Time, expiresAt time.Time) bool {
+	return activatesAt.IsZero() || expiresAt.IsZero() || activatesAt.Before(expiresAt)
+}
+
+// isExpired reports whether urlModel has an expiry time in the past.
+func isExpired(urlModel *models.URL) bool {
+	return !urlModel.ExpiresAt.IsZero() && time.Now().After(urlModel.ExpiresAt)
+}
+
+// isPending reports whether urlModel is scheduled to activate in the future.
+func isPending(urlModel *models.URL) bool {
+	return !urlModel.ActivatesAt.IsZero() && time.Now().Before(urlModel.ActivatesAt)
+}
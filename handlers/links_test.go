@@ -0,0 +1,581 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+	"github.com/Codedude1/shorty/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newLinksRouter registers the link management routes and the redirect on a test router.
+func newLinksRouter(store storage.Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/links", ListLinksHandler(store))
+	router.GET("/links/:shortCode", GetLinkHandler(store))
+	router.PATCH("/links/:shortCode", UpdateLinkHandler(store))
+	router.DELETE("/links/:shortCode", DeleteLinkHandler(store))
+	router.GET("/:shortCode", RedirectHandler(store))
+	return router
+}
+
+func TestGetLinkHandler(t *testing.T) {
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com", "link1", time.Time{})
+	store.AddURL("https://www.expired.com", "expired1", time.Now().Add(-time.Hour))
+	router := newLinksRouter(store)
+
+	// Test case: Existing link
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/links/link1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.LinkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "link1", response.ShortCode)
+	assert.Equal(t, "https://www.example.com", response.LongURL)
+	assert.True(t, strings.HasSuffix(response.ShortURL, "/link1"))
+	assert.False(t, response.Disabled)
+
+	// Test case: Expired and missing links are not found
+	for _, path := range []string{"/links/expired1", "/links/nonexist"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+func TestLinkMetadata_HiddenDestinations(t *testing.T) {
+	store := storage.NewStorage()
+	router := newLinksRouter(store)
+	router.GET("/stats/:shortCode", StatsHandler(store))
+
+	hash, err := services.HashPassword("opensesame")
+	assert.NoError(t, err)
+	tests := []struct {
+		name   string
+		link   models.URL
+		hidden bool
+	}{
+		{
+			name: "Open links show their destination",
+			link: models.URL{BaseURL: models.BaseURL{LongURL: "https://www.example.com/open"}, ShortCode: "open1"},
+		},
+		{
+			name:   "Protected links hide their destination",
+			link:   models.URL{BaseURL: models.BaseURL{LongURL: "https://www.example.com/doc"}, ShortCode: "secret1", PasswordHash: hash},
+			hidden: true,
+		},
+		{
+			name:   "One-time links hide their destination",
+			link:   models.URL{BaseURL: models.BaseURL{LongURL: "https://secret.example.com/token123"}, ShortCode: "once1", MaxClicks: 1},
+			hidden: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			tt.link.CreatedAt = time.Now()
+			_, _, err := store.CreateURL(&tt.link)
+			assert.NoError(t, err)
+
+			for _, path := range []string{"/links/" + tt.link.ShortCode, "/stats/" + tt.link.ShortCode} {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				assert.Equal(t, http.StatusOK, w.Code, path)
+				assert.Equal(t, !tt.hidden, strings.Contains(w.Body.String(), `"long_url"`), path)
+				assert.Equal(t, !tt.hidden, strings.Contains(w.Body.String(), tt.link.LongURL), path)
+			}
+		})
+	}
+}
+
+func TestLinkMetadata_ActivationTime(t *testing.T) {
+	store := storage.NewStorage()
+	router := newLinksRouter(store)
+	router.GET("/stats/:shortCode", StatsHandler(store))
+
+	activatesAt := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	for _, urlModel := range []*models.URL{
+		{BaseURL: models.BaseURL{LongURL: "https://www.example.com/now", CreatedAt: time.Now()}, ShortCode: "now1", Alias: true},
+		{BaseURL: models.BaseURL{LongURL: "https://www.example.com/later", CreatedAt: time.Now()}, ShortCode: "later1", Alias: true, ActivatesAt: activatesAt},
+	} {
+		_, _, err := store.CreateURL(urlModel)
+		assert.NoError(t, err)
+	}
+
+	for _, path := range []string{"/links/", "/stats/"} {
+		// Test case: Links that are not scheduled leave the field out
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"now1", nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.NotContains(t, w.Body.String(), `"activates_at"`, path)
+
+		// Test case: Scheduled links include their activation time
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"later1", nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Contains(t, w.Body.String(), `"activates_at":"2030-01-01T09:00:00Z"`, path)
+	}
+}
+
+func TestUpdateLinkHandler(t *testing.T) {
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com", "link1", time.Time{})
+	store.AddURL("https://www.expired.com", "expired1", time.Now().Add(-time.Hour))
+	router := newLinksRouter(store)
+
+	// Define test cases; they run in order against the same link
+	tests := []struct {
+		name           string
+		shortCode      string
+		body           string
+		expectedStatus int
+		expectedError  string
+		check          func(t *testing.T, response models.LinkResponse)
+	}{
+		{
+			name:           "Retarget Destination",
+			shortCode:      "link1",
+			body:           `{"url": "https://www.retargeted.com"}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.Equal(t, "https://www.retargeted.com", response.LongURL)
+				_, exists := store.GetShortCode("https://www.example.com", nil)
+				assert.False(t, exists, "Old destination should no longer be indexed")
+				shortCode, _ := store.GetShortCode("https://www.retargeted.com", nil)
+				assert.Equal(t, "link1", shortCode, "New destination should be indexed")
+			},
+		},
+		{
+			name:           "Set Expiry",
+			shortCode:      "link1",
+			body:           `{"expiry_in_mins": 30}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.WithinDuration(t, time.Now().Add(30*time.Minute), response.ExpiresAt, time.Minute)
+			},
+		},
+		{
+			name:           "Clear Expiry",
+			shortCode:      "link1",
+			body:           `{"expiry_in_mins": 0}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.True(t, response.ExpiresAt.IsZero(), "Expiry should be cleared")
+			},
+		},
+		{
+			name:           "Disable Link",
+			shortCode:      "link1",
+			body:           `{"disabled": true}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.True(t, response.Disabled)
+			},
+		},
+		{
+			name:           "Set Redirect Code",
+			shortCode:      "link1",
+			body:           `{"redirect_code": 308}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.Equal(t, http.StatusPermanentRedirect, response.RedirectCode)
+			},
+		},
+		{
+			name:           "Revert Redirect Code",
+			shortCode:      "link1",
+			body:           `{"redirect_code": 0}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.Zero(t, response.RedirectCode, "Zero should revert to the server default")
+			},
+		},
+		{
+			name:           "Invalid Redirect Code",
+			shortCode:      "link1",
+			body:           `{"redirect_code": 303}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid redirect code",
+		},
+		{
+			name:           "Enable Passthrough",
+			shortCode:      "link1",
+			body:           `{"query_mode": "merge", "forward_path": true}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.Equal(t, "merge", response.QueryMode)
+				assert.True(t, response.ForwardPath)
+			},
+		},
+		{
+			name:           "Disable Passthrough",
+			shortCode:      "link1",
+			body:           `{"query_mode": "none", "forward_path": false}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.Equal(t, "none", response.QueryMode)
+				assert.False(t, response.ForwardPath)
+			},
+		},
+		{
+			name:           "Schedule Activation",
+			shortCode:      "link1",
+			body:           `{"activates_at": "2030-01-01T09:00:00Z", "expires_at": "2030-01-31T09:00:00Z"}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				if assert.NotNil(t, response.ActivatesAt) {
+					assert.Equal(t, time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC), response.ActivatesAt.UTC())
+				}
+				assert.Equal(t, time.Date(2030, 1, 31, 9, 0, 0, 0, time.UTC), response.ExpiresAt.UTC())
+			},
+		},
+		{
+			name:           "Expiry Before Activation",
+			shortCode:      "link1",
+			body:           `{"expires_at": "2029-12-31T09:00:00Z"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid activation window",
+		},
+		{
+			name:           "Malformed Activation Time",
+			shortCode:      "link1",
+			body:           `{"activates_at": "2030-01-01"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid activation time",
+		},
+		{
+			name:           "Clear Schedule",
+			shortCode:      "link1",
+			body:           `{"activates_at": "", "expires_at": ""}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.Nil(t, response.ActivatesAt, "Activation time should be cleared")
+				assert.True(t, response.ExpiresAt.IsZero(), "Expiry should be cleared")
+			},
+		},
+		{
+			name:           "Flag Link",
+			shortCode:      "link1",
+			body:           `{"flagged": true}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.True(t, response.Flagged)
+			},
+		},
+		{
+			name:           "Clear Flag",
+			shortCode:      "link1",
+			body:           `{"flagged": false}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.False(t, response.Flagged)
+			},
+		},
+		{
+			name:           "Set Password",
+			shortCode:      "link1",
+			body:           `{"password": "open sesame"}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.True(t, response.Protected)
+			},
+		},
+		{
+			name:           "Password Too Long",
+			shortCode:      "link1",
+			body:           `{"password": "` + strings.Repeat("x", 73) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid password",
+		},
+		{
+			name:           "Remove Password",
+			shortCode:      "link1",
+			body:           `{"password": ""}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.False(t, response.Protected)
+			},
+		},
+		{
+			name:           "Set Click Limit",
+			shortCode:      "link1",
+			body:           `{"max_clicks": 5}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.Equal(t, 5, response.MaxClicks)
+			},
+		},
+		{
+			name:           "Remove Click Limit",
+			shortCode:      "link1",
+			body:           `{"max_clicks": 0}`,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, response models.LinkResponse) {
+				assert.Equal(t, 0, response.MaxClicks)
+			},
+		},
+		{
+			name:           "Invalid Click Limit",
+			shortCode:      "link1",
+			body:           `{"max_clicks": -1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid click limit",
+		},
+		{
+			name:           "Invalid Query Mode",
+			shortCode:      "link1",
+			body:           `{"query_mode": "append"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid query mode",
+		},
+		{
+			name:           "Invalid URL",
+			shortCode:      "link1",
+			body:           `{"url": "not-a-url"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid URL",
+		},
+		{
+			name:           "Negative Expiry",
+			shortCode:      "link1",
+			body:           `{"expiry_in_mins": -5}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid expiry",
+		},
+		{
+			name:           "Empty Update",
+			shortCode:      "link1",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "No fields to update",
+		},
+		{
+			name:           "Expired Link",
+			shortCode:      "expired1",
+			body:           `{"expiry_in_mins": 60}`,
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "Short URL not found",
+		},
+		{
+			name:           "Non-Existent Link",
+			shortCode:      "nonexist",
+			body:           `{"disabled": false}`,
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "Short URL not found",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/links/"+tt.shortCode, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedError, response["error"])
+				return
+			}
+			var response models.LinkResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			tt.check(t, response)
+		})
+	}
+
+	// Disabled links stop redirecting until re-enabled
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/link1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "Disabled link should not redirect")
+
+	req := httptest.NewRequest(http.MethodPatch, "/links/link1", strings.NewReader(`{"disabled": false}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/link1", nil))
+	assert.Equal(t, http.StatusFound, w.Code, "Re-enabled link should redirect")
+	assert.Equal(t, "https://www.retargeted.com", w.Header().Get("Location"))
+}
+
+func TestUpdateLinkHandler_DomainPolicy(t *testing.T) {
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com", "link1", time.Time{})
+	policy, _ := newDomainPolicy(t, "deny phish.example\n")
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PATCH("/links/:shortCode", UpdateLinkHandler(store, WithDomainPolicy(policy)))
+
+	// Test case: Links cannot be retargeted to blocked destinations
+	req := httptest.NewRequest(http.MethodPatch, "/links/link1", strings.NewReader(`{"url": "https://phish.example/login"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	urlModel, _ := store.GetURL("link1")
+	assert.Equal(t, "https://www.example.com", urlModel.LongURL)
+
+	// Test case: Other fields can still be changed
+	req = httptest.NewRequest(http.MethodPatch, "/links/link1", strings.NewReader(`{"disabled": false}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestUpdateLinkHandler_DestinationGuard(t *testing.T) {
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com", "link1", time.Time{})
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PATCH("/links/:shortCode", UpdateLinkHandler(store, WithDestinationGuard(services.NewDestinationGuard(nil, nil), true)))
+
+	// Test case: Links cannot be retargeted back at the shortener
+	req := httptest.NewRequest(http.MethodPatch, "/links/link1", strings.NewReader(`{"url": "http://example.com/link1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test case: Retargeting to an internal destination flags the link
+	req = httptest.NewRequest(http.MethodPatch, "/links/link1", strings.NewReader(`{"url": "http://192.168.0.1/"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.LinkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Flagged)
+}
+
+func TestUpdateLinkHandler_Homographs(t *testing.T) {
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com", "link1", time.Time{})
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PATCH("/links/:shortCode", UpdateLinkHandler(store, WithHomographDetector(services.NewHomographDetector([]string{"paypal"}), false)))
+
+	// Test case: Retargeting to a lookalike host is refused
+	req := httptest.NewRequest(http.MethodPatch, "/links/link1", strings.NewReader(`{"url": "https://paypa1.com/"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Destination host imitates a protected domain")
+
+	// Test case: Clients cannot clear the flag of a suspicious destination
+	router.PATCH("/flag/:shortCode", UpdateLinkHandler(store, WithHomographDetector(services.NewHomographDetector(nil), true)))
+	req = httptest.NewRequest(http.MethodPatch, "/flag/link1", strings.NewReader(`{"url": "https://xn--pple-43d.com", "flagged": false}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.LinkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Flagged)
+
+	// Test case: Unicode hosts are stored in their punycode form
+	req = httptest.NewRequest(http.MethodPatch, "/links/link1", strings.NewReader(`{"url": "https://bücher.de/"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	urlModel, _ := store.GetURL("link1")
+	assert.Equal(t, "https://xn--bcher-kva.de/", urlModel.LongURL)
+}
+
+func TestDeleteLinkHandler(t *testing.T) {
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com", "link1", time.Time{})
+	router := newLinksRouter(store)
+
+	// Test case: Deleting an existing link
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/links/link1", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, exists := store.GetURL("link1")
+	assert.False(t, exists, "Link should be removed from storage")
+	_, exists = store.GetShortCode("https://www.example.com", nil)
+	assert.False(t, exists, "Long URL index should be cleaned up")
+
+	// Test case: Deleting it again
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/links/link1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestListLinksHandler(t *testing.T) {
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com/1", "list1", time.Time{})
+	store.AddURL("https://www.example.com/2", "list2", time.Time{})
+	store.AddURL("https://www.other.org/3", "list3", time.Time{})
+	for i := 0; i < 3; i++ {
+		store.IncrementAccessCount("list2")
+	}
+	router := newLinksRouter(store)
+
+	// fetch requests path and decodes a successful page
+	fetch := func(t *testing.T, path string) models.ListLinksResponse {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.ListLinksResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	// Test case: Paging through links by access count
+	page := fetch(t, "/links?sort=access_count&limit=1")
+	assert.Len(t, page.Links, 1)
+	assert.Equal(t, "list2", page.Links[0].ShortCode, "Most accessed link should come first")
+	assert.NotEmpty(t, page.NextCursor)
+	var codes []string
+	for page.NextCursor != "" {
+		page = fetch(t, "/links?sort=access_count&limit=1&cursor="+page.NextCursor)
+		for _, link := range page.Links {
+			codes = append(codes, link.ShortCode)
+		}
+	}
+	assert.ElementsMatch(t, []string{"list1", "list3"}, codes, "Remaining links should follow the cursor")
+
+	// Test case: Filtering by host
+	page = fetch(t, "/links?host=other.org")
+	assert.Len(t, page.Links, 1)
+	assert.Equal(t, "list3", page.Links[0].ShortCode)
+	assert.Empty(t, page.NextCursor)
+
+	// Test case: Filtering by creation time
+	page = fetch(t, "/links?created_after="+time.Now().Add(time.Hour).Format(time.RFC3339))
+	assert.Empty(t, page.Links)
+
+	// Test case: Invalid parameters
+	for path, expectedError := range map[string]string{
+		"/links?sort=long_url":           "Invalid sort or status",
+		"/links?status=deleted":          "Invalid sort or status",
+		"/links?order=sideways":          "Invalid order",
+		"/links?limit=0":                 "Invalid limit",
+		"/links?limit=1000":              "Invalid limit",
+		"/links?created_before=today":    "Invalid created_before",
+		"/links?cursor=bogus":            "Invalid cursor",
+		"/links?created_after=yesterday": "Invalid created_after",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		var response map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, expectedError, response["error"], path)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/Codedude1/shorty/analytics"
+	"github.com/Codedude1/shorty/services"
+)
+
+// Option customizes the behaviour of the handlers in this package.
+type Option func(*config)
+
+// config holds the settings shared by the handlers.
+type config struct {
+	reservedAliases   []string
+	clicks            *analytics.Recorder
+	visitorKey        []byte
+	geoIP             *analytics.GeoIP
+	bots              *analytics.BotFilter
+	redirectCode      int
+	botClickLimits    bool
+	pendingStatus     int
+	pendingURL        string
+	lockout           *services.Lockout
+	warnings          services.WarningPolicy
+	interstitialDelay time.Duration
+	interstitialPage  *template.Template
+	continueKey       []byte
+	domains           *services.DomainPolicy
+	guard             *services.DestinationGuard
+	flagInternal      bool
+	homographs        *services.HomographDetector
+	flagHomographs    bool
+}
+
+// newConfig applies opts on top of the defaults.
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		reservedAliases:   services.DefaultReservedAliases,
+		bots:              analytics.NewBotFilter(analytics.DefaultBotUserAgents),
+		redirectCode:      http.StatusFound,
+		pendingStatus:     http.StatusNotFound,
+		lockout:           services.NewLockout(services.DefaultMaxAttempts, services.DefaultLockout),
+		warnings:          services.NewAllowlistPolicy(nil),
+		interstitialDelay: DefaultInterstitialDelay,
+		interstitialPage:  defaultInterstitialPage,
+		continueKey:       make([]byte, 32),
+	}
+	rand.Read(cfg.continueKey) // The system random source does not fail on supported platforms
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithReservedAliases sets the words that custom aliases may not use.
+func WithReservedAliases(words []string) Option {
+	return func(cfg *config) {
+		cfg.reservedAliases = words
+	}
+}
+
+// WithClickRecorder makes redirects emit a click event to recorder.
+func WithClickRecorder(recorder *analytics.Recorder) Option {
+	return func(cfg *config) {
+		cfg.clicks = recorder
+	}
+}
+
+// WithVisitorKey makes click events carry a visitor ID derived from the client
+// with key, for unique visitor counts. Without it no visitor IDs are recorded.
+func WithVisitorKey(key []byte) Option {
+	return func(cfg *config) {
+		cfg.visitorKey = key
+	}
+}
+
+// WithGeoIP makes click events carry the country of the client, resolved with db.
+func WithGeoIP(db *analytics.GeoIP) Option {
+	return func(cfg *config) {
+		cfg.geoIP = db
+	}
+}
+
+// WithBotFilter sets how redirects are classified as bots. Bot redirects count
+// towards BotCount instead of AccessCount and are left out of click rollups. A
+// nil filter treats every redirect as human.
+func WithBotFilter(filter *analytics.BotFilter) Option {
+	return func(cfg *config) {
+		cfg.bots = filter
+	}
+}
+
+// WithRedirectCode sets the status used to redirect links that do not choose
+// their own; it must be 301, 302, 307 or 308.
+func WithRedirectCode(code int) Option {
+	return func(cfg *config) {
+		cfg.redirectCode = code
+	}
+}
+
+// WithBotClickLimits makes redirects of click-limited links that are classified
+// as bots count as visits, so they use up clicks. By default bots never use up
+// clicks, so link unfurlers cannot burn one-time links; they are refused once
+// the clicks are gone.
+func WithBotClickLimits(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.botClickLimits = enabled
+	}
+}
+
+// WithNotYetAvailable sets the response to requests for scheduled links before
+// their activation time: an error with status, or a temporary redirect to
+// location if it is not empty. The default is 404 Not Found.
+func WithNotYetAvailable(status int, location string) Option {
+	return func(cfg *config) {
+		cfg.pendingStatus = status
+		cfg.pendingURL = location
+	}
+}
+
+// WithPasswordLockout sets how failed password attempts lock out protected
+// links. A nil lockout allows unlimited attempts.
+func WithPasswordLockout(lockout *services.Lockout) Option {
+	return func(cfg *config) {
+		cfg.lockout = lockout
+	}
+}
+
+// WithInterstitial sets which redirects show the interstitial warning page,
+// and how long it counts down before continuing to the destination; 0 waits
+// for the visitor to continue. A nil policy always redirects straight away.
+// By default only links flagged as suspicious are warned about.
+func WithInterstitial(policy services.WarningPolicy, delay time.Duration) Option {
+	return func(cfg *config) {
+		cfg.warnings = policy
+		cfg.interstitialDelay = delay
+	}
+}
+
+// WithInterstitialTemplate replaces the interstitial page, for example with one
+// from LoadInterstitialTemplate.
+func WithInterstitialTemplate(page *template.Template) Option {
+	return func(cfg *config) {
+		cfg.interstitialPage = page
+	}
+}
+
+// WithInterstitialKey signs the continue links of the interstitial page with
+// key, so instances sharing it accept each other's links. By default each
+// handler signs with a random key of its own.
+func WithInterstitialKey(key []byte) Option {
+	return func(cfg *config) {
+		cfg.continueKey = key
+	}
+}
+
+// WithDomainPolicy makes shortening, retargeting and redirecting refuse
+// destinations that policy does not allow. Without it any host is allowed.
+func WithDomainPolicy(policy *services.DomainPolicy) Option {
+	return func(cfg *config) {
+		cfg.domains = policy
+	}
+}
+
+// WithDestinationGuard makes shortening and retargeting refuse destinations
+// that guard rejects. With flagInternal, destinations in internal networks are
+// accepted as links flagged as suspicious instead; links back to the shortener
+// are always refused.
+func WithDestinationGuard(guard *services.DestinationGuard, flagInternal bool) Option {
+	return func(cfg *config) {
+		cfg.guard = guard
+		cfg.flagInternal = flagInternal
+	}
+}
+
+// WithHomographDetector makes shortening and retargeting refuse destinations
+// whose host mixes scripts or imitates a protected brand. With flag, they are
+// accepted as links flagged as suspicious instead, so visitors see the
+// interstitial warning before being redirected.
+func WithHomographDetector(detector *services.HomographDetector, flag bool) Option {
+	return func(cfg *config) {
+		cfg.homographs = detector
+		cfg.flagHomographs = flag
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+	"github.com/Codedude1/shorty/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// passwordHeader carries the password of a protected link for API clients.
+const passwordHeader = "X-Link-Password"
+
+// passwordParam is the form field and query parameter carrying the password of
+// a protected link. It is never passed on to the destination.
+const passwordParam = "password"
+
+// passwordPage is the prompt browsers get for protected links. The form posts
+// back to the same URL, keeping any path suffix and query string.
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<form method="post">
+<h1>This link is password protected</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>
+{{end}}<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// authorizeLink checks the password supplied for a protected link. It responds
+// and returns false unless the password is correct: with the prompt page for
+// browsers and a JSON error for other clients, 401 Unauthorized while the
+// password is missing or wrong and 429 Too Many Requests while the link is
+// locked out after repeated failures or all attempts left are being checked.
+func authorizeLink(c *gin.Context, cfg *config, urlModel *models.URL) bool {
+	// Neither the prompt nor a redirect that got past it may be cached
+	c.Header("Cache-Control", "no-store")
+
+	shortCode := urlModel.ShortCode
+	if cfg.lockout != nil {
+		if wait := cfg.lockout.Locked(shortCode); wait > 0 {
+			respondLockedOut(c, wait)
+			return false
+		}
+	}
+
+	password, supplied := linkPassword(c)
+	if !supplied {
+		respondPasswordRequired(c, "Password required", "")
+		return false
+	}
+	// Reserve the attempt before the slow comparison, so concurrent guesses
+	// cannot all get past the lock
+	if cfg.lockout != nil {
+		if wait := cfg.lockout.Attempt(shortCode); wait > 0 {
+			respondLockedOut(c, wait)
+			return false
+		}
+	}
+	if !services.CheckPassword(urlModel.PasswordHash, password) {
+		if cfg.lockout != nil {
+			if wait := cfg.lockout.Fail(shortCode); wait > 0 {
+				log.Printf("[WARN] Locked short code %s after repeated failed password attempts", shortCode)
+				respondLockedOut(c, wait)
+				return false
+			}
+		}
+		respondPasswordRequired(c, "Invalid password", "Incorrect password, please try again.")
+		return false
+	}
+	if cfg.lockout != nil {
+		cfg.lockout.Release(shortCode)
+	}
+	return true
+}
+
+// linkPassword returns the password supplied with the request: the
+// X-Link-Password header, the password field of a submitted prompt, or the
+// password query parameter, in that order.
+func linkPassword(c *gin.Context) (string, bool) {
+	if password := c.GetHeader(passwordHeader); password != "" {
+		return password, true
+	}
+	if c.Request.Method == http.MethodPost {
+		if password, exists := c.GetPostForm(passwordParam); exists {
+			return password, true
+		}
+	}
+	return c.GetQuery(passwordParam)
+}
+
+// submittedPrompt reports whether the request submits the password prompt, as
+// opposed to an API client sending the password with its own request.
+func submittedPrompt(c *gin.Context) bool {
+	if c.Request.Method != http.MethodPost || c.GetHeader(passwordHeader) != "" {
+		return false
+	}
+	_, exists := c.GetPostForm(passwordParam)
+	return exists
+}
+
+// respondPasswordRequired answers a request without the right password with
+// 401 Unauthorized: the prompt showing prompt for browsers, or message as a
+// JSON error.
+func respondPasswordRequired(c *gin.Context, message string, prompt string) {
+	if !wantsHTML(c) {
+		utils.RespondWithError(c, http.StatusUnauthorized, message)
+		return
+	}
+	renderPasswordPage(c, http.StatusUnauthorized, prompt)
+}
+
+// respondLockedOut answers a request for a locked out link with 429 Too Many
+// Requests and a Retry-After header of wait, rounded up to whole seconds.
+func respondLockedOut(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	if !wantsHTML(c) {
+		utils.RespondWithError(c, http.StatusTooManyRequests, "Too many failed password attempts")
+		return
+	}
+	renderPasswordPage(c, http.StatusTooManyRequests, "Too many failed attempts, please try again later.")
+}
+
+// renderPasswordPage writes the prompt page with status, showing message if it is not empty.
+func renderPasswordPage(c *gin.Context, status int, message string) {
+	var page bytes.Buffer
+	if err := passwordPage.Execute(&page, struct{ Error string }{message}); err != nil {
+		log.Printf("[ERROR] Failed to render password page: %v", err)
+		utils.RespondWithError(c, http.StatusInternalServerError, "Failed to render password page")
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
+
+// wantsHTML reports whether the client prefers an HTML page, as browsers do,
+// over JSON. Clients that send no Accept header get JSON.
+func wantsHTML(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+}
+
+// stripPassword removes the password query parameter from rawQuery, so it never
+// reaches the destination. The other parameters keep their order and encoding.
+func stripPassword(rawQuery string) string {
+	return services.RemoveQueryParam(rawQuery, passwordParam)
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+	"github.com/Codedude1/shorty/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newProtectedLink stores an alias for longURL protected by password.
+func newProtectedLink(t *testing.T, store storage.Store, shortCode string, longURL string, password string) {
+	hash, err := services.HashPassword(password)
+	require.NoError(t, err)
+	_, _, err = store.CreateURL(&models.URL{
+		BaseURL:      models.BaseURL{LongURL: longURL, CreatedAt: time.Now()},
+		ShortCode:    shortCode,
+		Alias:        true,
+		QueryMode:    services.QueryModeMerge,
+		PasswordHash: hash,
+	})
+	require.NoError(t, err)
+}
+
+func TestRedirectHandler_Password(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	newProtectedLink(t, store, "docs1", "https://www.example.com/internal", "open sesame")
+	router := gin.Default()
+	router.GET("/:shortCode", RedirectHandler(store, WithPasswordLockout(nil)))
+	router.POST("/:shortCode", RedirectHandler(store, WithPasswordLockout(nil)))
+
+	form := url.Values{"password": {"open sesame"}}.Encode()
+	tests := []struct {
+		name             string
+		method           string
+		target           string
+		header           map[string]string
+		body             string
+		expectedStatus   int
+		expectedLocation string
+		expectedError    string
+		expectedPage     bool
+	}{
+		{
+			name:           "No Password",
+			target:         "/docs1",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "Password required",
+		},
+		{
+			name:           "Browser Gets The Prompt",
+			target:         "/docs1",
+			header:         map[string]string{"Accept": "text/html,application/xhtml+xml,*/*;q=0.8"},
+			expectedStatus: http.StatusUnauthorized,
+			expectedPage:   true,
+		},
+		{
+			name:           "Wrong Password",
+			target:         "/docs1",
+			header:         map[string]string{"X-Link-Password": "guess"},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "Invalid password",
+		},
+		{
+			name:             "Password Header",
+			target:           "/docs1",
+			header:           map[string]string{"X-Link-Password": "open sesame"},
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.com/internal",
+		},
+		{
+			name:             "Password Parameter Is Not Forwarded",
+			target:           "/docs1?password=open+sesame&page=2",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.com/internal?page=2",
+		},
+		{
+			name:             "Other Parameters Are Forwarded Unchanged",
+			target:           "/docs1?z=%7E&password=open+sesame&a=x+y&z=1",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.com/internal?z=%7E&a=x+y&z=1",
+		},
+		{
+			name:             "Submitted Prompt",
+			method:           http.MethodPost,
+			target:           "/docs1",
+			header:           map[string]string{"Content-Type": "application/x-www-form-urlencoded", "Accept": "text/html"},
+			body:             form,
+			expectedStatus:   http.StatusSeeOther,
+			expectedLocation: "https://www.example.com/internal",
+		},
+		{
+			name:             "POST With Password Header Keeps The Link Status",
+			method:           http.MethodPost,
+			target:           "/docs1",
+			header:           map[string]string{"X-Link-Password": "open sesame"},
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.com/internal",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.target, strings.NewReader(tt.body))
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"), "Protected links should never be cached")
+			if tt.expectedError != "" {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedError, response["error"])
+			}
+			if tt.expectedPage {
+				assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+				assert.Contains(t, w.Body.String(), `<form method="post">`)
+			}
+		})
+	}
+
+	// Test case: Only successful redirects are counted
+	urlModel, _ := store.GetURL("docs1")
+	assert.Equal(t, 5, urlModel.AccessCount)
+
+	// Test case: POSTs to open 307 links are passed on, not turned into GETs
+	_, _, err := store.CreateURL(&models.URL{
+		BaseURL:      models.BaseURL{LongURL: "https://api.example.com/hook", CreatedAt: time.Now()},
+		ShortCode:    "hook1",
+		Alias:        true,
+		RedirectCode: http.StatusTemporaryRedirect,
+	})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/hook1", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://api.example.com/hook", w.Header().Get("Location"))
+}
+
+func TestRedirectHandler_PasswordLockout(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	newProtectedLink(t, store, "docs1", "https://www.example.com/internal", "open sesame")
+	newProtectedLink(t, store, "docs2", "https://www.example.com/other", "open sesame")
+	router := gin.Default()
+	router.GET("/:shortCode", RedirectHandler(store, WithPasswordLockout(services.NewLockout(2, time.Minute))))
+
+	attempt := func(shortCode string, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+		req.Header.Set("X-Link-Password", password)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Test case: The last allowed failure locks the link
+	assert.Equal(t, http.StatusUnauthorized, attempt("docs1", "guess").Code)
+	w := attempt("docs1", "guess")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Test case: Locked links refuse even the right password
+	w = attempt("docs1", "open sesame")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	var response map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Too many failed password attempts", response["error"])
+
+	// Test case: Other links are not locked
+	assert.Equal(t, http.StatusFound, attempt("docs2", "open sesame").Code)
+
+	// Test case: Concurrent guesses are checked no more often than the limit allows
+	newProtectedLink(t, store, "docs3", "https://www.example.com/third", "open sesame")
+	statuses := make(chan int, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- attempt("docs3", "guess").Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+	assert.LessOrEqual(t, counts[http.StatusUnauthorized], 2)
+	assert.Equal(t, cap(statuses), counts[http.StatusUnauthorized]+counts[http.StatusTooManyRequests])
+
+	// Test case: Concurrent right passwords never lock the link
+	newProtectedLink(t, store, "docs4", "https://www.example.com/fourth", "open sesame")
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt("docs4", "open sesame")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, http.StatusFound, attempt("docs4", "open sesame").Code)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+	"github.com/Codedude1/shorty/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// previewSuffix appended to a short code asks for the preview page instead of
+// the redirect. Short codes and aliases never contain it.
+const previewSuffix = "+"
+
+// previewPage shows where a link leads before the visitor follows it.
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Link preview</title>
+</head>
+<body>
+<main>
+<h1>Link preview</h1>
+{{if .Flagged}}<p role="alert">This link has been flagged as suspicious.</p>
+{{end}}<dl>
+<dt>Short link</dt>
+<dd>{{.ShortURL}}</dd>
+{{if .Protected}}<dt>Destination</dt>
+<dd>Hidden until the password is entered</dd>
+{{else if .Limited}}<dt>Destination</dt>
+<dd>Hidden until the link is followed</dd>
+{{else}}<dt>Destination</dt>
+<dd>{{.Destination}}</dd>
+<dt>Host</dt>
+<dd>{{.Host}}</dd>
+{{end}}<dt>Created</dt>
+<dd><time datetime="{{.CreatedAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.UTC.Format "2 January 2006"}}</time></dd>
+<dt>Clicks</dt>
+<dd>{{.AccessCount}}</dd>
+{{if not .ExpiresAt.IsZero}}<dt>Expires</dt>
+<dd><time datetime="{{.ExpiresAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.ExpiresAt.UTC.Format "2 January 2006 15:04 MST"}}</time></dd>
+{{end}}</dl>
+<p><a href="{{.ShortURL}}" role="button">Continue</a></p>
+</main>
+</body>
+</html>
+`))
+
+// preview is the data shown on the preview page.
+type preview struct {
+	models.StatsResponse
+	ShortURL    string
+	Destination string // Where the link leads, with its campaign tags
+	Host        string
+	Protected   bool // The destination of protected links is not shown
+	Limited     bool // Nor that of click-limited links, as previews use up no clicks
+	Flagged     bool
+}
+
+// renderPreview writes the preview page for urlModel. It neither counts as a
+// visit nor reveals the destination of password-protected or click-limited links.
+func renderPreview(c *gin.Context, urlModel *models.URL) {
+	data := preview{
+		StatsResponse: models.StatsResponse{
+			BaseURL: models.BaseURL{
+				LongURL:     urlModel.LongURL,
+				AccessCount: urlModel.AccessCount,
+				BotCount:    urlModel.BotCount,
+				CreatedAt:   urlModel.CreatedAt,
+				ExpiresAt:   urlModel.ExpiresAt,
+			},
+			ActivatesAt: activationTime(urlModel),
+		},
+		ShortURL:  constructShortURL(c, urlModel.ShortCode),
+		Protected: urlModel.PasswordHash != "",
+		Limited:   urlModel.MaxClicks > 0,
+		Flagged:   urlModel.Flagged,
+	}
+	if !data.Protected && !data.Limited {
+		destination, err := services.TaggedURL(urlModel.LongURL, urlModel.Tags)
+		if err != nil {
+			log.Printf("[ERROR] Failed to build destination for %s: %v", urlModel.ShortCode, err)
+			utils.RespondWithError(c, http.StatusInternalServerError, "Failed to build destination URL")
+			return
+		}
+		data.Destination = destination
+		if parsed, err := url.Parse(destination); err == nil {
+			data.Host = parsed.Hostname()
+		}
+	}
+
+	var page bytes.Buffer
+	if err := previewPage.Execute(&page, data); err != nil {
+		log.Printf("[ERROR] Failed to render preview page: %v", err)
+		utils.RespondWithError(c, http.StatusInternalServerError, "Failed to render preview page")
+		return
+	}
+	// The click count changes with every visit
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
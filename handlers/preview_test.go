@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectHandler_Preview(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, urlModel := range []*models.URL{
+		{
+			BaseURL:   models.BaseURL{LongURL: "https://www.example.com/docs?q=<b>", CreatedAt: created, AccessCount: 42},
+			ShortCode: "docs1",
+			Alias:     true,
+			Tags:      map[string]string{"utm_source": "newsletter"},
+		},
+		{
+			BaseURL:      models.BaseURL{LongURL: "https://www.example.com/internal", CreatedAt: created},
+			ShortCode:    "secret1",
+			Alias:        true,
+			PasswordHash: "$2a$10$hash",
+		},
+		{
+			BaseURL:   models.BaseURL{LongURL: "https://secret.example.com/token123", CreatedAt: created},
+			ShortCode: "once1",
+			Alias:     true,
+			MaxClicks: 1,
+		},
+	} {
+		_, _, err := store.CreateURL(urlModel)
+		require.NoError(t, err)
+	}
+	store.AddURL("https://www.expired.com", "expired1", time.Now().Add(-time.Hour))
+	router := gin.Default()
+	router.GET("/:shortCode", RedirectHandler(store))
+
+	tests := []struct {
+		name           string
+		target         string
+		expectedStatus int
+		contains       []string
+		notContains    []string
+	}{
+		{
+			name:           "Preview",
+			target:         "/docs1+",
+			expectedStatus: http.StatusOK,
+			contains: []string{
+				"https://www.example.com/docs?q=&lt;b&gt;&amp;utm_source=newsletter",
+				"<dd>www.example.com</dd>",
+				"1 May 2024",
+				"<dd>42</dd>",
+				`<a href="http://example.com/docs1" role="button">Continue</a>`,
+			},
+			notContains: []string{"<b>"},
+		},
+		{
+			name:           "Protected Destination Is Hidden",
+			target:         "/secret1+",
+			expectedStatus: http.StatusOK,
+			contains:       []string{"Hidden until the password is entered"},
+			notContains:    []string{"/internal"},
+		},
+		{
+			name:           "Click-Limited Destination Is Hidden",
+			target:         "/once1+",
+			expectedStatus: http.StatusOK,
+			contains:       []string{"Hidden until the link is followed"},
+			notContains:    []string{"token123"},
+		},
+		{name: "Non-Existent Link", target: "/nope1+", expectedStatus: http.StatusNotFound},
+		{name: "Expired Link", target: "/expired1+", expectedStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			for _, text := range tt.contains {
+				assert.Contains(t, w.Body.String(), text)
+			}
+			for _, text := range tt.notContains {
+				assert.NotContains(t, w.Body.String(), text)
+			}
+		})
+	}
+
+	// Test case: Previews are not counted as visits
+	urlModel, _ := store.GetURL("docs1")
+	assert.Equal(t, 42, urlModel.AccessCount)
+
+	// Test case: The short code without + still redirects
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs1", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+}
@@ -1,17 +1,32 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/Codedude1/shorty/analytics"
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
 	"github.com/Codedude1/shorty/storage"
 	"github.com/Codedude1/shorty/utils"
 	"github.com/gin-gonic/gin"
 )
 
-func RedirectHandler(store *storage.Storage) gin.HandlerFunc {
+// permanentRedirectMaxAge bounds how long clients may cache a permanent redirect.
+// Clicks served from a cache are not counted, and retargeting or disabling the
+// link only reaches those clients once the cached redirect expires.
+const permanentRedirectMaxAge = 24 * time.Hour
+
+func RedirectHandler(store storage.Store, opts ...Option) gin.HandlerFunc {
+	cfg := newConfig(opts)
 	return func(c *gin.Context) {
-		shortCode := c.Param("shortCode")
+		// A trailing + asks for the preview page instead of the redirect
+		shortCode, preview := strings.CutSuffix(c.Param("shortCode"), previewSuffix)
 
 		// Retrieve URL from storage using encapsulated method
 		urlModel, exists := store.GetURL(shortCode)
@@ -22,17 +37,188 @@ func RedirectHandler(store *storage.Storage) gin.HandlerFunc {
 		}
 
 		// Check for expiration
-		if !urlModel.ExpiresAt.IsZero() && time.Now().After(urlModel.ExpiresAt) {
+		if isExpired(urlModel) {
 			// Remove expired URL from storage
-			store.DeleteURL(shortCode)
+			if err := store.DeleteURL(shortCode); err != nil {
+				log.Printf("[ERROR] Failed to delete expired short code %s: %v", shortCode, err)
+			}
 			utils.RespondWithError(c, http.StatusGone, "Short URL has expired")
 			return
 		}
 
-		// Increment access count using encapsulated method
-		store.IncrementAccessCount(shortCode)
+		// Disabled links keep their data but stop redirecting
+		if urlModel.Disabled {
+			utils.RespondWithError(c, http.StatusNotFound, "Short URL is disabled")
+			return
+		}
+
+		// Scheduled links do not resolve before their activation time
+		if isPending(urlModel) {
+			c.Header("Cache-Control", "no-store")
+			if cfg.pendingURL != "" {
+				c.Redirect(http.StatusFound, cfg.pendingURL)
+				return
+			}
+			utils.RespondWithError(c, cfg.pendingStatus, "Short URL is not yet available")
+			return
+		}
 
-		// Redirect to the original long URL
-		c.Redirect(http.StatusFound, urlModel.LongURL)
+		// Links to destinations blocked since they were created stop resolving
+		if cfg.domains != nil && !cfg.domains.Allowed(urlModel.LongURL) {
+			log.Printf("[WARN] Refused redirect of %s to blocked destination %s", shortCode, urlModel.LongURL)
+			utils.RespondWithError(c, http.StatusForbidden, "Destination is not allowed")
+			return
+		}
+
+		if preview {
+			renderPreview(c, urlModel)
+			return
+		}
+
+		// Protected links only redirect once the password is supplied; visitors
+		// continuing past the interstitial supplied it before it was shown
+		rawQuery := c.Request.URL.RawQuery
+		confirmed := continued(c, cfg, shortCode)
+		if confirmed {
+			rawQuery = services.RemoveQueryParam(rawQuery, continueParam)
+		}
+		var submitted bool
+		if urlModel.PasswordHash != "" {
+			if confirmed {
+				c.Header("Cache-Control", "no-store")
+			} else if !authorizeLink(c, cfg, urlModel) {
+				return
+			}
+			rawQuery = stripPassword(rawQuery)
+			submitted = submittedPrompt(c)
+		}
+
+		// Path segments after the short code only reach links that forward them
+		suffix := strings.TrimPrefix(c.Request.URL.EscapedPath(), "/"+shortCode)
+		if !urlModel.ForwardPath {
+			if suffix != "" && suffix != "/" {
+				utils.RespondWithError(c, http.StatusNotFound, "Short URL not found")
+				return
+			}
+			suffix = ""
+		}
+		// Campaign tags are part of the link's destination, so passthrough sees them as such
+		destination, err := services.TaggedURL(urlModel.LongURL, urlModel.Tags)
+		if err == nil {
+			destination, err = services.Destination(destination, suffix, rawQuery, urlModel.QueryMode)
+		}
+		if errors.Is(err, services.ErrInvalidPath) {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid path")
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] Failed to build destination for %s: %v", shortCode, err)
+			utils.RespondWithError(c, http.StatusInternalServerError, "Failed to build destination URL")
+			return
+		}
+		// Forwarded paths may lead somewhere the link itself does not
+		if cfg.domains != nil && destination != urlModel.LongURL && !cfg.domains.Allowed(destination) {
+			log.Printf("[WARN] Refused redirect of %s to blocked destination %s", shortCode, destination)
+			utils.RespondWithError(c, http.StatusForbidden, "Destination is not allowed")
+			return
+		}
+
+		// Crawlers, link unfurlers and prefetches are counted apart from real visits.
+		// They use up no clicks of click-limited links unless configured to, and
+		// so are not shown where those links lead.
+		bot := cfg.bots != nil && cfg.bots.IsBot(c.Request)
+		if bot && urlModel.MaxClicks > 0 && cfg.botClickLimits {
+			bot = false
+		}
+		withheld := bot && urlModel.MaxClicks > 0
+
+		// Flagged links and destinations outside the allowlist get a warning first;
+		// the visit is counted once the visitor continues past it
+		if cfg.warnings != nil && !confirmed && !withheld {
+			if parsed, err := url.Parse(destination); err == nil {
+				if reason := cfg.warnings.Warning(parsed, urlModel.Flagged); reason != "" {
+					if urlModel.MaxClicks > 0 && urlModel.AccessCount >= urlModel.MaxClicks {
+						utils.RespondWithError(c, http.StatusGone, "Short URL has reached its click limit")
+						return
+					}
+					renderInterstitial(c, cfg, urlModel, parsed, rawQuery, reason)
+					return
+				}
+			}
+		}
+
+		if bot {
+			if urlModel.MaxClicks > 0 && urlModel.AccessCount >= urlModel.MaxClicks {
+				utils.RespondWithError(c, http.StatusGone, "Short URL has reached its click limit")
+				return
+			}
+			if err := store.IncrementBotCount(shortCode); err != nil {
+				log.Printf("[ERROR] Failed to increment bot count for %s: %v", shortCode, err)
+			}
+		} else {
+			// The store checks the click limit and counts the visit atomically
+			if err := store.IncrementAccessCount(shortCode); err != nil {
+				if errors.Is(err, storage.ErrClickLimitReached) {
+					utils.RespondWithError(c, http.StatusGone, "Short URL has reached its click limit")
+					return
+				}
+				log.Printf("[ERROR] Failed to increment access count for %s: %v", shortCode, err)
+			}
+		}
+
+		// Queue the click event; the recorder never blocks the redirect
+		if cfg.clicks != nil {
+			event := models.ClickEvent{
+				ShortCode:      shortCode,
+				AccessedAt:     time.Now(),
+				Referrer:       c.Request.Referer(),
+				UserAgent:      c.Request.UserAgent(),
+				IPAddress:      c.ClientIP(),
+				AcceptLanguage: c.GetHeader("Accept-Language"),
+				Bot:            bot,
+			}
+			if cfg.visitorKey != nil {
+				event.VisitorID = analytics.VisitorID(cfg.visitorKey, event.IPAddress, event.UserAgent)
+			}
+			if cfg.geoIP != nil {
+				event.Country = cfg.geoIP.Country(event.IPAddress)
+			}
+			cfg.clicks.Record(event)
+		}
+
+		if withheld {
+			c.Header("Cache-Control", "no-store")
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		// Redirect to the destination with the link's status, or the server default
+		code := urlModel.RedirectCode
+		if code == 0 {
+			code = cfg.redirectCode
+		}
+		// Submitted password prompts are followed with a GET, so the password is not resent;
+		// other POSTs keep the link's status, so 307 and 308 links pass them on
+		if submitted {
+			code = http.StatusSeeOther
+		}
+		c.Header("Cache-Control", redirectCacheControl(code, urlModel))
+		c.Redirect(code, destination)
+	}
+}
+
+// redirectCacheControl returns the Cache-Control header for a redirect of
+// urlModel with code. Permanent redirects may be cached for
+// permanentRedirectMaxAge, but not past the link's expiry; temporary ones and
+// those of click-limited or password-protected links are never cached, so
+// every click reaches the server and is counted or checked.
+func redirectCacheControl(code int, urlModel *models.URL) string {
+	if !services.IsPermanentRedirect(code) || urlModel.MaxClicks > 0 || urlModel.PasswordHash != "" {
+		return "no-store"
+	}
+	maxAge := permanentRedirectMaxAge
+	if !urlModel.ExpiresAt.IsZero() {
+		maxAge = min(maxAge, time.Until(urlModel.ExpiresAt))
 	}
+	return fmt.Sprintf("public, max-age=%d", max(int(maxAge.Seconds()), 0))
 }
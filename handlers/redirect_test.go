@@ -2,14 +2,21 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/Codedude1/shorty/analytics"
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
 	"github.com/Codedude1/shorty/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/gin-gonic/gin"
 )
@@ -198,3 +205,592 @@ func TestRedirectHandler_ExpiredURLCleanup(t *testing.T) {
 	_, exists = store.GetURL(expiredShortCode)
 	assert.False(t, exists, "Expired short code should be removed from storage")
 }
+
+// clickSink collects the click events written by a recorder.
+type clickSink struct {
+	events []models.ClickEvent
+}
+
+func (s *clickSink) WriteClicks(events []models.ClickEvent) error {
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func TestRedirectHandler_RecordsClicks(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com", "click1", time.Time{})
+
+	// Route redirects through a recorder with an in-memory sink
+	sink := &clickSink{}
+	recorder := analytics.NewRecorder(10, sink)
+	router := gin.Default()
+	router.GET("/:shortCode", RedirectHandler(store, WithClickRecorder(recorder)))
+
+	req, err := http.NewRequest(http.MethodGet, "/click1", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Referer", "https://news.example.com/post")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64)")
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	req.RemoteAddr = "203.0.113.7:52100"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// Missing codes do not produce click events
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Closing the recorder flushes the queued event
+	assert.NoError(t, recorder.Close())
+	if assert.Len(t, sink.events, 1) {
+		event := sink.events[0]
+		assert.Equal(t, "click1", event.ShortCode)
+		assert.Equal(t, "https://news.example.com/post", event.Referrer)
+		assert.Equal(t, "Mozilla/5.0 (X11; Linux x86_64)", event.UserAgent)
+		assert.Equal(t, "de-DE,de;q=0.9", event.AcceptLanguage)
+		assert.Equal(t, "203.0.113.7", event.IPAddress)
+		assert.WithinDuration(t, time.Now(), event.AccessedAt, time.Minute)
+	}
+}
+
+func TestRedirectHandler_Bots(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	const browser = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+	tests := []struct {
+		name       string
+		method     string
+		userAgent  string
+		header     map[string]string
+		opts       []Option
+		wantAccess int
+		wantBots   int
+	}{
+		{name: "Browser", method: http.MethodGet, userAgent: browser, wantAccess: 1},
+		{name: "Link unfurler", method: http.MethodGet, userAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", wantBots: 1},
+		{name: "HEAD request", method: http.MethodHead, userAgent: browser, wantBots: 1},
+		{name: "Prefetch", method: http.MethodGet, userAgent: browser, header: map[string]string{"Sec-Purpose": "prefetch"}, wantBots: 1},
+		{
+			name:      "Custom rules",
+			method:    http.MethodGet,
+			userAgent: "AcmeMonitor/1.0",
+			opts:      []Option{WithBotFilter(analytics.NewBotFilter([]string{"acmemonitor"}))},
+			wantBots:  1,
+		},
+		{
+			name:       "Filtering disabled",
+			method:     http.MethodGet,
+			userAgent:  "Slackbot-LinkExpanding 1.0",
+			opts:       []Option{WithBotFilter(nil)},
+			wantAccess: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewStorage()
+			store.AddURL("https://www.example.com", "bot1", time.Time{})
+			sink := &clickSink{}
+			recorder := analytics.NewRecorder(10, sink)
+
+			router := gin.Default()
+			handler := RedirectHandler(store, append(tt.opts, WithClickRecorder(recorder))...)
+			router.GET("/:shortCode", handler)
+			router.HEAD("/:shortCode", handler)
+
+			req := httptest.NewRequest(tt.method, "/bot1", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Bots are still redirected
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, "https://www.example.com", w.Header().Get("Location"))
+
+			urlModel, _ := store.GetURL("bot1")
+			assert.Equal(t, tt.wantAccess, urlModel.AccessCount)
+			assert.Equal(t, tt.wantBots, urlModel.BotCount)
+
+			// The click event is flagged so rollups can skip it
+			assert.NoError(t, recorder.Close())
+			if assert.Len(t, sink.events, 1) {
+				assert.Equal(t, tt.wantBots == 1, sink.events[0].Bot)
+			}
+		})
+	}
+}
+
+func TestRedirectHandler_RedirectCode(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	for _, link := range []struct {
+		code      string
+		status    int
+		expiresAt time.Time
+	}{
+		{code: "default1", status: 0},
+		{code: "moved1", status: http.StatusMovedPermanently},
+		{code: "perm1", status: http.StatusPermanentRedirect},
+		{code: "temp1", status: http.StatusTemporaryRedirect},
+		{code: "soon1", status: http.StatusMovedPermanently, expiresAt: time.Now().Add(10 * time.Minute)},
+	} {
+		urlModel := &models.URL{
+			BaseURL:      models.BaseURL{LongURL: "https://www.example.com/" + link.code, CreatedAt: time.Now(), ExpiresAt: link.expiresAt},
+			ShortCode:    link.code,
+			Alias:        true,
+			RedirectCode: link.status,
+		}
+		_, _, err := store.CreateURL(urlModel)
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name           string
+		shortCode      string
+		opts           []Option
+		expectedStatus int
+		expectedCache  string
+	}{
+		{name: "Built-in Default", shortCode: "default1", expectedStatus: http.StatusFound, expectedCache: "no-store"},
+		{
+			name:           "Server Default",
+			shortCode:      "default1",
+			opts:           []Option{WithRedirectCode(http.StatusMovedPermanently)},
+			expectedStatus: http.StatusMovedPermanently,
+			expectedCache:  "public, max-age=86400",
+		},
+		{name: "Moved Permanently", shortCode: "moved1", expectedStatus: http.StatusMovedPermanently, expectedCache: "public, max-age=86400"},
+		{name: "Permanent Redirect", shortCode: "perm1", expectedStatus: http.StatusPermanentRedirect, expectedCache: "public, max-age=86400"},
+		{
+			name:           "Link Overrides Server Default",
+			shortCode:      "temp1",
+			opts:           []Option{WithRedirectCode(http.StatusMovedPermanently)},
+			expectedStatus: http.StatusTemporaryRedirect,
+			expectedCache:  "no-store",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.Default()
+			router.GET("/:shortCode", RedirectHandler(store, tt.opts...))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tt.shortCode, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, "https://www.example.com/"+tt.shortCode, w.Header().Get("Location"))
+			assert.Equal(t, tt.expectedCache, w.Header().Get("Cache-Control"))
+		})
+	}
+
+	// Test case: Permanent redirects are not cached past the link's expiry
+	router := gin.Default()
+	router.GET("/:shortCode", RedirectHandler(store))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/soon1", nil))
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	var maxAge int
+	_, err := fmt.Sscanf(w.Header().Get("Cache-Control"), "public, max-age=%d", &maxAge)
+	assert.NoError(t, err)
+	assert.InDelta(t, 600, maxAge, 5)
+}
+
+func TestRedirectHandler_Passthrough(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	for _, link := range []struct {
+		code        string
+		longURL     string
+		queryMode   string
+		forwardPath bool
+		tags        map[string]string
+	}{
+		{code: "plain1", longURL: "https://www.example.com/landing?ref=short"},
+		{code: "merge1", longURL: "https://www.example.com/landing?ref=short", queryMode: services.QueryModeMerge},
+		{code: "over1", longURL: "https://www.example.com/landing?ref=short", queryMode: services.QueryModeOverride},
+		{code: "docs1", longURL: "https://docs.example.com/v2/", forwardPath: true},
+		{code: "both1", longURL: "https://docs.example.com/v2?lang=en", queryMode: services.QueryModeMerge, forwardPath: true},
+		{code: "tagged1", longURL: "https://www.example.com/landing?utm_source=site", tags: map[string]string{"utm_source": "mail", "utm_campaign": "spring"}},
+		{
+			code:      "tagmerge1",
+			longURL:   "https://www.example.com/landing",
+			queryMode: services.QueryModeMerge,
+			tags:      map[string]string{"utm_source": "mail"},
+		},
+	} {
+		urlModel := &models.URL{
+			BaseURL:     models.BaseURL{LongURL: link.longURL, CreatedAt: time.Now()},
+			ShortCode:   link.code,
+			Alias:       true,
+			QueryMode:   link.queryMode,
+			ForwardPath: link.forwardPath,
+			Tags:        link.tags,
+		}
+		_, _, err := store.CreateURL(urlModel)
+		assert.NoError(t, err)
+	}
+
+	router := gin.Default()
+	router.GET("/:shortCode", RedirectHandler(store))
+	router.GET("/:shortCode/*path", RedirectHandler(store))
+
+	tests := []struct {
+		name             string
+		target           string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{name: "Query Dropped", target: "/plain1?utm_source=mail", expectedStatus: http.StatusFound, expectedLocation: "https://www.example.com/landing?ref=short"},
+		{
+			name:             "Query Merged",
+			target:           "/merge1?utm_source=mail&ref=campaign",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.com/landing?ref=short&utm_source=mail",
+		},
+		{
+			name:             "Query Overrides",
+			target:           "/over1?utm_source=mail&ref=campaign",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.com/landing?utm_source=mail&ref=campaign",
+		},
+		{name: "Path Forwarded", target: "/docs1/guide/install", expectedStatus: http.StatusFound, expectedLocation: "https://docs.example.com/v2/guide/install"},
+		{name: "Dot Segments Removed", target: "/docs1/guide/../../../etc", expectedStatus: http.StatusFound, expectedLocation: "https://docs.example.com/v2/etc"},
+		{name: "Escaped Dot Segments Removed", target: "/docs1/%2e%2e/admin", expectedStatus: http.StatusFound, expectedLocation: "https://docs.example.com/v2/admin"},
+		{name: "Hidden Dot Segment", target: "/docs1/..%2Fadmin", expectedStatus: http.StatusBadRequest},
+		{
+			name:             "Path and Query",
+			target:           "/both1/api%2Fref?lang=de&page=2",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://docs.example.com/v2/api%2Fref?lang=en&page=2",
+		},
+		{name: "Trailing Slash Without Forwarding", target: "/plain1/", expectedStatus: http.StatusFound, expectedLocation: "https://www.example.com/landing?ref=short"},
+		{name: "Path Without Forwarding", target: "/plain1/extra", expectedStatus: http.StatusNotFound},
+		{
+			name:             "Tags Appended",
+			target:           "/tagged1",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.com/landing?utm_campaign=spring&utm_source=mail",
+		},
+		{
+			name:             "Tags Win Over Merged Query",
+			target:           "/tagmerge1?utm_source=forward&page=2",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.com/landing?utm_source=mail&page=2",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedLocation != "" {
+				assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestRedirectHandler_ClickLimit(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	const browser = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	const unfurler = "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"
+
+	// Define test cases; each sends its requests in order to a fresh link
+	tests := []struct {
+		name         string
+		maxClicks    int
+		opts         []Option
+		userAgents   []string
+		wantStatuses []int
+		wantAccess   int
+		wantBots     int
+	}{
+		{
+			name:         "One-Time Link",
+			maxClicks:    1,
+			userAgents:   []string{browser, browser},
+			wantStatuses: []int{http.StatusMovedPermanently, http.StatusGone},
+			wantAccess:   1,
+		},
+		{
+			name:         "Bots Do Not Use Up Clicks",
+			maxClicks:    1,
+			userAgents:   []string{unfurler, browser, unfurler},
+			wantStatuses: []int{http.StatusNoContent, http.StatusMovedPermanently, http.StatusGone},
+			wantAccess:   1,
+			wantBots:     1,
+		},
+		{
+			name:         "Bots Use Up Clicks When Configured",
+			maxClicks:    1,
+			opts:         []Option{WithBotClickLimits(true)},
+			userAgents:   []string{unfurler, browser},
+			wantStatuses: []int{http.StatusMovedPermanently, http.StatusGone},
+			wantAccess:   1,
+		},
+		{
+			name:         "Several Clicks",
+			maxClicks:    3,
+			userAgents:   []string{browser, browser, browser, browser},
+			wantStatuses: []int{http.StatusMovedPermanently, http.StatusMovedPermanently, http.StatusMovedPermanently, http.StatusGone},
+			wantAccess:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewStorage()
+			urlModel := &models.URL{
+				BaseURL:      models.BaseURL{LongURL: "https://www.example.com/secret", CreatedAt: time.Now()},
+				ShortCode:    "limit1",
+				Alias:        true,
+				RedirectCode: http.StatusMovedPermanently,
+				MaxClicks:    tt.maxClicks,
+			}
+			_, _, err := store.CreateURL(urlModel)
+			assert.NoError(t, err)
+
+			router := gin.Default()
+			router.GET("/:shortCode", RedirectHandler(store, tt.opts...))
+
+			for i, userAgent := range tt.userAgents {
+				req := httptest.NewRequest(http.MethodGet, "/limit1", nil)
+				req.Header.Set("User-Agent", userAgent)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.wantStatuses[i], w.Code, "Request %d", i+1)
+				if w.Code != http.StatusMovedPermanently {
+					assert.Empty(t, w.Header().Get("Location"), "Request %d", i+1)
+				}
+				if w.Code == http.StatusGone {
+					var response map[string]string
+					assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+					assert.Equal(t, "Short URL has reached its click limit", response["error"])
+				} else {
+					// Cached redirects would bypass the limit
+					assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+				}
+			}
+
+			stored, exists := store.GetURL("limit1")
+			assert.True(t, exists, "Used up links keep their stats")
+			assert.Equal(t, tt.wantAccess, stored.AccessCount)
+			assert.Equal(t, tt.wantBots, stored.BotCount)
+		})
+	}
+}
+
+func TestRedirectHandler_ClickLimitBots(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	urlModel := &models.URL{
+		BaseURL:   models.BaseURL{LongURL: "https://secret.example.com/token123", CreatedAt: time.Now()},
+		ShortCode: "once1",
+		Alias:     true,
+		MaxClicks: 1,
+	}
+	_, _, err := store.CreateURL(urlModel)
+	assert.NoError(t, err)
+
+	router := gin.Default()
+	router.GET("/:shortCode", RedirectHandler(store, WithInterstitial(services.NewAllowlistPolicy([]string{"example.org"}), 0)))
+	router.HEAD("/:shortCode", RedirectHandler(store))
+
+	// Test case: HEAD requests and bots never see the destination of a one-time link
+	requests := []struct {
+		method    string
+		userAgent string
+	}{
+		{method: http.MethodHead},
+		{method: http.MethodHead},
+		{method: http.MethodHead},
+		{method: http.MethodGet, userAgent: "Slackbot-LinkExpanding 1.0"},
+	}
+	for _, request := range requests {
+		req := httptest.NewRequest(request.method, "/once1", nil)
+		req.Header.Set("User-Agent", request.userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.NotContains(t, w.Body.String(), "token123")
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	}
+
+	// Test case: The one real click is still available
+	stored, _ := store.GetURL("once1")
+	assert.Equal(t, 0, stored.AccessCount)
+	assert.Equal(t, len(requests), stored.BotCount)
+
+	// Test case: API clients are not bots, so they use up the click and get the destination
+	apiRouter := gin.Default()
+	apiRouter.GET("/:shortCode", RedirectHandler(store))
+	req := httptest.NewRequest(http.MethodGet, "/once1", nil)
+	req.Header.Set("User-Agent", "Go-http-client/1.1")
+	w := httptest.NewRecorder()
+	apiRouter.ServeHTTP(w, req)
+	assert.Equal(t, "https://secret.example.com/token123", w.Header().Get("Location"))
+	stored, _ = store.GetURL("once1")
+	assert.Equal(t, 1, stored.AccessCount)
+	assert.Equal(t, len(requests), stored.BotCount)
+}
+
+func TestRedirectHandler_Scheduled(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	for _, link := range []struct {
+		code        string
+		activatesAt time.Time
+	}{
+		{code: "launch1", activatesAt: time.Now().Add(time.Hour)},
+		{code: "live1", activatesAt: time.Now().Add(-time.Minute)},
+	} {
+		urlModel := &models.URL{
+			BaseURL:     models.BaseURL{LongURL: "https://www.example.com/launch", CreatedAt: time.Now()},
+			ShortCode:   link.code,
+			Alias:       true,
+			ActivatesAt: link.activatesAt,
+		}
+		_, _, err := store.CreateURL(urlModel)
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name             string
+		shortCode        string
+		opts             []Option
+		expectedStatus   int
+		expectedLocation string
+		expectedError    string
+	}{
+		{name: "Not Yet Available", shortCode: "launch1", expectedStatus: http.StatusNotFound, expectedError: "Short URL is not yet available"},
+		{
+			name:           "Configured Status",
+			shortCode:      "launch1",
+			opts:           []Option{WithNotYetAvailable(http.StatusServiceUnavailable, "")},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedError:  "Short URL is not yet available",
+		},
+		{
+			name:             "Coming Soon Page",
+			shortCode:        "launch1",
+			opts:             []Option{WithNotYetAvailable(http.StatusNotFound, "https://www.example.com/soon")},
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://www.example.com/soon",
+		},
+		{name: "Activated", shortCode: "live1", expectedStatus: http.StatusFound, expectedLocation: "https://www.example.com/launch"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.Default()
+			router.GET("/:shortCode", RedirectHandler(store, tt.opts...))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tt.shortCode, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			if tt.expectedError != "" {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedError, response["error"])
+			}
+		})
+	}
+
+	// Test case: Requests before activation are not counted
+	urlModel, _ := store.GetURL("launch1")
+	assert.Equal(t, 0, urlModel.AccessCount)
+}
+
+// newDomainPolicy loads rules into a domain policy backed by a temporary file,
+// returned for rewriting.
+func newDomainPolicy(t *testing.T, rules string) (*services.DomainPolicy, string) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(path, []byte(rules), 0o644))
+	policy, err := services.LoadDomainPolicy(path)
+	require.NoError(t, err)
+	return policy, path
+}
+
+func TestRedirectHandler_DomainPolicy(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	store.AddURL("https://www.phish.example/login", "phish1", time.Time{})
+	_, _, err := store.CreateURL(&models.URL{
+		BaseURL:     models.BaseURL{LongURL: "https://www.example.com/files"},
+		ShortCode:   "files1",
+		Alias:       true,
+		ForwardPath: true,
+	})
+	require.NoError(t, err)
+	policy, path := newDomainPolicy(t, "deny www.example.com ^/files/private\n")
+	router := gin.Default()
+	router.GET("/:shortCode", RedirectHandler(store, WithDomainPolicy(policy)))
+	router.GET("/:shortCode/*path", RedirectHandler(store, WithDomainPolicy(policy)))
+
+	tests := []struct {
+		name           string
+		target         string
+		expectedStatus int
+	}{
+		{name: "Allowed Destination", target: "/phish1", expectedStatus: http.StatusFound},
+		{name: "Allowed Forwarded Path", target: "/files1/public/a.pdf", expectedStatus: http.StatusFound},
+		{name: "Blocked Forwarded Path", target: "/files1/private/a.pdf", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	// Test case: Links stop resolving once their destination is blocked
+	require.NoError(t, os.WriteFile(path, []byte("deny *.phish.example\n"), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	_, err = policy.Reload()
+	require.NoError(t, err)
+	for _, target := range []string{"/phish1", "/phish1+"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusForbidden, w.Code, target)
+		var response map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Destination is not allowed", response["error"])
+	}
+	urlModel, _ := store.GetURL("phish1")
+	assert.Equal(t, 1, urlModel.AccessCount, "Refused redirects should not be counted")
+}
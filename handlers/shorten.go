@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/Codedude1/shorty/models"
@@ -12,7 +15,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func ShortenURLHandler(store *storage.Storage) gin.HandlerFunc {
+func ShortenURLHandler(store storage.Store, opts ...Option) gin.HandlerFunc {
+	cfg := newConfig(opts)
 	return func(c *gin.Context) {
 		var request models.ShortenRequest
 
@@ -28,52 +32,161 @@ func ShortenURLHandler(store *storage.Storage) gin.HandlerFunc {
 			return
 		}
 
-		// Check if the long URL already exists using encapsulated method
-		if existingShortCode, exists := store.GetShortCode(request.URL); exists {
-			shortURL := constructShortURL(c, existingShortCode)
-			response := gin.H{"short_url": shortURL}
-			utils.RespondWithJSON(c, http.StatusOK, response)
+		// Store internationalized hosts in their punycode form
+		normalized, err := services.NormalizeURL(request.URL)
+		if err != nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid URL")
 			return
 		}
+		request.URL = normalized
 
-		// Hash the long URL
-		hash := services.HashString(request.URL)
-
-		// Generate the short code
-		shortCode, err := services.EncodeHash(hash, 6) // Adjust length as desired
-		if err != nil {
-			utils.RespondWithError(c, http.StatusInternalServerError, "Error generating short code")
+		// Check the destination against the domain policy
+		if cfg.domains != nil && !cfg.domains.Allowed(request.URL) {
+			utils.RespondWithError(c, http.StatusForbidden, "Destination is not allowed")
 			return
 		}
+		flagged, ok := guardDestination(c, cfg, request.URL)
+		if !ok {
+			return
+		}
+		suspicious, ok := checkHomographs(c, cfg, request.URL)
+		if !ok {
+			return
+		}
+		flagged = flagged || suspicious
 
-		// Handle potential collisions by appending a counter
-		counter := 1
-		originalURL := request.URL // Keep the original URL unchanged
-		for {
-			// Check if the short code already exists
-			if _, exists := store.GetURL(shortCode); !exists {
-				break // Unique short code found
+		// Validate the custom alias if one was requested
+		if request.Alias != "" {
+			if err := services.ValidateAlias(request.Alias, cfg.reservedAliases); err != nil {
+				if errors.Is(err, services.ErrReservedAlias) {
+					utils.RespondWithError(c, http.StatusBadRequest, "Alias is reserved")
+					return
+				}
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid alias")
+				return
 			}
+		}
 
-			// Collision detected, generate a new hash with a counter
-			newHashInput := fmt.Sprintf("%s%d", originalURL, counter)
-			hash = services.HashString(newHashInput)
-			shortCode, err = services.EncodeHash(hash, 6)
-			if err != nil {
-				utils.RespondWithError(c, http.StatusInternalServerError, "Error generating short code")
+		// Validate the redirect status if one was requested; 0 uses the server default
+		if request.RedirectCode != 0 && !services.IsValidRedirectCode(request.RedirectCode) {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid redirect code")
+			return
+		}
+
+		// Validate how the link passes on incoming query strings
+		queryMode, err := services.ParseQueryMode(request.QueryMode)
+		if err != nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid query mode")
+			return
+		}
+
+		// One-time links are links limited to a single click
+		maxClicks := request.MaxClicks
+		if request.OneTime {
+			if maxClicks > 1 {
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid click limit")
 				return
 			}
-			counter++
+			maxClicks = 1
+		}
+		if maxClicks < 0 {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid click limit")
+			return
+		}
+
+		// Collect the campaign tags appended to the destination on redirect
+		tags, err := services.CampaignTags(request.UTMSource, request.UTMMedium, request.UTMCampaign, request.Params)
+		if err != nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid tags")
+			return
+		}
+
+		// Protected links store only a slow salted hash of their password
+		if len(request.Password) > services.MaxPasswordLength {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid password")
+			return
 		}
 
-		// Set expiration time if provided
-		var expiresAt time.Time
+		// Scheduled links do not resolve before their activation time
+		activatesAt, err := parseTimestamp(request.ActivatesAt)
+		if err != nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid activation time")
+			return
+		}
+
+		// Set expiration time if provided, as an absolute time or a TTL
+		expiresAt, err := parseTimestamp(request.ExpiresAt)
+		if err != nil || (!expiresAt.IsZero() && (request.ExpiryInMins > 0 || !expiresAt.After(time.Now()))) {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid expiry")
+			return
+		}
 		if request.ExpiryInMins > 0 {
 			expiresAt = time.Now().Add(time.Duration(request.ExpiryInMins) * time.Minute)
 		}
+		if !validWindow(activatesAt, expiresAt) {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid activation window")
+			return
+		}
 
-		// Store the mapping in the storage using encapsulated method
-		store.AddURL(request.URL, shortCode, expiresAt)
+		var passwordHash string
+		if request.Password != "" {
+			if passwordHash, err = services.HashPassword(request.Password); err != nil {
+				log.Printf("[ERROR] Failed to hash password for %s: %v", request.URL, err)
+				utils.RespondWithError(c, http.StatusInternalServerError, "Error storing short URL")
+				return
+			}
+		}
+
+		urlModel := &models.URL{
+			BaseURL: models.BaseURL{
+				LongURL:   request.URL,
+				CreatedAt: time.Now(),
+				ExpiresAt: expiresAt,
+			},
+			ActivatesAt:  activatesAt,
+			Flagged:      flagged,
+			RedirectCode: request.RedirectCode,
+			QueryMode:    queryMode,
+			ForwardPath:  request.ForwardPath,
+			MaxClicks:    maxClicks,
+			PasswordHash: passwordHash,
+			Tags:         tags,
+		}
+
+		var shortCode string
+		if request.Alias != "" {
+			// Store the alias exactly as requested; it is never deduplicated
+			urlModel.ShortCode = request.Alias
+			urlModel.Alias = true
+			if _, _, err := store.CreateURL(urlModel); err != nil {
+				if errors.Is(err, storage.ErrShortCodeExists) {
+					utils.RespondWithError(c, http.StatusConflict, "Alias is already in use")
+					return
+				}
+				log.Printf("[ERROR] Failed to store alias %s: %v", request.Alias, err)
+				utils.RespondWithError(c, http.StatusInternalServerError, "Error storing short URL")
+				return
+			}
+			shortCode = request.Alias
+		} else {
+			// Check if the long URL is already shortened with the same tags; click-limited,
+			// scheduled, expiring and protected links, and those with their own redirect
+			// status or passthrough options, always get a fresh short code
+			if existingShortCode, exists := store.GetShortCode(request.URL, tags); exists && maxClicks == 0 && activatesAt.IsZero() &&
+				expiresAt.IsZero() && passwordHash == "" && request.RedirectCode == 0 && queryMode == "" && !request.ForwardPath {
+				shortURL := constructShortURL(c, existingShortCode)
+				response := gin.H{"short_url": shortURL}
+				utils.RespondWithJSON(c, http.StatusOK, response)
+				return
+			}
+
+			shortCode, err = storeGeneratedURL(store, urlModel)
+			if err != nil {
+				log.Printf("[ERROR] Failed to store short URL for %s: %v", request.URL, err)
+				utils.RespondWithError(c, http.StatusInternalServerError, "Error storing short URL")
+				return
+			}
+		}
 
 		// Construct the short URL with scheme
 		shortURL := constructShortURL(c, shortCode)
@@ -88,6 +201,96 @@ func ShortenURLHandler(store *storage.Storage) gin.HandlerFunc {
 	}
 }
 
+// storeGeneratedURL derives a short code from the hash of the long URL and tags and
+// stores urlModel under it. The store returns the existing short code if another
+// request shortened the same long URL and tags in the meantime; code collisions are
+// retried with a counter.
+func storeGeneratedURL(store storage.Store, urlModel *models.URL) (string, error) {
+	// Hash the long URL together with its tags
+	key := services.DedupKey(urlModel.LongURL, urlModel.Tags)
+	hash := services.HashString(key)
+
+	// Generate the short code
+	shortCode, err := services.EncodeHash(hash, 6) // Adjust length as desired
+	if err != nil {
+		return "", err
+	}
+
+	counter := 1
+	for {
+		urlModel.ShortCode = shortCode
+		storedCode, _, err := store.CreateURL(urlModel)
+		if err == nil {
+			return storedCode, nil
+		}
+		if !errors.Is(err, storage.ErrShortCodeExists) {
+			return "", err
+		}
+
+		// Collision detected, generate a new hash with a counter
+		newHashInput := fmt.Sprintf("%s%d", key, counter)
+		hash = services.HashString(newHashInput)
+		shortCode, err = services.EncodeHash(hash, 6)
+		if err != nil {
+			return "", err
+		}
+		counter++
+	}
+}
+
+// guardDestination checks rawURL with the configured destination guard. It
+// responds with 400 Bad Request and returns false for refused destinations;
+// flagged reports that rawURL is only accepted as a flagged link.
+func guardDestination(c *gin.Context, cfg *config, rawURL string) (flagged bool, ok bool) {
+	if cfg.guard == nil {
+		return false, true
+	}
+	err := cfg.guard.Check(c.Request.Context(), rawURL, c.Request.Host)
+	switch {
+	case err == nil:
+		return false, true
+	case errors.Is(err, services.ErrInternalDestination) && cfg.flagInternal:
+		log.Printf("[WARN] Flagging link to internal destination %s", rawURL)
+		return true, true
+	case errors.Is(err, services.ErrInternalDestination):
+		utils.RespondWithError(c, http.StatusBadRequest, "Destination is in an internal network")
+	case errors.Is(err, services.ErrShortenerDestination):
+		utils.RespondWithError(c, http.StatusBadRequest, "Destination is a short link")
+	default:
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid URL")
+	}
+	return false, false
+}
+
+// checkHomographs checks the host of rawURL with the configured homograph
+// detector. It responds with 400 Bad Request and returns false for refused
+// destinations; flagged reports that rawURL is only accepted as a flagged link.
+func checkHomographs(c *gin.Context, cfg *config, rawURL string) (flagged bool, ok bool) {
+	if cfg.homographs == nil {
+		return false, true
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid URL")
+		return false, false
+	}
+	err = cfg.homographs.Check(parsed.Hostname())
+	switch {
+	case err == nil:
+		return false, true
+	case (errors.Is(err, services.ErrMixedScript) || errors.Is(err, services.ErrLookalikeHost)) && cfg.flagHomographs:
+		log.Printf("[WARN] Flagging link to suspicious host %s: %v", parsed.Hostname(), err)
+		return true, true
+	case errors.Is(err, services.ErrMixedScript):
+		utils.RespondWithError(c, http.StatusBadRequest, "Destination host mixes scripts")
+	case errors.Is(err, services.ErrLookalikeHost):
+		utils.RespondWithError(c, http.StatusBadRequest, "Destination host imitates a protected domain")
+	default:
+		utils.RespondWithError(c, http.StatusBadRequest, "Invalid URL")
+	}
+	return false, false
+}
+
 // constructShortURL constructs the full short URL based on the request context and short code.
 func constructShortURL(c *gin.Context, shortCode string) string {
 	// Determine the scheme based on TLS
@@ -9,8 +9,10 @@ import (
 	"time"
 
 	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
 	"github.com/Codedude1/shorty/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/gin-gonic/gin"
 )
@@ -213,3 +215,762 @@ func TestShortenURLHandler_DuplicateURL(t *testing.T) {
 	shortCode := parts[len(parts)-1]
 	assert.Equal(t, existingShortCode, shortCode, "Short code should match the existing one")
 }
+
+func TestShortenURLHandler_Alias(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	// Create a new storage instance with an already shortened URL
+	store := storage.NewStorage()
+	store.AddURL("https://www.taken.com", "taken-alias", time.Time{})
+
+	// Initialize the router with an extra reserved word
+	router := gin.Default()
+	router.POST("/shorten", ShortenURLHandler(store, WithReservedAliases([]string{"stats", "admin"})))
+
+	// Define test cases
+	tests := []struct {
+		name           string
+		requestBody    models.ShortenRequest
+		expectedStatus int
+		expectedError  string
+		expectedCode   string
+	}{
+		{
+			name:           "Valid Alias",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/spring", Alias: "spring-sale"},
+			expectedStatus: http.StatusOK,
+			expectedCode:   "spring-sale",
+		},
+		{
+			name:           "Alias Already Taken",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/other", Alias: "taken-alias"},
+			expectedStatus: http.StatusConflict,
+			expectedError:  "Alias is already in use",
+		},
+		{
+			name:           "Reserved Alias",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com", Alias: "Admin"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Alias is reserved",
+		},
+		{
+			name:           "Invalid Alias Characters",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com", Alias: "spring sale!"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid alias",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			// Marshal the request body to JSON
+			body, err := json.Marshal(tt.requestBody)
+			assert.NoError(t, err)
+
+			// Create a new HTTP request
+			req, err := http.NewRequest(http.MethodPost, "/shorten", strings.NewReader(string(body)))
+			assert.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			// Serve the HTTP request
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Assert the HTTP status code
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]string
+			err = json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			if tt.expectedError != "" {
+				assert.Equal(t, tt.expectedError, response["error"])
+				return
+			}
+			assert.True(t, strings.HasSuffix(response["short_url"], "/"+tt.expectedCode), "Short URL should end with the alias")
+
+			// The alias should be stored but not used for duplicate detection
+			urlModel, exists := store.GetURL(tt.expectedCode)
+			assert.True(t, exists, "Alias should exist in storage")
+			assert.True(t, urlModel.Alias, "Stored URL should be marked as an alias")
+			_, exists = store.GetShortCode(tt.requestBody.URL, nil)
+			assert.False(t, exists, "Alias should not be returned for duplicate submissions")
+		})
+	}
+}
+
+func TestShortenURLHandler_RedirectCode(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	router := gin.Default()
+	router.POST("/shorten", ShortenURLHandler(store))
+
+	tests := []struct {
+		name           string
+		requestBody    models.ShortenRequest
+		expectedStatus int
+		expectedError  string
+		expectedCode   int
+	}{
+		{
+			name:           "Permanent Redirect",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/docs", Alias: "docs", RedirectCode: http.StatusMovedPermanently},
+			expectedStatus: http.StatusOK,
+			expectedCode:   http.StatusMovedPermanently,
+		},
+		{
+			name:           "Server Default",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/blog", Alias: "blog"},
+			expectedStatus: http.StatusOK,
+			expectedCode:   0,
+		},
+		{
+			name:           "Unsupported Status",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/api", Alias: "api-v1", RedirectCode: http.StatusSeeOther},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid redirect code",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.requestBody)
+			assert.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedError, response["error"])
+				return
+			}
+			urlModel, exists := store.GetURL(tt.requestBody.Alias)
+			assert.True(t, exists, "Alias should exist in storage")
+			assert.Equal(t, tt.expectedCode, urlModel.RedirectCode)
+		})
+	}
+}
+
+// shortenLink posts request to /shorten on router and returns the stored link.
+func shortenLink(t *testing.T, router *gin.Engine, store storage.Store, request models.ShortenRequest) *models.URL {
+	body, err := json.Marshal(request)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	parts := strings.Split(response["short_url"], "/")
+	urlModel, exists := store.GetURL(parts[len(parts)-1])
+	require.True(t, exists, "Short code should exist in storage")
+	return urlModel
+}
+
+func TestShortenURLHandler_RedirectCodeDuplicate(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	router := gin.Default()
+	router.POST("/shorten", ShortenURLHandler(store))
+
+	const longURL = "https://www.example.com/moved"
+	plain := shortenLink(t, router, store, models.ShortenRequest{URL: longURL})
+
+	// Test case: A redirect status is not dropped for an already shortened URL
+	permanent := shortenLink(t, router, store, models.ShortenRequest{URL: longURL, RedirectCode: http.StatusMovedPermanently})
+	assert.NotEqual(t, plain.ShortCode, permanent.ShortCode)
+	assert.Equal(t, http.StatusMovedPermanently, permanent.RedirectCode)
+
+	// Test case: Duplicate submissions without one still get the default link
+	again := shortenLink(t, router, store, models.ShortenRequest{URL: longURL})
+	assert.Equal(t, plain.ShortCode, again.ShortCode)
+	assert.Zero(t, again.RedirectCode)
+}
+
+func TestShortenURLHandler_OptionsDuplicate(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	const longURL = "https://www.example.com/guide"
+	tests := []struct {
+		name    string
+		request models.ShortenRequest
+	}{
+		{name: "Query Mode", request: models.ShortenRequest{URL: longURL, QueryMode: "merge"}},
+		{name: "Forward Path", request: models.ShortenRequest{URL: longURL, ForwardPath: true}},
+		{name: "Expiry", request: models.ShortenRequest{URL: longURL, ExpiryInMins: 60}},
+		{name: "All Options", request: models.ShortenRequest{URL: longURL, QueryMode: "override", ForwardPath: true, ExpiryInMins: 60}},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewStorage()
+			router := gin.Default()
+			router.POST("/shorten", ShortenURLHandler(store))
+			plain := shortenLink(t, router, store, models.ShortenRequest{URL: longURL})
+
+			// Test case: Options are not dropped for an already shortened URL
+			urlModel := shortenLink(t, router, store, tt.request)
+			assert.NotEqual(t, plain.ShortCode, urlModel.ShortCode)
+			expectedQueryMode, err := services.ParseQueryMode(tt.request.QueryMode)
+			require.NoError(t, err)
+			assert.Equal(t, expectedQueryMode, urlModel.QueryMode)
+			assert.Equal(t, tt.request.ForwardPath, urlModel.ForwardPath)
+			assert.Equal(t, tt.request.ExpiryInMins > 0, !urlModel.ExpiresAt.IsZero())
+
+			// Test case: Duplicate submissions without options still get the plain link
+			again := shortenLink(t, router, store, models.ShortenRequest{URL: longURL})
+			assert.Equal(t, plain.ShortCode, again.ShortCode)
+		})
+	}
+}
+
+func TestShortenURLHandler_Passthrough(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	router := gin.Default()
+	router.POST("/shorten", ShortenURLHandler(store))
+
+	tests := []struct {
+		name                string
+		requestBody         models.ShortenRequest
+		expectedStatus      int
+		expectedError       string
+		expectedQueryMode   string
+		expectedForwardPath bool
+	}{
+		{
+			name:                "Merge and Forward Path",
+			requestBody:         models.ShortenRequest{URL: "https://www.example.com/docs", Alias: "docs", QueryMode: "merge", ForwardPath: true},
+			expectedStatus:      http.StatusOK,
+			expectedQueryMode:   services.QueryModeMerge,
+			expectedForwardPath: true,
+		},
+		{
+			name:              "Explicit None",
+			requestBody:       models.ShortenRequest{URL: "https://www.example.com/blog", Alias: "blog", QueryMode: "none"},
+			expectedStatus:    http.StatusOK,
+			expectedQueryMode: "",
+		},
+		{
+			name:           "Unknown Query Mode",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/api", Alias: "api-v1", QueryMode: "append"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid query mode",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.requestBody)
+			assert.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedError, response["error"])
+				return
+			}
+			urlModel, exists := store.GetURL(tt.requestBody.Alias)
+			assert.True(t, exists, "Alias should exist in storage")
+			assert.Equal(t, tt.expectedQueryMode, urlModel.QueryMode)
+			assert.Equal(t, tt.expectedForwardPath, urlModel.ForwardPath)
+		})
+	}
+}
+
+func TestShortenURLHandler_Tags(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	store.AddURL("https://www.shop.com", "plain1", time.Time{})
+	router := gin.Default()
+	router.POST("/shorten", ShortenURLHandler(store))
+
+	// shorten posts body and returns the status and the short code or error message
+	shorten := func(t *testing.T, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		if w.Code != http.StatusOK {
+			return w.Code, response["error"]
+		}
+		parts := strings.Split(response["short_url"], "/")
+		return w.Code, parts[len(parts)-1]
+	}
+
+	// Test case: Each campaign for the same destination gets its own link
+	status, spring := shorten(t, `{"url": "https://www.shop.com", "utm_source": "newsletter", "utm_campaign": "spring"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, "plain1", spring, "Tagged link should not reuse the untagged one")
+	status, summer := shorten(t, `{"url": "https://www.shop.com", "utm_source": "newsletter", "utm_campaign": "summer"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, spring, summer)
+
+	urlModel, exists := store.GetURL(spring)
+	assert.True(t, exists)
+	assert.Equal(t, "https://www.shop.com", urlModel.LongURL, "Tags should be stored apart from the long URL")
+	assert.Equal(t, map[string]string{"utm_source": "newsletter", "utm_campaign": "spring"}, urlModel.Tags)
+
+	// Test case: Repeating a campaign returns its existing link
+	status, again := shorten(t, `{"url": "https://www.shop.com", "utm_campaign": "spring", "params": {"utm_source": "newsletter"}}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, spring, again)
+
+	// Test case: Untagged submissions still return the untagged link
+	_, plain := shorten(t, `{"url": "https://www.shop.com"}`)
+	assert.Equal(t, "plain1", plain)
+
+	// Test case: Conflicting tags are rejected
+	status, message := shorten(t, `{"url": "https://www.shop.com", "utm_source": "newsletter", "params": {"utm_source": "blog"}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Invalid tags", message)
+}
+
+func TestShortenURLHandler_ClickLimit(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com/secret", "open1", time.Time{})
+	router := gin.Default()
+	router.POST("/shorten", ShortenURLHandler(store))
+
+	tests := []struct {
+		name              string
+		requestBody       models.ShortenRequest
+		expectedStatus    int
+		expectedError     string
+		expectedMaxClicks int
+	}{
+		{
+			name:              "One-Time Link",
+			requestBody:       models.ShortenRequest{URL: "https://www.example.com/secret", OneTime: true},
+			expectedStatus:    http.StatusOK,
+			expectedMaxClicks: 1,
+		},
+		{
+			name:              "Click Limit",
+			requestBody:       models.ShortenRequest{URL: "https://www.example.com/secret", MaxClicks: 10},
+			expectedStatus:    http.StatusOK,
+			expectedMaxClicks: 10,
+		},
+		{
+			name:              "One-Time Link With Matching Limit",
+			requestBody:       models.ShortenRequest{URL: "https://www.example.com/secret", MaxClicks: 1, OneTime: true},
+			expectedStatus:    http.StatusOK,
+			expectedMaxClicks: 1,
+		},
+		{
+			name:           "One-Time Link With Conflicting Limit",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/secret", MaxClicks: 3, OneTime: true},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid click limit",
+		},
+		{
+			name:           "Negative Limit",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/secret", MaxClicks: -1},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid click limit",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.requestBody)
+			assert.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			var response map[string]string
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if tt.expectedError != "" {
+				assert.Equal(t, tt.expectedError, response["error"])
+				return
+			}
+
+			// Click-limited links never reuse an existing link for the URL
+			parts := strings.Split(response["short_url"], "/")
+			shortCode := parts[len(parts)-1]
+			assert.NotEqual(t, "open1", shortCode)
+			urlModel, exists := store.GetURL(shortCode)
+			assert.True(t, exists)
+			assert.Equal(t, tt.expectedMaxClicks, urlModel.MaxClicks)
+		})
+	}
+}
+
+func TestShortenURLHandler_Schedule(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	router := gin.Default()
+	router.POST("/shorten", ShortenURLHandler(store))
+
+	launch := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	end := launch.Add(24 * time.Hour)
+
+	tests := []struct {
+		name                string
+		requestBody         models.ShortenRequest
+		expectedStatus      int
+		expectedError       string
+		expectedActivatesAt time.Time
+		expectedExpiresAt   time.Time
+	}{
+		{
+			name:                "Activation Window",
+			requestBody:         models.ShortenRequest{URL: "https://www.example.com/launch", Alias: "launch", ActivatesAt: launch.Format(time.RFC3339), ExpiresAt: end.Format(time.RFC3339)},
+			expectedStatus:      http.StatusOK,
+			expectedActivatesAt: launch,
+			expectedExpiresAt:   end,
+		},
+		{
+			name:              "Absolute Expiry",
+			requestBody:       models.ShortenRequest{URL: "https://www.example.com/sale", Alias: "sale", ExpiresAt: end.Format(time.RFC3339)},
+			expectedStatus:    http.StatusOK,
+			expectedExpiresAt: end,
+		},
+		{
+			name:           "Malformed Activation Time",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/launch", ActivatesAt: "tomorrow"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid activation time",
+		},
+		{
+			name:           "Expiry In The Past",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/launch", ExpiresAt: time.Now().Add(-time.Hour).Format(time.RFC3339)},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid expiry",
+		},
+		{
+			name:           "Both Expiry Forms",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/launch", ExpiresAt: end.Format(time.RFC3339), ExpiryInMins: 10},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid expiry",
+		},
+		{
+			name:           "Expires Before Activation",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/launch", ActivatesAt: end.Format(time.RFC3339), ExpiresAt: launch.Format(time.RFC3339)},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid activation window",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.requestBody)
+			assert.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedError, response["error"])
+				return
+			}
+			urlModel, exists := store.GetURL(tt.requestBody.Alias)
+			assert.True(t, exists, "Alias should exist in storage")
+			assert.True(t, tt.expectedActivatesAt.Equal(urlModel.ActivatesAt), "Activation time should be stored")
+			assert.True(t, tt.expectedExpiresAt.Equal(urlModel.ExpiresAt), "Expiry should be stored")
+		})
+	}
+
+	// Test case: Scheduled links are not handed out for duplicate submissions
+	body := `{"url": "https://www.example.com/open"}`
+	for _, request := range []string{`{"url": "https://www.example.com/open", "activates_at": "` + launch.Format(time.RFC3339) + `"}`, body} {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(request))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	_, exists := store.GetShortCode("https://www.example.com/open", nil)
+	assert.True(t, exists, "Unscheduled link should be indexed")
+	shortCode, _ := store.GetShortCode("https://www.example.com/open", nil)
+	urlModel, _ := store.GetURL(shortCode)
+	assert.True(t, urlModel.ActivatesAt.IsZero(), "Duplicate submissions should get the unscheduled link")
+}
+
+func TestShortenURLHandler_Password(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	store.AddURL("https://www.example.com/internal", "open1", time.Time{})
+	router := gin.Default()
+	router.POST("/shorten", ShortenURLHandler(store))
+
+	tests := []struct {
+		name           string
+		requestBody    models.ShortenRequest
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Protected Link",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/internal", Password: "open sesame"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Password Too Long",
+			requestBody:    models.ShortenRequest{URL: "https://www.example.com/internal", Password: strings.Repeat("x", services.MaxPasswordLength+1)},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid password",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.requestBody)
+			assert.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			var response map[string]string
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if tt.expectedError != "" {
+				assert.Equal(t, tt.expectedError, response["error"])
+				return
+			}
+
+			// Protected links never reuse an existing link for the URL
+			parts := strings.Split(response["short_url"], "/")
+			shortCode := parts[len(parts)-1]
+			assert.NotEqual(t, "open1", shortCode)
+			urlModel, exists := store.GetURL(shortCode)
+			assert.True(t, exists)
+			assert.NotContains(t, urlModel.PasswordHash, tt.requestBody.Password, "Only a hash of the password should be stored")
+			assert.True(t, services.CheckPassword(urlModel.PasswordHash, tt.requestBody.Password))
+		})
+	}
+
+	// Test case: Unprotected submissions are not handed the protected link
+	shortCode, _ := store.GetShortCode("https://www.example.com/internal", nil)
+	assert.Equal(t, "open1", shortCode)
+}
+
+func TestShortenURLHandler_DomainPolicy(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	policy, _ := newDomainPolicy(t, "deny *.phish.example\ndeny 10.0.0.0/8\n")
+	router := gin.Default()
+	router.POST("/shorten", ShortenURLHandler(store, WithDomainPolicy(policy)))
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{name: "Allowed Destination", url: "https://www.example.com", expectedStatus: http.StatusOK},
+		{name: "Blocked Domain", url: "https://login.phish.example/account", expectedStatus: http.StatusForbidden},
+		{name: "Blocked IP Range", url: "http://10.0.0.1/admin", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url": "`+tt.url+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, "Destination is not allowed", response["error"])
+				_, exists := store.GetShortCode(tt.url, nil)
+				assert.False(t, exists, "Blocked destinations should not be stored")
+			}
+		})
+	}
+}
+
+func TestShortenURLHandler_DestinationGuard(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	guard := services.NewDestinationGuard(nil, []string{"sho.rt"})
+	tests := []struct {
+		name            string
+		url             string
+		flagInternal    bool
+		expectedStatus  int
+		expectedError   string
+		expectedFlagged bool
+	}{
+		{name: "Public Destination", url: "https://www.example.com/", expectedStatus: http.StatusOK},
+		{
+			name:           "Internal Destination",
+			url:            "http://169.254.169.254/latest/meta-data/",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Destination is in an internal network",
+		},
+		{
+			name:            "Internal Destination Flagged",
+			url:             "http://10.0.0.1/admin",
+			flagInternal:    true,
+			expectedStatus:  http.StatusOK,
+			expectedFlagged: true,
+		},
+		{
+			name:           "Configured Short Domain",
+			url:            "https://sho.rt/abc123",
+			flagInternal:   true,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Destination is a short link",
+		},
+		{
+			name:           "Request Host",
+			url:            "http://example.com/abc123",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Destination is a short link",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewStorage()
+			router := gin.Default()
+			router.POST("/shorten", ShortenURLHandler(store, WithDestinationGuard(guard, tt.flagInternal)))
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url": "`+tt.url+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			var response map[string]string
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if tt.expectedError != "" {
+				assert.Equal(t, tt.expectedError, response["error"])
+				return
+			}
+			parts := strings.Split(response["short_url"], "/")
+			urlModel, exists := store.GetURL(parts[len(parts)-1])
+			assert.True(t, exists)
+			assert.Equal(t, tt.expectedFlagged, urlModel.Flagged)
+		})
+	}
+}
+
+func TestShortenURLHandler_Homographs(t *testing.T) {
+	// Initialize Gin in test mode
+	gin.SetMode(gin.TestMode)
+
+	detector := services.NewHomographDetector([]string{"paypal"})
+	tests := []struct {
+		name            string
+		url             string
+		flag            bool
+		expectedStatus  int
+		expectedError   string
+		expectedURL     string
+		expectedFlagged bool
+	}{
+		{
+			name:           "Unicode Host Stored As Punycode",
+			url:            "https://bücher.de/katalog",
+			expectedStatus: http.StatusOK,
+			expectedURL:    "https://xn--bcher-kva.de/katalog",
+		},
+		{
+			name:           "Protected Brand",
+			url:            "https://www.paypal.com/",
+			expectedStatus: http.StatusOK,
+			expectedURL:    "https://www.paypal.com/",
+		},
+		{
+			name:           "Mixed Script Host",
+			url:            "https://pаypal.com/login",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Destination host mixes scripts",
+		},
+		{
+			name:           "Lookalike Host",
+			url:            "https://paypa1.com/login",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Destination host imitates a protected domain",
+		},
+		{
+			name:            "Mixed Script Host Flagged",
+			url:             "https://pаypal.com/login",
+			flag:            true,
+			expectedStatus:  http.StatusOK,
+			expectedURL:     "https://xn--pypal-4ve.com/login",
+			expectedFlagged: true,
+		},
+		{
+			name:           "Invalid Unicode Host",
+			url:            "https://-bücher.de/",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid URL",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewStorage()
+			router := gin.Default()
+			router.POST("/shorten", ShortenURLHandler(store, WithHomographDetector(detector, tt.flag)))
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url": "`+tt.url+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			var response map[string]string
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if tt.expectedError != "" {
+				assert.Equal(t, tt.expectedError, response["error"])
+				return
+			}
+			parts := strings.Split(response["short_url"], "/")
+			urlModel, exists := store.GetURL(parts[len(parts)-1])
+			assert.True(t, exists)
+			assert.Equal(t, tt.expectedURL, urlModel.LongURL)
+			assert.Equal(t, tt.expectedFlagged, urlModel.Flagged)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Codedude1/shorty/models"
@@ -10,10 +13,63 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func StatsHandler(store *storage.Storage) gin.HandlerFunc {
+// maxBreakdownLimit caps the number of values per dimension clients may request from StatsHandler.
+const maxBreakdownLimit = 50
+
+// defaultSeriesWindows is how far back a click series reaches when from is not given.
+var defaultSeriesWindows = map[string]time.Duration{
+	storage.GranularityMinute: time.Hour,
+	storage.GranularityHour:   24 * time.Hour,
+	storage.GranularityDay:    30 * 24 * time.Hour,
+}
+
+// StatsHandler returns the statistics of a link. With any of the from, to
+// (RFC 3339) or granularity (minute, hour, day; default hour) query parameters
+// the response also carries a series of click counts per bucket, read from the
+// store's click rollups. With top=N it carries the N most frequent referrer
+// domains, browsers, operating systems, device classes and countries.
+func StatsHandler(store storage.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		shortCode := c.Param("shortCode")
 
+		// Validate the series parameters before touching the store
+		granularity := c.Query("granularity")
+		from, err := parseTimeQuery(c, "from")
+		if err != nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid from")
+			return
+		}
+		to, err := parseTimeQuery(c, "to")
+		if err != nil {
+			utils.RespondWithError(c, http.StatusBadRequest, "Invalid to")
+			return
+		}
+		var top int
+		if value := c.Query("top"); value != "" {
+			top, err = strconv.Atoi(value)
+			if err != nil || top < 1 || top > maxBreakdownLimit {
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid top")
+				return
+			}
+		}
+		withSeries := granularity != "" || !from.IsZero() || !to.IsZero()
+		if withSeries {
+			if granularity == "" {
+				granularity = storage.GranularityHour
+			}
+			window, known := defaultSeriesWindows[granularity]
+			if !known {
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid granularity")
+				return
+			}
+			if to.IsZero() {
+				to = time.Now()
+			}
+			if from.IsZero() {
+				from = to.Add(-window)
+			}
+		}
+
 		// Retrieve URL from storage using encapsulated method
 		urlModel, exists := store.GetURL(shortCode)
 
@@ -25,19 +81,55 @@ func StatsHandler(store *storage.Storage) gin.HandlerFunc {
 		// Check for expiration
 		if !urlModel.ExpiresAt.IsZero() && time.Now().After(urlModel.ExpiresAt) {
 			// Remove expired URL from storage
-			store.DeleteURL(shortCode)
+			if err := store.DeleteURL(shortCode); err != nil {
+				log.Printf("[ERROR] Failed to delete expired short code %s: %v", shortCode, err)
+			}
 			utils.RespondWithError(c, http.StatusNotFound, "Short URL has expired")
 			return
 		}
 
+		uniqueVisitors, err := store.UniqueVisitors(shortCode)
+		if err != nil {
+			log.Printf("[ERROR] Failed to estimate unique visitors for %s: %v", shortCode, err)
+			utils.RespondWithError(c, http.StatusInternalServerError, "Error loading click statistics")
+			return
+		}
+
 		// Prepare the response using StatsResponse
 		response := models.StatsResponse{
 			BaseURL: models.BaseURL{
 				LongURL:     urlModel.LongURL,
 				AccessCount: urlModel.AccessCount,
+				BotCount:    urlModel.BotCount,
 				CreatedAt:   urlModel.CreatedAt,
 				ExpiresAt:   urlModel.ExpiresAt,
 			},
+			ActivatesAt:    activationTime(urlModel),
+			UniqueVisitors: uniqueVisitors,
+		}
+		if hidesDestination(urlModel) {
+			response.LongURL = ""
+		}
+		if withSeries {
+			clicks, err := store.ClickSeries(shortCode, granularity, from, to)
+			if errors.Is(err, storage.ErrInvalidSeries) {
+				utils.RespondWithError(c, http.StatusBadRequest, "Invalid time range")
+				return
+			}
+			if err != nil {
+				log.Printf("[ERROR] Failed to load click series for %s: %v", shortCode, err)
+				utils.RespondWithError(c, http.StatusInternalServerError, "Error loading click statistics")
+				return
+			}
+			response.Granularity = granularity
+			response.Clicks = clicks
+		}
+		if top > 0 {
+			if response.Breakdowns, err = store.Breakdowns(shortCode, top); err != nil {
+				log.Printf("[ERROR] Failed to load click breakdowns for %s: %v", shortCode, err)
+				utils.RespondWithError(c, http.StatusInternalServerError, "Error loading click statistics")
+				return
+			}
 		}
 
 		utils.RespondWithJSON(c, http.StatusOK, response)
@@ -5,9 +5,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv" // Added for string conversion
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Codedude1/shorty/analytics"
 	"github.com/Codedude1/shorty/models"
 	"github.com/Codedude1/shorty/storage"
 	"github.com/stretchr/testify/assert"
@@ -186,3 +188,271 @@ func TestStatsHandler_AfterAccess(t *testing.T) {
 		assert.True(t, response.ExpiresAt.IsZero(), "ExpiresAt should be zero if not set")
 	})
 }
+
+func TestStatsHandler_ClickSeries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	shortCode := "series1"
+	store.AddURL("https://www.series.com", shortCode, time.Time{})
+
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	store.CountClicks([]models.ClickEvent{
+		{ShortCode: shortCode, AccessedAt: hour.Add(5 * time.Minute)},
+		{ShortCode: shortCode, AccessedAt: hour.Add(20 * time.Minute)},
+		{ShortCode: shortCode, AccessedAt: hour.Add(time.Hour + 1*time.Minute)},
+	})
+
+	router := gin.Default()
+	router.GET("/stats/:shortCode", StatsHandler(store))
+
+	from := hour.Format(time.RFC3339)
+	to := hour.Add(3 * time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedCounts     []int64
+		expectedGran       string
+	}{
+		{
+			// Test case: Hourly buckets over an explicit range
+			name:               "Hourly Series",
+			query:              "?granularity=hour&from=" + from + "&to=" + to,
+			expectedStatusCode: http.StatusOK,
+			expectedCounts:     []int64{2, 1, 0},
+			expectedGran:       "hour",
+		},
+		{
+			// Test case: Granularity defaults to hour when only a range is given
+			name:               "Default Granularity",
+			query:              "?from=" + from + "&to=" + to,
+			expectedStatusCode: http.StatusOK,
+			expectedCounts:     []int64{2, 1, 0},
+			expectedGran:       "hour",
+		},
+		{
+			// Test case: Daily buckets
+			name:               "Daily Series",
+			query:              "?granularity=day&from=" + from + "&to=" + to,
+			expectedStatusCode: http.StatusOK,
+			expectedCounts:     []int64{3},
+			expectedGran:       "day",
+		},
+		{
+			// Test case: Plain stats carry no series
+			name:               "No Series",
+			query:              "",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			// Test case: Unknown granularity
+			name:               "Invalid Granularity",
+			query:              "?granularity=week",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			// Test case: Malformed time
+			name:               "Invalid From",
+			query:              "?from=yesterday",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			// Test case: Range ending before it starts
+			name:               "Reversed Range",
+			query:              "?from=" + to + "&to=" + from,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			// Test case: Too many minute buckets
+			name:               "Range Too Long",
+			query:              "?granularity=minute&from=" + from + "&to=" + hour.Add(48*time.Hour).Format(time.RFC3339),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/stats/"+shortCode+tt.query, nil)
+			assert.NoError(t, err)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatusCode, w.Code)
+			if w.Code != http.StatusOK {
+				return
+			}
+			var response models.StatsResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedGran, response.Granularity)
+			counts := make([]int64, len(response.Clicks))
+			for i, bucket := range response.Clicks {
+				counts[i] = bucket.Count
+			}
+			if tt.expectedCounts == nil {
+				assert.Empty(t, response.Clicks)
+			} else {
+				assert.Equal(t, tt.expectedCounts, counts)
+				// The first bucket is the one containing from
+				assert.False(t, response.Clicks[0].Start.After(hour))
+			}
+		})
+	}
+}
+
+func TestStatsHandler_UniqueVisitors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	shortCode := "unique1"
+	store.AddURL("https://www.unique.com", shortCode, time.Time{})
+
+	// Redirects feed the store's rollups through a recorder, as in main
+	recorder := analytics.NewRecorder(10, analytics.SinkFunc(store.CountClicks))
+	router := gin.Default()
+	router.GET("/stats/:shortCode", StatsHandler(store))
+	router.GET("/:shortCode", RedirectHandler(store, WithClickRecorder(recorder), WithVisitorKey([]byte("test-key"))))
+
+	// Two clients, one of which refreshes
+	for _, remoteAddr := range []string{"203.0.113.7:1000", "203.0.113.7:1001", "198.51.100.2:2000"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusFound, w.Code)
+	}
+	assert.NoError(t, recorder.Close())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/"+shortCode+"?granularity=day", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.StatsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 3, response.AccessCount)
+	assert.Equal(t, int64(2), response.UniqueVisitors)
+	if assert.NotEmpty(t, response.Clicks) {
+		today := response.Clicks[len(response.Clicks)-1]
+		assert.Equal(t, int64(3), today.Count)
+		assert.Equal(t, int64(2), today.UniqueVisitors)
+	}
+}
+
+func TestStatsHandler_BotCount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	shortCode := "bots1"
+	store.AddURL("https://www.bots.com", shortCode, time.Time{})
+
+	recorder := analytics.NewRecorder(10, analytics.SinkFunc(store.CountClicks))
+	router := gin.Default()
+	router.GET("/stats/:shortCode", StatsHandler(store))
+	router.GET("/:shortCode", RedirectHandler(store, WithClickRecorder(recorder), WithVisitorKey([]byte("test-key"))))
+
+	// One visitor clicks twice after a chat app unfurled the link
+	for _, userAgent := range []string{"Slackbot-LinkExpanding 1.0", "Mozilla/5.0 (X11; Linux x86_64)", "Mozilla/5.0 (X11; Linux x86_64)"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusFound, w.Code)
+	}
+	assert.NoError(t, recorder.Close())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/"+shortCode+"?granularity=day", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.StatsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.AccessCount)
+	assert.Equal(t, 1, response.BotCount)
+	assert.Equal(t, int64(1), response.UniqueVisitors)
+	if assert.NotEmpty(t, response.Clicks) {
+		assert.Equal(t, int64(2), response.Clicks[len(response.Clicks)-1].Count, "Bot clicks should stay out of the series")
+	}
+}
+
+func TestStatsHandler_Breakdowns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewStorage()
+	shortCode := "sources1"
+	store.AddURL("https://www.sources.com", shortCode, time.Time{})
+
+	geoIP, err := analytics.ReadGeoIP(strings.NewReader("203.0.113.0,203.0.113.255,DE\n"))
+	assert.NoError(t, err)
+	recorder := analytics.NewRecorder(10, analytics.SinkFunc(store.CountClicks))
+	router := gin.Default()
+	router.GET("/stats/:shortCode", StatsHandler(store))
+	router.GET("/:shortCode", RedirectHandler(store, WithClickRecorder(recorder), WithGeoIP(geoIP)))
+
+	// Two clicks from a German phone via t.co, one from an unknown desktop
+	for _, click := range []struct{ remoteAddr, referrer, userAgent string }{
+		{"203.0.113.7:1000", "https://t.co/a", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) Version/17.1 Mobile/15E148 Safari/604.1"},
+		{"203.0.113.8:1000", "https://t.co/b", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) Version/17.1 Mobile/15E148 Safari/604.1"},
+		{"198.51.100.2:2000", "", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+		req.RemoteAddr = click.remoteAddr
+		req.Header.Set("Referer", click.referrer)
+		req.Header.Set("User-Agent", click.userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusFound, w.Code)
+	}
+	assert.NoError(t, recorder.Close())
+
+	tests := []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectBreakdowns   bool
+	}{
+		{
+			// Test case: Top values per dimension
+			name:               "Top One",
+			query:              "?top=1",
+			expectedStatusCode: http.StatusOK,
+			expectBreakdowns:   true,
+		},
+		{
+			// Test case: Breakdowns are only returned on request
+			name:               "Not Requested",
+			query:              "",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			// Test case: Out of range top
+			name:               "Invalid Top",
+			query:              "?top=500",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/"+shortCode+tt.query, nil))
+			assert.Equal(t, tt.expectedStatusCode, w.Code)
+			if w.Code != http.StatusOK {
+				return
+			}
+			var response models.StatsResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if !tt.expectBreakdowns {
+				assert.Nil(t, response.Breakdowns)
+				return
+			}
+			assert.Equal(t, []models.BreakdownEntry{{Value: "t.co", Count: 2}}, response.Breakdowns["referrer"])
+			assert.Equal(t, []models.BreakdownEntry{{Value: "Safari", Count: 2}}, response.Breakdowns["browser"])
+			assert.Equal(t, []models.BreakdownEntry{{Value: "iOS", Count: 2}}, response.Breakdowns["os"])
+			assert.Equal(t, []models.BreakdownEntry{{Value: "mobile", Count: 2}}, response.Breakdowns["device"])
+			assert.Equal(t, []models.BreakdownEntry{{Value: "DE", Count: 2}}, response.Breakdowns["country"])
+		})
+	}
+}
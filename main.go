@@ -4,13 +4,21 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"expvar"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Codedude1/shorty/analytics"
 	"github.com/Codedude1/shorty/handlers"
+	"github.com/Codedude1/shorty/services"
 	"github.com/Codedude1/shorty/storage"
 	"github.com/gin-gonic/gin"
 )
@@ -22,13 +30,201 @@ func main() {
 	// Initialize the Gin router
 	router := gin.Default()
 
-	// Initialize the in-memory storage
-	store := storage.NewStorage()
+	// Initialize the storage backend selected by STORAGE_TYPE
+	store, err := storage.New(storage.Config{
+		Type:          getEnv("STORAGE_TYPE", storage.TypeMemory),
+		ShardCount:    getEnvAsInt("SHARD_COUNT", storage.DefaultShardCount),
+		DataDir:       getEnv("DATA_DIR", "data"),
+		SnapshotEvery: getEnvAsInt("SNAPSHOT_EVERY", storage.DefaultSnapshotEvery),
+		SyncWrites:    getEnvAsBool("FILE_SYNC", false),
+		DatabasePath:  getEnv("SQLITE_PATH", "shorty.db"),
+		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword: getEnv("REDIS_PASSWORD", ""),
+		RedisDB:       getEnvAsInt("REDIS_DB", 0),
+	})
+	if err != nil {
+		log.Fatalf("[ERROR] Failed to initialize storage: %v", err)
+	}
+
+	// Handler options; extra reserved aliases are added to the built-in route names
+	reservedAliases := append([]string{}, services.DefaultReservedAliases...)
+	reservedAliases = append(reservedAliases, getEnvAsList("RESERVED_ALIASES")...)
+	handlerOptions := []handlers.Option{
+		handlers.WithReservedAliases(reservedAliases),
+	}
+
+	// Record click events in the background. Every store keeps click rollups for
+	// /stats; ACCESS_LOG_PATH additionally selects a JSON lines file for the raw
+	// events, otherwise stores with their own access log (sqlite, redis) receive them.
+	clickSinks := []analytics.Sink{analytics.SinkFunc(store.CountClicks)}
+	if path := getEnv("ACCESS_LOG_PATH", ""); path != "" {
+		fileSink, err := analytics.NewFileSink(path)
+		if err != nil {
+			log.Fatalf("[ERROR] Failed to open access log: %v", err)
+		}
+		defer fileSink.Close()
+		clickSinks = append(clickSinks, fileSink)
+	} else if sink, ok := store.(analytics.Sink); ok {
+		clickSinks = append(clickSinks, sink)
+	}
+	// Links without their own redirect status use REDIRECT_CODE
+	redirectCode := getEnvAsInt("REDIRECT_CODE", http.StatusFound)
+	if !services.IsValidRedirectCode(redirectCode) {
+		log.Fatalf("[ERROR] REDIRECT_CODE must be 301, 302, 307 or 308, got %d", redirectCode)
+	}
+	handlerOptions = append(handlerOptions, handlers.WithRedirectCode(redirectCode))
+
+	// Crawlers, link unfurlers and prefetches are counted as bots, matched by the
+	// built-in User-Agent rules plus any in BOT_USER_AGENTS. BOT_FILTER=false
+	// counts every redirect as a visit.
+	if getEnvAsBool("BOT_FILTER", true) {
+		botUserAgents := append([]string{}, analytics.DefaultBotUserAgents...)
+		botUserAgents = append(botUserAgents, getEnvAsList("BOT_USER_AGENTS")...)
+		handlerOptions = append(handlerOptions, handlers.WithBotFilter(analytics.NewBotFilter(botUserAgents)))
+	} else {
+		handlerOptions = append(handlerOptions, handlers.WithBotFilter(nil))
+	}
+	// Bots leave the clicks of click-limited links alone unless BOT_CLICK_LIMITS=true
+	handlerOptions = append(handlerOptions, handlers.WithBotClickLimits(getEnvAsBool("BOT_CLICK_LIMITS", false)))
+
+	// Scheduled links answer with NOT_YET_AVAILABLE_STATUS before they activate, or
+	// redirect to NOT_YET_AVAILABLE_URL, such as a coming soon page, if it is set
+	pendingStatus := getEnvAsInt("NOT_YET_AVAILABLE_STATUS", http.StatusNotFound)
+	if pendingStatus < 400 || pendingStatus > 599 {
+		log.Fatalf("[ERROR] NOT_YET_AVAILABLE_STATUS must be a 4xx or 5xx status, got %d", pendingStatus)
+	}
+	pendingURL := getEnv("NOT_YET_AVAILABLE_URL", "")
+	if pendingURL != "" && !services.IsValidURL(pendingURL) {
+		log.Fatalf("[ERROR] NOT_YET_AVAILABLE_URL must be an http or https URL, got %q", pendingURL)
+	}
+	handlerOptions = append(handlerOptions, handlers.WithNotYetAvailable(pendingStatus, pendingURL))
+
+	// Protected links lock for PASSWORD_LOCKOUT after PASSWORD_MAX_ATTEMPTS wrong
+	// passwords in a row; 0 allows unlimited attempts
+	maxAttempts := getEnvAsInt("PASSWORD_MAX_ATTEMPTS", services.DefaultMaxAttempts)
+	if maxAttempts > 0 {
+		lockout := services.NewLockout(maxAttempts, getEnvAsDuration("PASSWORD_LOCKOUT", services.DefaultLockout))
+		handlerOptions = append(handlerOptions, handlers.WithPasswordLockout(lockout))
+	} else {
+		handlerOptions = append(handlerOptions, handlers.WithPasswordLockout(nil))
+	}
+
+	// Flagged links, and destinations outside INTERSTITIAL_ALLOWED_HOSTS if it is set,
+	// show a warning page counting down INTERSTITIAL_DELAY before redirecting
+	handlerOptions = append(handlerOptions, handlers.WithInterstitial(
+		services.NewAllowlistPolicy(getEnvAsList("INTERSTITIAL_ALLOWED_HOSTS")),
+		getEnvAsDuration("INTERSTITIAL_DELAY", handlers.DefaultInterstitialDelay),
+	))
+	// Instances behind one load balancer must share INTERSTITIAL_KEY, or
+	// visitors continuing past the page may be warned again
+	if key := getEnv("INTERSTITIAL_KEY", ""); key != "" {
+		handlerOptions = append(handlerOptions, handlers.WithInterstitialKey([]byte(key)))
+	}
+	if dir := getEnv("INTERSTITIAL_TEMPLATE_DIR", ""); dir != "" {
+		page, err := handlers.LoadInterstitialTemplate(dir)
+		if err != nil {
+			log.Fatalf("[ERROR] Failed to load interstitial template: %v", err)
+		}
+		handlerOptions = append(handlerOptions, handlers.WithInterstitialTemplate(page))
+	}
+
+	// Destinations in internal networks, or on the SHORT_DOMAINS links are served
+	// from, are refused; DESTINATION_GUARD=flag accepts internal ones as flagged links
+	guard := services.NewDestinationGuard(net.DefaultResolver, getEnvAsList("SHORT_DOMAINS"))
+	switch mode := getEnv("DESTINATION_GUARD", "reject"); mode {
+	case "reject":
+		handlerOptions = append(handlerOptions, handlers.WithDestinationGuard(guard, false))
+	case "flag":
+		handlerOptions = append(handlerOptions, handlers.WithDestinationGuard(guard, true))
+	case "off":
+		log.Println("[WARN] DESTINATION_GUARD is off; links may point into internal networks.")
+	default:
+		log.Fatalf("[ERROR] DESTINATION_GUARD must be reject, flag or off, got %q", mode)
+	}
+
+	// Hosts mixing scripts or imitating the PROTECTED_BRANDS are flagged, so
+	// visitors see the interstitial; HOMOGRAPH_ACTION=reject refuses them instead
+	homographs := services.NewHomographDetector(getEnvAsList("PROTECTED_BRANDS"))
+	switch mode := getEnv("HOMOGRAPH_ACTION", "flag"); mode {
+	case "flag":
+		handlerOptions = append(handlerOptions, handlers.WithHomographDetector(homographs, true))
+	case "reject":
+		handlerOptions = append(handlerOptions, handlers.WithHomographDetector(homographs, false))
+	case "off":
+	default:
+		log.Fatalf("[ERROR] HOMOGRAPH_ACTION must be flag, reject or off, got %q", mode)
+	}
+
+	// Destinations are checked against the allow and deny rules in DOMAIN_POLICY_FILE,
+	// which is reread every DOMAIN_POLICY_RELOAD when it changes
+	if path := getEnv("DOMAIN_POLICY_FILE", ""); path != "" {
+		domainPolicy, err := services.LoadDomainPolicy(path)
+		if err != nil {
+			log.Fatalf("[ERROR] Failed to load domain policy: %v", err)
+		}
+		log.Printf("[INFO] Loaded %d domain policy rules from %s", domainPolicy.Len(), path)
+		handlerOptions = append(handlerOptions, handlers.WithDomainPolicy(domainPolicy))
+		go func() {
+			ticker := time.NewTicker(getEnvAsDuration("DOMAIN_POLICY_RELOAD", 10*time.Second))
+			defer ticker.Stop()
+			for {
+				<-ticker.C
+				reloaded, err := domainPolicy.Reload()
+				if err != nil {
+					log.Printf("[ERROR] Failed to reload domain policy, keeping the previous rules: %v", err)
+					continue
+				}
+				if reloaded {
+					log.Printf("[INFO] Reloaded %d domain policy rules from %s", domainPolicy.Len(), path)
+				}
+			}
+		}()
+	}
+
+	// Unique visitor counts hash clients with VISITOR_KEY. Instances sharing a
+	// store must share the key, or the same visitor is counted once per key.
+	visitorKey := []byte(getEnv("VISITOR_KEY", ""))
+	if len(visitorKey) == 0 {
+		visitorKey = make([]byte, 32)
+		if _, err := rand.Read(visitorKey); err != nil {
+			log.Fatalf("[ERROR] Failed to generate visitor key: %v", err)
+		}
+		log.Println("[WARN] VISITOR_KEY is not set; unique visitors are only deduplicated until restart.")
+	}
+	handlerOptions = append(handlerOptions, handlers.WithVisitorKey(visitorKey))
+
+	// Resolve click countries from an offline GeoIP database, if one is configured
+	if path := getEnv("GEOIP_PATH", ""); path != "" {
+		geoIP, err := analytics.LoadGeoIP(path)
+		if err != nil {
+			log.Fatalf("[ERROR] Failed to load GeoIP database: %v", err)
+		}
+		log.Printf("[INFO] Loaded %d GeoIP ranges from %s", geoIP.Len(), path)
+		handlerOptions = append(handlerOptions, handlers.WithGeoIP(geoIP))
+	}
+	clickRecorder := analytics.NewRecorder(getEnvAsInt("CLICK_BUFFER_SIZE", analytics.DefaultBufferSize), clickSinks...)
+	handlerOptions = append(handlerOptions, handlers.WithClickRecorder(clickRecorder))
 
 	// Register routes
-	router.POST("/shorten", handlers.ShortenURLHandler(store))
+	router.POST("/shorten", handlers.ShortenURLHandler(store, handlerOptions...))
 	router.GET("/stats/:shortCode", handlers.StatsHandler(store))
-	router.GET("/:shortCode", handlers.RedirectHandler(store))
+	router.GET("/links", handlers.ListLinksHandler(store))
+	router.GET("/links/:shortCode", handlers.GetLinkHandler(store))
+	router.PATCH("/links/:shortCode", handlers.UpdateLinkHandler(store, handlerOptions...))
+	router.DELETE("/links/:shortCode", handlers.DeleteLinkHandler(store))
+	redirectHandler := handlers.RedirectHandler(store, handlerOptions...)
+	router.GET("/:shortCode", redirectHandler)
+	// Link checkers and unfurlers often probe with HEAD; they get the redirect and count as bots
+	router.HEAD("/:shortCode", redirectHandler)
+	// Trailing path segments are forwarded by links created with forward_path
+	router.GET("/:shortCode/*path", redirectHandler)
+	router.HEAD("/:shortCode/*path", redirectHandler)
+	// The password prompt of protected links posts back to the link
+	router.POST("/:shortCode", redirectHandler)
+	router.POST("/:shortCode/*path", redirectHandler)
+
+	// Expose runtime metrics such as expired_links_total
+	router.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 
 	// Determine server port from environment variable or default to 8081
 	port := getEnv("PORT", "8081")
@@ -39,15 +235,22 @@ func main() {
 		Handler: router,
 	}
 
-	// Start the cleanup goroutine to remove expired URLs periodically
+	// Start the cleanup goroutine to remove expired URLs shortly after they expire.
+	// Stores sweep from an expiry index, so frequent runs are cheap when nothing is due.
 	go func() {
-		cleanupInterval := getEnvAsDuration("CLEANUP_INTERVAL", time.Hour)
+		cleanupInterval := getEnvAsDuration("CLEANUP_INTERVAL", time.Second)
 		ticker := time.NewTicker(cleanupInterval)
 		defer ticker.Stop()
 		for {
 			<-ticker.C
-			store.CleanupExpiredURLs()
-			log.Println("[INFO] Cleanup of expired URLs completed.")
+			before := storage.ExpiredLinks()
+			if err := store.CleanupExpiredURLs(); err != nil {
+				log.Printf("[ERROR] Cleanup of expired URLs failed: %v", err)
+				continue
+			}
+			if removed := storage.ExpiredLinks() - before; removed > 0 {
+				log.Printf("[INFO] Cleanup removed %d expired URLs.", removed)
+			}
 		}
 	}()
 
@@ -74,6 +277,16 @@ func main() {
 		log.Fatalf("[ERROR] Server forced to shutdown: %v", err)
 	}
 
+	// Write queued click events before the store they may go to is closed
+	clickRecorder.Close()
+
+	// Flush and release storage backends that hold resources
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("[ERROR] Failed to close storage: %v", err)
+		}
+	}
+
 	log.Println("[INFO] Server exiting.")
 }
 
@@ -96,3 +309,37 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+// getEnvAsInt retrieves the value of the environment variable named by the key
+// and parses it as an int. It returns the defaultValue if the variable is not present or invalid.
+func getEnvAsInt(key string, defaultValue int) int {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		if value, err := strconv.Atoi(valueStr); err == nil {
+			return value
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsBool retrieves the value of the environment variable named by the key
+// and parses it as a bool. It returns the defaultValue if the variable is not present or invalid.
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		if value, err := strconv.ParseBool(valueStr); err == nil {
+			return value
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsList retrieves the value of the environment variable named by the key
+// as a comma-separated list, skipping empty items. It returns nil if the variable is not present.
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
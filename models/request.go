@@ -2,6 +2,34 @@ package models
 
 // ShortenRequest contains fields from the incoming request.
 type ShortenRequest struct {
-	URL          string `json:"url" binding:"required"`
-	ExpiryInMins int    `json:"expiry_in_mins"` // Optional TTL parameter
+	URL          string            `json:"url" binding:"required"`
+	ExpiryInMins int               `json:"expiry_in_mins"` // Optional TTL parameter
+	ActivatesAt  string            `json:"activates_at"`   // Optional RFC 3339 time before which the link does not resolve
+	ExpiresAt    string            `json:"expires_at"`     // Optional RFC 3339 expiry; an alternative to expiry_in_mins
+	Alias        string            `json:"alias"`          // Optional custom short code
+	RedirectCode int               `json:"redirect_code"`  // Optional 301, 302, 307 or 308; defaults to the server setting
+	QueryMode    string            `json:"query_mode"`     // Optional none (default), merge or override
+	ForwardPath  bool              `json:"forward_path"`   // Optional; forward path segments after the short code
+	MaxClicks    int               `json:"max_clicks"`     // Optional visits allowed before the link is gone
+	OneTime      bool              `json:"one_time"`       // Optional; shorthand for max_clicks 1
+	Password     string            `json:"password"`       // Optional password visitors must enter before being redirected
+	UTMSource    string            `json:"utm_source"`     // Optional campaign tags appended on redirect
+	UTMMedium    string            `json:"utm_medium"`
+	UTMCampaign  string            `json:"utm_campaign"`
+	Params       map[string]string `json:"params"` // Optional extra query parameters appended on redirect
+}
+
+// UpdateLinkRequest contains the link fields PATCH may change. Omitted fields are left unchanged.
+type UpdateLinkRequest struct {
+	URL          *string `json:"url"`            // New destination
+	ExpiryInMins *int    `json:"expiry_in_mins"` // New TTL from now; 0 clears the expiry
+	ActivatesAt  *string `json:"activates_at"`   // RFC 3339 activation time; "" clears it
+	ExpiresAt    *string `json:"expires_at"`     // RFC 3339 expiry; "" clears it
+	Disabled     *bool   `json:"disabled"`       // Disable or re-enable redirects
+	Flagged      *bool   `json:"flagged"`        // Flag as suspicious, or clear the flag
+	RedirectCode *int    `json:"redirect_code"`  // 301, 302, 307 or 308; 0 reverts to the server default
+	QueryMode    *string `json:"query_mode"`     // none, merge or override
+	ForwardPath  *bool   `json:"forward_path"`   // Forward path segments after the short code
+	MaxClicks    *int    `json:"max_clicks"`     // Visits allowed in total; 0 removes the limit
+	Password     *string `json:"password"`       // New password; "" removes the protection
 }
@@ -4,19 +4,88 @@ import "time"
 
 // BaseURL contains fields common to multiple responses.
 type BaseURL struct {
-	LongURL     string    `json:"long_url"`
+	LongURL     string    `json:"long_url,omitempty"` // Omitted from responses that hide the destination
 	CreatedAt   time.Time `json:"created_at"`
 	AccessCount int       `json:"access_count"`
+	BotCount    int       `json:"bot_count"` // Redirects classified as bots; not included in AccessCount
 	ExpiresAt   time.Time `json:"expires_at,omitempty"`
 }
 
 // URL represents the internal storage model for a shortened URL.
 type URL struct {
 	BaseURL
-	ShortCode string `json:"short_code"`
+	ShortCode    string `json:"short_code"`
+	Alias        bool   `json:"alias,omitempty"`         // Custom short code chosen by the user; excluded from duplicate detection
+	Disabled     bool   `json:"disabled,omitempty"`      // Disabled links stop redirecting until re-enabled
+	Flagged      bool   `json:"flagged,omitempty"`       // Flagged as suspicious; redirects show the interstitial warning
+	RedirectCode int    `json:"redirect_code,omitempty"` // 301, 302, 307 or 308; 0 uses the server default
+	QueryMode    string `json:"query_mode,omitempty"`    // How the request query joins the destination's: merge, override or dropped if empty
+	ForwardPath  bool   `json:"forward_path,omitempty"`  // Append path segments after the short code to the destination
+	MaxClicks    int    `json:"max_clicks,omitempty"`    // Visits allowed before the link is gone; 0 for no limit
+	PasswordHash string `json:"password_hash,omitempty"` // bcrypt hash of the password visitors must enter; empty for open links
+	// ActivatesAt is the time before which the link does not resolve; zero for links that are not scheduled.
+	ActivatesAt time.Time `json:"activates_at,omitempty"`
+	// Tags are query parameters such as utm_source appended to LongURL on redirect.
+	// Links for the same destination with different tags are deduplicated apart.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// ClickEvent is a single redirect, recorded with the fields of the AccessLogs table.
+type ClickEvent struct {
+	ShortCode      string    `json:"short_code"`
+	AccessedAt     time.Time `json:"accessed_at"`
+	Referrer       string    `json:"referrer,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	IPAddress      string    `json:"ip_address,omitempty"`
+	AcceptLanguage string    `json:"accept_language,omitempty"`
+	VisitorID      string    `json:"visitor_id,omitempty"` // Pseudonymous client fingerprint for unique visitor counts
+	Country        string    `json:"country,omitempty"`    // ISO 3166 country code resolved from the IP address
+	Bot            bool      `json:"bot,omitempty"`        // Classified as a crawler, unfurler or prefetch; excluded from rollups
+}
+
+// ClickBucket is the number of clicks in one time bucket of a click series.
+type ClickBucket struct {
+	Start          time.Time `json:"start"` // Start of the bucket, in UTC
+	Count          int64     `json:"count"`
+	UniqueVisitors int64     `json:"unique_visitors"` // Approximate
+}
+
+// BreakdownEntry is the number of clicks sharing one value of a breakdown dimension.
+type BreakdownEntry struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
 }
 
 // StatsResponse represents the API response for URL statistics.
 type StatsResponse struct {
 	BaseURL
+	ActivatesAt    *time.Time    `json:"activates_at,omitempty"` // Omitted for links that are not scheduled
+	UniqueVisitors int64         `json:"unique_visitors"`        // Approximate number of distinct visitors
+	Granularity    string        `json:"granularity,omitempty"`  // Set when a click series was requested
+	Clicks         []ClickBucket `json:"clicks,omitempty"`
+	// Breakdowns holds the top values per dimension (referrer, browser, os, device, country) when requested.
+	Breakdowns map[string][]BreakdownEntry `json:"breakdowns,omitempty"`
+}
+
+// LinkResponse represents a link resource returned by the management API.
+type LinkResponse struct {
+	BaseURL
+	ShortCode    string            `json:"short_code"`
+	ShortURL     string            `json:"short_url"`
+	ActivatesAt  *time.Time        `json:"activates_at,omitempty"` // Omitted for links that are not scheduled
+	Alias        bool              `json:"alias"`
+	Disabled     bool              `json:"disabled"`
+	Flagged      bool              `json:"flagged"`
+	RedirectCode int               `json:"redirect_code,omitempty"` // Omitted when the server default applies
+	QueryMode    string            `json:"query_mode"`              // merge, override or none
+	ForwardPath  bool              `json:"forward_path"`
+	MaxClicks    int               `json:"max_clicks,omitempty"` // Omitted for links without a click limit
+	Protected    bool              `json:"password_protected"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+// ListLinksResponse represents one page of links returned by the management API.
+type ListLinksResponse struct {
+	Links      []LinkResponse `json:"links"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Pass as cursor to fetch the next page
 }
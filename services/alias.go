@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Alias length limits for custom short codes.
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 64
+)
+
+// DefaultReservedAliases lists path segments that aliases must not shadow.
+var DefaultReservedAliases = []string{"shorten", "stats", "links", "debug"}
+
+var (
+	// ErrInvalidAlias is returned for aliases with disallowed characters or length.
+	ErrInvalidAlias = errors.New("alias must be 3-64 characters of letters, digits, '-' or '_'")
+	// ErrReservedAlias is returned for aliases that collide with a reserved word.
+	ErrReservedAlias = errors.New("alias is reserved")
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidateAlias checks that alias is usable as a custom short code. Reserved words
+// are matched case-insensitively so aliases cannot shadow routes such as /stats.
+func ValidateAlias(alias string, reserved []string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength || !aliasPattern.MatchString(alias) {
+		return ErrInvalidAlias
+	}
+	for _, word := range reserved {
+		if strings.EqualFold(alias, word) {
+			return ErrReservedAlias
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAlias(t *testing.T) {
+	reserved := []string{"stats", "shorten"}
+
+	// Define test cases
+	tests := []struct {
+		name     string
+		alias    string
+		expected error
+	}{
+		{
+			name:     "Valid Alias",
+			alias:    "spring-sale",
+			expected: nil,
+		},
+		{
+			name:     "Valid Alias with Underscore and Digits",
+			alias:    "Launch_2024",
+			expected: nil,
+		},
+		{
+			name:     "Too Short",
+			alias:    "ab",
+			expected: ErrInvalidAlias,
+		},
+		{
+			name:     "Too Long",
+			alias:    strings.Repeat("a", MaxAliasLength+1),
+			expected: ErrInvalidAlias,
+		},
+		{
+			name:     "Slash Not Allowed",
+			alias:    "spring/sale",
+			expected: ErrInvalidAlias,
+		},
+		{
+			name:     "Unicode Not Allowed",
+			alias:    "café-sale",
+			expected: ErrInvalidAlias,
+		},
+		{
+			name:     "Reserved Word",
+			alias:    "stats",
+			expected: ErrReservedAlias,
+		},
+		{
+			name:     "Reserved Word Different Case",
+			alias:    "Shorten",
+			expected: ErrReservedAlias,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAlias(tt.alias, reserved)
+			assert.Equal(t, tt.expected, err, "ValidateAlias(%q) should return %v", tt.alias, tt.expected)
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// domainRule is one allow or deny line of a domain policy.
+type domainRule struct {
+	allow    bool
+	host     string         // Exact host, or the parent domain of a wildcard; "" matches any host
+	wildcard bool           // host matches subdomains only
+	prefix   netip.Prefix   // Valid for IP and CIDR rules, which match IP hosts only
+	path     *regexp.Regexp // Optional; must also match the destination path
+}
+
+// matches reports whether the rule applies to a destination with host and path.
+func (r domainRule) matches(host string, addr netip.Addr, path string) bool {
+	switch {
+	case r.prefix.IsValid():
+		if !addr.IsValid() || !r.prefix.Contains(addr) {
+			return false
+		}
+	case r.wildcard:
+		if !strings.HasSuffix(host, "."+r.host) {
+			return false
+		}
+	case r.host != "":
+		if host != r.host {
+			return false
+		}
+	}
+	return r.path == nil || r.path.MatchString(path)
+}
+
+// DomainRules is an ordered list of allow and deny rules for link destinations.
+// The first rule matching a destination decides; destinations no rule matches
+// are allowed, so a final "deny *" turns the rules into an allowlist.
+type DomainRules struct {
+	rules []domainRule
+}
+
+// ReadDomainRules parses domain rules, one per line:
+//
+//	allow|deny HOST [PATH_REGEXP]
+//
+// HOST is an exact host name (evil.example), a wildcard matching every
+// subdomain but not the domain itself (*.evil.example), * for any host, or an
+// IP address or CIDR range (10.0.0.0/8) matching IP hosts. Internationalized
+// names may be given in Unicode (bücher.example). PATH_REGEXP is an
+// optional Go regular expression the decoded destination path must also
+// match; it is not anchored and may not contain spaces. Blank lines and lines
+// starting with # are ignored.
+func ReadDomainRules(r io.Reader) (*DomainRules, error) {
+	rules := &DomainRules{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule, err := parseDomainRule(strings.Fields(text))
+		if err != nil {
+			return nil, fmt.Errorf("domain policy line %d: %w", line, err)
+		}
+		rules.rules = append(rules.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read domain policy: %w", err)
+	}
+	return rules, nil
+}
+
+// parseDomainRule parses the fields of one rule line.
+func parseDomainRule(fields []string) (domainRule, error) {
+	var rule domainRule
+	if len(fields) < 2 || len(fields) > 3 {
+		return rule, fmt.Errorf("expected allow|deny HOST [PATH_REGEXP]")
+	}
+	switch fields[0] {
+	case "allow":
+		rule.allow = true
+	case "deny":
+	default:
+		return rule, fmt.Errorf("unknown action %q", fields[0])
+	}
+
+	host := normalizeHost(fields[1])
+	if prefix, err := netip.ParsePrefix(host); err == nil {
+		rule.prefix = prefix.Masked()
+	} else if addr, ok := parseIP(host); ok {
+		rule.prefix = netip.PrefixFrom(addr, addr.BitLen())
+	} else if host == "*" {
+		// Any host
+	} else if parent, wildcard := strings.CutPrefix(host, "*."); wildcard && parent != "" && !strings.Contains(parent, "*") {
+		rule.host, rule.wildcard = parent, true
+	} else if host != "" && !strings.ContainsAny(host, "*/") {
+		rule.host = host
+	} else {
+		return rule, fmt.Errorf("invalid host %q", fields[1])
+	}
+	if !isASCII(rule.host) {
+		// Destinations are matched in punycode, the form links are stored in
+		ascii, err := idna.Lookup.ToASCII(rule.host)
+		if err != nil {
+			return rule, fmt.Errorf("invalid host %q: %w", fields[1], err)
+		}
+		rule.host = ascii
+	}
+
+	if len(fields) == 3 {
+		path, err := regexp.Compile(fields[2])
+		if err != nil {
+			return rule, fmt.Errorf("invalid path pattern: %w", err)
+		}
+		rule.path = path
+	}
+	return rule, nil
+}
+
+// Allowed reports whether links may lead to destination. IP hosts in the
+// legacy forms browsers resolve, such as 167772161 for 10.0.0.1, are matched
+// against IP and CIDR rules by the address they stand for.
+func (r *DomainRules) Allowed(destination *url.URL) bool {
+	host := normalizeHost(destination.Hostname())
+	addr, _ := parseIP(host)
+	for _, rule := range r.rules {
+		if rule.matches(host, addr, destination.Path) {
+			return rule.allow
+		}
+	}
+	return true
+}
+
+// Len returns the number of rules.
+func (r *DomainRules) Len() int {
+	return len(r.rules)
+}
+
+// DomainPolicy enforces the DomainRules of a file, picking up changes to the
+// file when Reload is called. It is safe for concurrent use.
+type DomainPolicy struct {
+	path  string
+	rules atomic.Pointer[DomainRules]
+
+	mu      sync.Mutex // Serializes reloads
+	modTime time.Time
+	size    int64
+}
+
+// LoadDomainPolicy reads the domain rules in path, in the format accepted by
+// ReadDomainRules.
+func LoadDomainPolicy(path string) (*DomainPolicy, error) {
+	policy := &DomainPolicy{path: path}
+	if _, err := policy.Reload(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Reload rereads the rules file if its modification time or size changed, and
+// reports whether it did. If the new rules cannot be read the current ones
+// stay in force, and the same version of the file is not tried again.
+func (p *DomainPolicy) Reload() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, fmt.Errorf("open domain policy: %w", err)
+	}
+	if p.rules.Load() != nil && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return false, nil
+	}
+	p.modTime, p.size = info.ModTime(), info.Size()
+
+	file, err := os.Open(p.path)
+	if err != nil {
+		return false, fmt.Errorf("open domain policy: %w", err)
+	}
+	defer file.Close()
+	rules, err := ReadDomainRules(file)
+	if err != nil {
+		return false, err
+	}
+	p.rules.Store(rules)
+	return true, nil
+}
+
+// Allowed reports whether links may lead to rawURL under the current rules.
+// URLs that cannot be parsed are not allowed.
+func (p *DomainPolicy) Allowed(rawURL string) bool {
+	destination, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return p.rules.Load().Allowed(destination)
+}
+
+// Len returns the number of rules in force.
+func (p *DomainPolicy) Len() int {
+	return p.rules.Load().Len()
+}
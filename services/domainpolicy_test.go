@@ -0,0 +1,156 @@
+package services
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainRules(t *testing.T) {
+	rules, err := ReadDomainRules(strings.NewReader(`
+# Phishing domains
+deny evil.example
+allow safe.bad.example
+deny *.bad.example
+deny 10.0.0.0/8
+deny ::1
+deny 0x7f000002
+deny shop.example ^/login
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 7, rules.Len())
+
+	tests := []struct {
+		name        string
+		destination string
+		expected    bool
+	}{
+		{name: "Unlisted Host", destination: "https://www.example.com/", expected: true},
+		{name: "Exact Host", destination: "https://EVIL.example./path", expected: false},
+		{name: "Exact Host Leaves Subdomains", destination: "https://www.evil.example/", expected: true},
+		{name: "Wildcard Subdomain", destination: "https://a.b.bad.example/", expected: false},
+		{name: "Wildcard Leaves Domain Itself", destination: "https://bad.example/", expected: true},
+		{name: "Earlier Allow Wins", destination: "https://safe.bad.example/", expected: true},
+		{name: "CIDR", destination: "http://10.1.2.3:8080/", expected: false},
+		{name: "IPv4-Mapped CIDR", destination: "http://[::ffff:10.1.2.3]/", expected: false},
+		{name: "Decimal IP In CIDR", destination: "http://167772161/", expected: false},
+		{name: "Hex IP In CIDR", destination: "http://0xa.0.0.1/", expected: false},
+		{name: "Octal IP In CIDR", destination: "http://012.0.0.1/", expected: false},
+		{name: "Short IP In CIDR", destination: "http://10.1/", expected: false},
+		{name: "Legacy IP Rule", destination: "http://127.0.0.2/", expected: false},
+		{name: "IP Outside CIDR", destination: "http://192.168.1.1/", expected: true},
+		{name: "IPv6 Address", destination: "http://[::1]/", expected: false},
+		{name: "Path Pattern", destination: "https://shop.example/login?next=/", expected: false},
+		{name: "Encoded Path Pattern", destination: "https://shop.example/%6Cogin", expected: false},
+		{name: "Path Pattern Elsewhere", destination: "https://shop.example/cart", expected: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := url.Parse(tt.destination)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rules.Allowed(destination))
+		})
+	}
+
+	// Test case: A final deny * turns the rules into an allowlist
+	allowlist, err := ReadDomainRules(strings.NewReader("allow example.com\nallow *.example.com\ndeny *\n"))
+	require.NoError(t, err)
+	for destination, expected := range map[string]bool{
+		"https://example.com/":     true,
+		"https://www.example.com/": true,
+		"https://other.net/":       false,
+	} {
+		parsed, _ := url.Parse(destination)
+		assert.Equal(t, expected, allowlist.Allowed(parsed), destination)
+	}
+}
+
+func TestDomainRules_Unicode(t *testing.T) {
+	rules, err := ReadDomainRules(strings.NewReader(`
+allow München.example
+deny *.bücher.example
+deny *
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		destination string
+		expected    bool
+	}{
+		{name: "Unicode Allow Rule", destination: "https://xn--mnchen-3ya.example/", expected: true},
+		{name: "Unicode Allow Rule Unicode Destination", destination: "https://münchen.example/", expected: true},
+		{name: "Unicode Deny Rule", destination: "https://shop.xn--bcher-kva.example/", expected: false},
+		{name: "Unicode Deny Rule Unicode Destination", destination: "https://shop.bücher.example/", expected: false},
+		{name: "Other Host", destination: "https://muenchen.example/", expected: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			// Destinations are stored in punycode form
+			normalized, err := NormalizeURL(tt.destination)
+			require.NoError(t, err)
+			destination, err := url.Parse(normalized)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rules.Allowed(destination))
+		})
+	}
+}
+
+func TestReadDomainRules_Invalid(t *testing.T) {
+	for _, line := range []string{
+		"deny",
+		"block evil.example",
+		"deny evil.example ^/a extra",
+		"deny *.*.example",
+		"deny ev*l.example",
+		"deny 10.0.0.0/33",
+		"deny shop.example (",
+		"deny -bücher.example",
+	} {
+		_, err := ReadDomainRules(strings.NewReader("# comment\n" + line))
+		assert.ErrorContains(t, err, "line 2", line)
+	}
+}
+
+func TestDomainPolicy_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(path, []byte("deny evil.example\n"), 0o644))
+	policy, err := LoadDomainPolicy(path)
+	require.NoError(t, err)
+	assert.False(t, policy.Allowed("https://evil.example/"))
+	assert.True(t, policy.Allowed("https://phish.example/"))
+
+	// Test case: An unchanged file is not reread
+	reloaded, err := policy.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// Test case: Changes take effect on reload
+	require.NoError(t, os.WriteFile(path, []byte("deny evil.example\ndeny phish.example\n"), 0o644))
+	reloaded, err = policy.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.False(t, policy.Allowed("https://phish.example/"))
+
+	// Test case: Broken rules keep the current ones in force
+	require.NoError(t, os.WriteFile(path, []byte("block phish.example\n"), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	_, err = policy.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, 2, policy.Len())
+	assert.False(t, policy.Allowed("https://phish.example/"))
+
+	// Test case: Missing files cannot be loaded
+	_, err = LoadDomainPolicy(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLookupTimeout bounds how long DestinationGuard waits for the resolver.
+const DefaultLookupTimeout = 2 * time.Second
+
+var (
+	// ErrInternalDestination is returned for destinations on loopback,
+	// private, link-local or otherwise internal addresses.
+	ErrInternalDestination = errors.New("destination is in an internal network")
+	// ErrShortenerDestination is returned for destinations on the shortener's
+	// own domains, which would redirect in a loop.
+	ErrShortenerDestination = errors.New("destination points back at the shortener")
+)
+
+// Resolver looks up the addresses of a host name. *net.Resolver implements it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error)
+}
+
+// internalPrefixes lists the ranges netip.Addr has no predicate for.
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // Reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which may embed any IPv4 address
+}
+
+// DestinationGuard rejects link destinations that could be used to reach
+// internal networks or to make the shortener redirect to itself. It checks
+// literal IP hosts, including the legacy numeric forms browsers accept, and the
+// addresses host names resolve to.
+type DestinationGuard struct {
+	resolver   Resolver
+	shortHosts []string
+	timeout    time.Duration
+}
+
+// NewDestinationGuard returns a guard resolving host names with resolver and
+// treating shortHosts, the domains short links are served on, as loops. A nil
+// resolver only checks literal IP hosts.
+func NewDestinationGuard(resolver Resolver, shortHosts []string) *DestinationGuard {
+	guard := &DestinationGuard{resolver: resolver, timeout: DefaultLookupTimeout}
+	for _, host := range shortHosts {
+		if host = normalizeHost(host); host != "" {
+			guard.shortHosts = append(guard.shortHosts, host)
+		}
+	}
+	return guard
+}
+
+// Check returns ErrShortenerDestination if rawURL is on one of the short hosts
+// or on requestHost, the host the shortener was reached on, and
+// ErrInternalDestination if its host is, or resolves to, an internal address.
+// Host names that fail to resolve are allowed: clients cannot reach them either.
+func (g *DestinationGuard) Check(ctx context.Context, rawURL string, requestHost string) error {
+	destination, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := normalizeHost(destination.Hostname())
+	if parsed, err := url.Parse("//" + requestHost); err == nil && requestHost != "" {
+		if host == normalizeHost(parsed.Hostname()) {
+			return ErrShortenerDestination
+		}
+	}
+	for _, shortHost := range g.shortHosts {
+		if host == shortHost {
+			return ErrShortenerDestination
+		}
+	}
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrInternalDestination
+	}
+	if addr, ok := parseIP(host); ok {
+		if IsInternalAddr(addr) {
+			return ErrInternalDestination
+		}
+		return nil
+	}
+	if g.resolver == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	addrs, err := g.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if IsInternalAddr(addr) {
+			return ErrInternalDestination
+		}
+	}
+	return nil
+}
+
+// IsInternalAddr reports whether addr is loopback, private, link-local,
+// multicast, unspecified or in another range not reachable on the internet.
+func IsInternalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP parses host as an IP address, accepting the legacy IPv4 forms that
+// browsers still resolve without DNS: one to four dot-separated parts in
+// decimal, octal (leading 0) or hex (leading 0x), such as 2130706433 or
+// 0x7f.1 for 127.0.0.1.
+func parseIP(host string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap(), true
+	}
+
+	parts := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		digits, base := part, 10
+		if rest, hex := strings.CutPrefix(strings.ToLower(part), "0x"); hex {
+			digits, base = rest, 16
+			if digits == "" {
+				digits = "0"
+			}
+		} else if len(part) > 1 && part[0] == '0' {
+			digits, base = part[1:], 8
+		}
+		value, err := strconv.ParseUint(digits, base, 32)
+		if err != nil || strings.ContainsAny(digits, "+-_") {
+			return netip.Addr{}, false
+		}
+		values[i] = value
+	}
+	// All parts but the last are single bytes; the last fills the remaining bytes
+	var ip uint64
+	for _, value := range values[:len(values)-1] {
+		if value > 0xff {
+			return netip.Addr{}, false
+		}
+		ip = ip<<8 | value
+	}
+	last := values[len(values)-1]
+	remaining := 4 - (len(values) - 1)
+	if last >= 1<<(8*remaining) {
+		return netip.Addr{}, false
+	}
+	ip = ip<<(8*remaining) | last
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), true
+}
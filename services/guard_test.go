@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeResolver resolves host names from a fixed table.
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	records, exists := r[host]
+	if !exists {
+		return nil, errors.New("no such host")
+	}
+	addrs := make([]netip.Addr, 0, len(records))
+	for _, record := range records {
+		addrs = append(addrs, netip.MustParseAddr(record))
+	}
+	return addrs, nil
+}
+
+func TestDestinationGuard(t *testing.T) {
+	guard := NewDestinationGuard(fakeResolver{
+		"www.example.com":     {"93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"},
+		"intranet.corp.com":   {"10.1.2.3"},
+		"rebind.example.com":  {"93.184.215.14", "127.0.0.1"},
+		"metadata.google.com": {"169.254.169.254"},
+	}, []string{"Sho.rt", ""})
+
+	tests := []struct {
+		name        string
+		url         string
+		expectedErr error
+	}{
+		{name: "Public Host", url: "https://www.example.com/page"},
+		{name: "Public IP", url: "http://8.8.8.8/"},
+		{name: "Unresolvable Host", url: "https://nx.example.com/"},
+		{name: "Loopback IP", url: "http://127.0.0.1:8080/", expectedErr: ErrInternalDestination},
+		{name: "Localhost", url: "http://localhost/", expectedErr: ErrInternalDestination},
+		{name: "Localhost Subdomain", url: "http://app.LOCALHOST./", expectedErr: ErrInternalDestination},
+		{name: "Cloud Metadata IP", url: "http://169.254.169.254/latest/meta-data/", expectedErr: ErrInternalDestination},
+		{name: "Private IP", url: "http://192.168.1.1/", expectedErr: ErrInternalDestination},
+		{name: "Carrier-Grade NAT", url: "http://100.64.0.1/", expectedErr: ErrInternalDestination},
+		{name: "Unspecified IP", url: "http://0.0.0.0/", expectedErr: ErrInternalDestination},
+		{name: "IPv6 Loopback", url: "http://[::1]/", expectedErr: ErrInternalDestination},
+		{name: "IPv6 Unique Local", url: "http://[fd12::1]/", expectedErr: ErrInternalDestination},
+		{name: "IPv4-Mapped Loopback", url: "http://[::ffff:127.0.0.1]/", expectedErr: ErrInternalDestination},
+		{name: "Decimal IP", url: "http://2130706433/", expectedErr: ErrInternalDestination},
+		{name: "Hex IP", url: "http://0x7f.1/", expectedErr: ErrInternalDestination},
+		{name: "Octal IP", url: "http://0300.0250.0.1/", expectedErr: ErrInternalDestination},
+		{name: "Host Resolving To Private IP", url: "https://intranet.corp.com/", expectedErr: ErrInternalDestination},
+		{name: "Host With Any Internal Address", url: "https://rebind.example.com/", expectedErr: ErrInternalDestination},
+		{name: "Host Resolving To Metadata IP", url: "http://metadata.google.com/", expectedErr: ErrInternalDestination},
+		{name: "Configured Short Domain", url: "https://sho.rt/abc123", expectedErr: ErrShortenerDestination},
+		{name: "Request Host", url: "http://links.example.org/abc123", expectedErr: ErrShortenerDestination},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			err := guard.Check(context.Background(), tt.url, "LINKS.example.org:8081")
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+
+	// Test case: Without a resolver only literal hosts are checked
+	assert.NoError(t, NewDestinationGuard(nil, nil).Check(context.Background(), "https://intranet.corp.com/", ""))
+	assert.ErrorIs(t, NewDestinationGuard(nil, nil).Check(context.Background(), "http://10.0.0.1/", ""), ErrInternalDestination)
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{host: "127.0.0.1", expected: "127.0.0.1"},
+		{host: "2130706433", expected: "127.0.0.1"},
+		{host: "0x7f000001", expected: "127.0.0.1"},
+		{host: "127.1", expected: "127.0.0.1"},
+		{host: "10.1.1", expected: "10.1.0.1"},
+		{host: "017700000001", expected: "127.0.0.1"},
+		{host: "0x.0.0.0", expected: "0.0.0.0"},
+		{host: "::ffff:10.0.0.1", expected: "10.0.0.1"},
+		{host: "example.com"},
+		{host: "256.1.1.1"},
+		{host: "1.2.3.4.5"},
+		{host: "4294967296"},
+		{host: "1_0.0.0.1"},
+		{host: "0b1"},
+		{host: "08.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.host, func(t *testing.T) {
+			addr, ok := parseIP(tt.host)
+			if tt.expected == "" {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, tt.expected, addr.String())
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// ErrMixedScript is returned for host names with a label mixing scripts,
+	// such as Latin and Cyrillic letters.
+	ErrMixedScript = errors.New("host name mixes scripts")
+	// ErrLookalikeHost is returned for host names imitating a protected brand
+	// with confusable characters.
+	ErrLookalikeHost = errors.New("host name imitates a protected brand")
+)
+
+// NormalizeURL returns rawURL with an internationalized host name converted to
+// its ASCII (punycode) form, as browsers resolve it, so bücher.de is stored as
+// xn--bcher-kva.de. URLs with ASCII hosts are returned unchanged.
+func NormalizeURL(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	host := parsed.Hostname()
+	if isASCII(host) {
+		return rawURL, nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	if port := parsed.Port(); port != "" {
+		parsed.Host = net.JoinHostPort(ascii, port)
+	} else {
+		parsed.Host = ascii
+	}
+	return parsed.String(), nil
+}
+
+// allowedScriptSets are the combinations of scripts a label may mix: Latin with
+// the scripts written alongside Han in Japanese, Chinese and Korean.
+var allowedScriptSets = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// confusables maps letters that look like Latin ones to the letter they
+// imitate. Accented letters and compatibility forms such as fullwidth letters
+// are reduced to their base letter by NFKD before the lookup.
+var confusables = map[rune]rune{
+	// Digits
+	'0': 'o', '1': 'l',
+	// Latin
+	'ı': 'i', 'ɩ': 'i', 'ȷ': 'j', 'ɑ': 'a', 'ɡ': 'g', 'ʀ': 'r', 'ʏ': 'y', 'ꞵ': 'b',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k', 'ӏ': 'l',
+	'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'г': 'r', 'ѕ': 's', 'т': 't', 'с': 'c',
+	'у': 'y', 'ԝ': 'w', 'х': 'x', 'ѡ': 'w', 'ь': 'b', 'ү': 'y', 'ҁ': 'c',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y', 'ω': 'w',
+	// Armenian
+	'օ': 'o', 'ս': 'u', 'հ': 'h', 'ո': 'n', 'ց': 'g', 'զ': 'q', 'ա': 'w',
+}
+
+// sequenceConfusables replaces letter pairs that read as a single Latin letter.
+var sequenceConfusables = strings.NewReplacer("rn", "m", "vv", "w")
+
+// HomographDetector finds host names meant to be mistaken for others: labels
+// mixing scripts, and labels that only look like a protected brand name.
+type HomographDetector struct {
+	brands map[string]string // Skeleton to brand name
+}
+
+// NewHomographDetector returns a detector protecting brands, such as "paypal",
+// from lookalike host names. Brands are matched against each label of a host,
+// and each hyphen-separated part of a label, ignoring case.
+func NewHomographDetector(brands []string) *HomographDetector {
+	detector := &HomographDetector{brands: make(map[string]string, len(brands))}
+	for _, brand := range brands {
+		if brand = strings.ToLower(strings.TrimSpace(brand)); brand != "" {
+			detector.brands[skeleton(brand)] = brand
+		}
+	}
+	return detector
+}
+
+// Check returns ErrMixedScript if a label of host mixes scripts that are not
+// normally written together, and ErrLookalikeHost if a label, or part of one,
+// looks like but is not one of the protected brands. host may be in Unicode or
+// punycode form.
+func (d *HomographDetector) Check(host string) error {
+	unicodeHost, err := idna.Punycode.ToUnicode(normalizeHost(host))
+	if err != nil {
+		return err
+	}
+	labels := strings.Split(unicodeHost, ".")
+	for _, label := range labels {
+		if mixesScripts(label) {
+			return ErrMixedScript
+		}
+	}
+	for _, label := range labels {
+		for _, part := range strings.Split(label, "-") {
+			if brand, exists := d.brands[skeleton(part)]; exists && part != brand {
+				return ErrLookalikeHost
+			}
+		}
+	}
+	return nil
+}
+
+// mixesScripts reports whether the letters of label come from more than one
+// script, other than an allowed combination. Digits and punctuation, which are
+// shared by all scripts, are ignored.
+func mixesScripts(label string) bool {
+	scripts := make(map[string]bool)
+	for _, r := range label {
+		if script := scriptOf(r); script != "" {
+			scripts[script] = true
+		}
+	}
+	if len(scripts) <= 1 {
+		return false
+	}
+	for _, set := range allowedScriptSets {
+		allowed := 0
+		for _, script := range set {
+			if scripts[script] {
+				allowed++
+			}
+		}
+		if allowed == len(scripts) {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptOf returns the name of the Unicode script of r, or "" for characters
+// shared by all scripts.
+func scriptOf(r rune) string {
+	if r < utf8.RuneSelf {
+		if unicode.IsLetter(r) {
+			return "Latin"
+		}
+		return ""
+	}
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// skeleton reduces s to the Latin letters it looks like, so strings that
+// would be confused with each other share a skeleton.
+func skeleton(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(strings.ToLower(s)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if mapped, exists := confusables[r]; exists {
+			r = mapped
+		}
+		b.WriteRune(r)
+	}
+	return sequenceConfusables.Replace(b.String())
+}
+
+// isASCII reports whether s contains only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		expected    string
+		expectError bool
+	}{
+		{name: "ASCII Host", url: "https://www.example.com/page?q=1", expected: "https://www.example.com/page?q=1"},
+		{name: "ASCII Host With Underscore", url: "https://my_host.example.com/", expected: "https://my_host.example.com/"},
+		{name: "Punycode Host", url: "https://xn--bcher-kva.de/", expected: "https://xn--bcher-kva.de/"},
+		{name: "Unicode Host", url: "https://bücher.de/katalog", expected: "https://xn--bcher-kva.de/katalog"},
+		{name: "Uppercase Unicode Host", url: "https://BÜCHER.de/", expected: "https://xn--bcher-kva.de/"},
+		{name: "Unicode Host With Port", url: "http://bücher.de:8080/", expected: "http://xn--bcher-kva.de:8080/"},
+		{name: "Cyrillic Lookalike", url: "https://pаypal.com/login", expected: "https://xn--pypal-4ve.com/login"},
+		{name: "Invalid Unicode Label", url: "https://-bücher.de/", expectError: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := NormalizeURL(tt.url)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, normalized)
+		})
+	}
+}
+
+func TestHomographDetector(t *testing.T) {
+	detector := NewHomographDetector([]string{"PayPal", " google ", ""})
+
+	tests := []struct {
+		name        string
+		host        string
+		expectedErr error
+	}{
+		{name: "Unrelated Host", host: "www.example.com"},
+		{name: "Protected Brand", host: "www.paypal.com"},
+		{name: "Protected Brand Subdomain", host: "accounts.google.com"},
+		{name: "Protected Brand Other TLD", host: "paypal.co.uk"},
+		{name: "Single Script Unicode Host", host: "bücher.de"},
+		{name: "Single Script Cyrillic Host", host: "пример.рф"},
+		{name: "Japanese Host", host: "ヤフーjapan漢字.jp"},
+		{name: "Latin Digits And Hyphens", host: "my-site-2.example.com"},
+		{name: "Cyrillic Letter In Latin Label", host: "pаypal.com", expectedErr: ErrMixedScript},
+		{name: "Punycode Mixed Script", host: "xn--pypal-4ve.com", expectedErr: ErrMixedScript},
+		{name: "Greek Letter In Latin Label", host: "gοogle.com", expectedErr: ErrMixedScript},
+		{name: "Lookalike Of Unprotected Brand", host: "аррӏе.com"},
+		{name: "All Cyrillic Brand Lookalike", host: "раураӏ.com", expectedErr: ErrLookalikeHost},
+		{name: "Digit Lookalike", host: "paypa1.com", expectedErr: ErrLookalikeHost},
+		{name: "Zero Lookalike", host: "g00gle.com", expectedErr: ErrLookalikeHost},
+		{name: "Near Miss", host: "googie.com"},
+		{name: "Accented Lookalike", host: "päypal.com", expectedErr: ErrLookalikeHost},
+		{name: "Fullwidth Lookalike", host: "ｐａｙｐａｌ.com", expectedErr: ErrLookalikeHost},
+		{name: "Lookalike In Hyphenated Label", host: "secure-paypa1-login.com", expectedErr: ErrLookalikeHost},
+		{name: "Lookalike Subdomain", host: "paypa1.example.com", expectedErr: ErrLookalikeHost},
+		{name: "Brand In Hyphenated Label", host: "paypal-community.com"},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			err := detector.Check(tt.host)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+
+	// Test case: Letter pairs reading as one letter imitate a brand
+	assert.ErrorIs(t, NewHomographDetector([]string{"microsoft"}).Check("rnicrosoft.com"), ErrLookalikeHost)
+	// Test case: Without protected brands only mixed scripts are detected
+	assert.NoError(t, NewHomographDetector(nil).Check("paypa1.com"))
+	assert.ErrorIs(t, NewHomographDetector(nil).Check("pаypal.com"), ErrMixedScript)
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+)
+
+// WarningPolicy decides which redirects show the interstitial warning page
+// instead of redirecting straight away. Implementations must be safe for
+// concurrent use.
+type WarningPolicy interface {
+	// Warning returns the reason to warn visitors about a redirect to
+	// destination, or "" to redirect straight away. flagged reports whether
+	// the link has been flagged as suspicious.
+	Warning(destination *url.URL, flagged bool) string
+}
+
+// Reasons given by AllowlistPolicy.
+const (
+	WarningFlagged  = "This link has been flagged as suspicious."
+	WarningExternal = "This link leads to a site outside the allowed list."
+)
+
+// AllowlistPolicy is the default WarningPolicy. It warns about flagged links
+// and, unless its allowlist is empty, about destinations on hosts outside it.
+type AllowlistPolicy struct {
+	hosts []string
+}
+
+// NewAllowlistPolicy returns a policy allowing hosts and their subdomains.
+// Matching ignores case.
+func NewAllowlistPolicy(hosts []string) *AllowlistPolicy {
+	policy := &AllowlistPolicy{}
+	for _, host := range hosts {
+		if host = normalizeHost(host); host != "" {
+			policy.hosts = append(policy.hosts, host)
+		}
+	}
+	return policy
+}
+
+// Warning implements WarningPolicy.
+func (p *AllowlistPolicy) Warning(destination *url.URL, flagged bool) string {
+	if flagged {
+		return WarningFlagged
+	}
+	if len(p.hosts) > 0 && !p.Allowed(destination.Hostname()) {
+		return WarningExternal
+	}
+	return ""
+}
+
+// Allowed reports whether host is on the allowlist or a subdomain of a host on it.
+func (p *AllowlistPolicy) Allowed(host string) bool {
+	host = normalizeHost(host)
+	for _, allowed := range p.hosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost lowercases host and drops surrounding space and a trailing dot.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowlistPolicy(t *testing.T) {
+	policy := NewAllowlistPolicy([]string{"Example.com", " docs.example.org. ", ""})
+
+	tests := []struct {
+		name        string
+		destination string
+		flagged     bool
+		expected    string
+	}{
+		{name: "Allowed Host", destination: "https://example.com/a", expected: ""},
+		{name: "Allowed Subdomain", destination: "https://WWW.example.com./a", expected: ""},
+		{name: "Allowed Host With Port", destination: "https://docs.example.org:8443/", expected: ""},
+		{name: "Lookalike Suffix", destination: "https://badexample.com/", expected: WarningExternal},
+		{name: "Parent Of Allowed Host", destination: "https://example.org/", expected: WarningExternal},
+		{name: "Flagged Allowed Host", destination: "https://example.com/", flagged: true, expected: WarningFlagged},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := url.Parse(tt.destination)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, policy.Warning(destination, tt.flagged))
+		})
+	}
+
+	// Test case: Without an allowlist only flagged links are warned about
+	destination, _ := url.Parse("https://anywhere.net/")
+	assert.Equal(t, "", NewAllowlistPolicy(nil).Warning(destination, false))
+	assert.Equal(t, WarningFlagged, NewAllowlistPolicy(nil).Warning(destination, true))
+}
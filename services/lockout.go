@@ -0,0 +1,147 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults for NewLockout: five failed password attempts lock a link for 15 minutes.
+const (
+	DefaultMaxAttempts = 5
+	DefaultLockout     = 15 * time.Minute
+)
+
+// pendingRetry is how long Attempt asks callers to wait while every attempt
+// left for a key is still being checked, which takes about one bcrypt comparison.
+const pendingRetry = time.Second
+
+// Lockout counts password attempts per key, such as a short code, and locks
+// the key once too many fail. An attempt is reserved before the password is
+// checked and counts against the limit until it fails or is released, so
+// concurrent guesses cannot exceed it. Failures older than the lockout
+// duration are forgotten, and a lock lifts on its own once it runs out. Counts
+// are kept in memory, so every server process has its own.
+type Lockout struct {
+	mu          sync.Mutex
+	maxAttempts int
+	duration    time.Duration
+	keys        map[string]*attempts
+	lastPrune   time.Time
+	now         func() time.Time
+}
+
+// attempts tracks the recent failures for one key.
+type attempts struct {
+	failures    int
+	pending     int // Attempts reserved but not yet failed or released
+	lastAttempt time.Time
+	lockedUntil time.Time
+}
+
+// NewLockout returns a Lockout that locks a key for duration after maxAttempts
+// failures. maxAttempts must be positive.
+func NewLockout(maxAttempts int, duration time.Duration) *Lockout {
+	return &Lockout{
+		maxAttempts: maxAttempts,
+		duration:    duration,
+		keys:        make(map[string]*attempts),
+		now:         time.Now,
+	}
+}
+
+// Locked returns how long key stays locked, or 0 if it may be tried.
+func (l *Lockout) Locked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, exists := l.keys[key]
+	if !exists {
+		return 0
+	}
+	return max(entry.lockedUntil.Sub(l.now()), 0)
+}
+
+// Attempt reserves an attempt for key before its password is checked. It
+// returns 0 if the attempt may go ahead, in which case the caller must follow
+// up with Fail or Release. Otherwise it returns how long to wait: the rest of
+// the lock if key is locked, or pendingRetry if the failed and pending
+// attempts already reach the limit. Refused attempts do not lock key.
+func (l *Lockout) Attempt(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+	entry, exists := l.keys[key]
+	if exists {
+		if wait := entry.lockedUntil.Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	if !exists {
+		entry = &attempts{}
+		l.keys[key] = entry
+	}
+	if now.Sub(entry.lastAttempt) > l.duration {
+		entry.failures = 0
+	}
+	if entry.failures+entry.pending >= l.maxAttempts {
+		return pendingRetry
+	}
+	entry.pending++
+	entry.lastAttempt = now
+	return 0
+}
+
+// Fail confirms that an attempt reserved for key failed. It returns how long
+// key is now locked, or 0 if attempts remain.
+func (l *Lockout) Fail(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, exists := l.keys[key]
+	if !exists || entry.pending == 0 {
+		return 0
+	}
+	now := l.now()
+	entry.pending--
+	entry.failures++
+	entry.lastAttempt = now
+	if entry.failures < l.maxAttempts {
+		return 0
+	}
+	return l.lock(entry, now)
+}
+
+// Release gives back an attempt reserved for key once it succeeded. Failures
+// of other attempts stay counted until they are forgotten.
+func (l *Lockout) Release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry, exists := l.keys[key]; exists && entry.pending > 0 {
+		entry.pending--
+	}
+}
+
+// lock locks entry for the lockout duration from now and returns the duration.
+func (l *Lockout) lock(entry *attempts, now time.Time) time.Duration {
+	entry.failures = 0
+	entry.lockedUntil = now.Add(l.duration)
+	return l.duration
+}
+
+// prune drops keys that are neither locked nor have recent or pending attempts,
+// at most once per lockout duration, so guessing many codes cannot grow the map
+// forever.
+func (l *Lockout) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.duration {
+		return
+	}
+	l.lastPrune = now
+	for key, entry := range l.keys {
+		if entry.pending == 0 && now.Sub(entry.lastAttempt) > l.duration && !entry.lockedUntil.After(now) {
+			delete(l.keys, key)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockout(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	lockout := NewLockout(3, time.Minute)
+	lockout.now = func() time.Time { return now }
+
+	// fail reserves an attempt for key and fails it
+	fail := func(key string) time.Duration {
+		if wait := lockout.Attempt(key); wait > 0 {
+			return wait
+		}
+		return lockout.Fail(key)
+	}
+
+	// Test case: Keys lock after maxAttempts failures
+	assert.Equal(t, time.Duration(0), fail("abc123"))
+	assert.Equal(t, time.Duration(0), fail("abc123"))
+	assert.Equal(t, time.Duration(0), lockout.Locked("abc123"))
+	assert.Equal(t, time.Minute, fail("abc123"))
+	assert.Equal(t, time.Minute, lockout.Locked("abc123"))
+	assert.Equal(t, time.Minute, lockout.Attempt("abc123"), "Locked keys refuse attempts")
+
+	// Test case: Other keys are unaffected
+	assert.Equal(t, time.Duration(0), lockout.Locked("xyz789"))
+
+	// Test case: The lock lifts once it runs out
+	now = now.Add(40 * time.Second)
+	assert.Equal(t, 20*time.Second, lockout.Locked("abc123"))
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, time.Duration(0), lockout.Locked("abc123"))
+
+	// Test case: A success gives back its own attempt, but not earlier failures
+	fail("abc123")
+	assert.Equal(t, time.Duration(0), lockout.Attempt("abc123"))
+	lockout.Release("abc123")
+	assert.Equal(t, time.Duration(0), fail("abc123"))
+	assert.Equal(t, time.Minute, fail("abc123"))
+
+	// Test case: Failures older than the lockout duration are forgotten
+	now = now.Add(2 * time.Minute)
+	fail("abc123")
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, time.Duration(0), fail("abc123"))
+	assert.Equal(t, time.Duration(0), fail("abc123"))
+	assert.Equal(t, time.Minute, fail("abc123"))
+}
+
+func TestLockout_PendingAttempts(t *testing.T) {
+	lockout := NewLockout(3, time.Minute)
+
+	// Test case: Attempts still being checked count against the limit, but do not lock
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.Duration(0), lockout.Attempt("abc123"))
+	}
+	assert.Equal(t, pendingRetry, lockout.Attempt("abc123"))
+	assert.Equal(t, time.Duration(0), lockout.Locked("abc123"))
+	lockout.Release("abc123")
+	assert.Equal(t, time.Duration(0), lockout.Attempt("abc123"), "A released attempt should be available again")
+
+	// Test case: Only failed attempts lock
+	assert.Equal(t, time.Duration(0), lockout.Fail("abc123"))
+	assert.Equal(t, time.Duration(0), lockout.Fail("abc123"))
+	assert.Equal(t, time.Minute, lockout.Fail("abc123"))
+
+	// Test case: Concurrent attempts are bounded by the limit
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lockout.Attempt("xyz789") == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, allowed)
+}
+
+func TestLockout_ConcurrentSuccesses(t *testing.T) {
+	lockout := NewLockout(5, time.Minute)
+
+	// Test case: More concurrent right passwords than attempts never lock the key
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	refused := 0
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lockout.Attempt("abc123") > 0 {
+				mu.Lock()
+				refused++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, refused)
+	assert.Equal(t, time.Duration(0), lockout.Locked("abc123"))
+	for i := 0; i < 5; i++ {
+		lockout.Release("abc123")
+	}
+	assert.Equal(t, time.Duration(0), lockout.Locked("abc123"))
+	assert.Equal(t, time.Duration(0), lockout.Attempt("abc123"))
+}
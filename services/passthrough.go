@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Query passthrough modes, stored per link. The empty mode drops the incoming
+// query string.
+const (
+	// QueryModeMerge adds incoming parameters the destination does not set;
+	// the destination's own values win.
+	QueryModeMerge = "merge"
+	// QueryModeOverride adds every incoming parameter, replacing all destination
+	// values of the same name.
+	QueryModeOverride = "override"
+)
+
+// ErrInvalidQueryMode is returned by ParseQueryMode for unknown modes.
+var ErrInvalidQueryMode = errors.New("query mode must be none, merge or override")
+
+// ErrInvalidPath is returned by Destination for path suffixes hiding a dot
+// segment behind an escaped slash or backslash, or a ";" parameter, which the
+// destination server might resolve.
+var ErrInvalidPath = errors.New("path suffix hides a dot segment")
+
+// ParseQueryMode validates a query mode from a request. "none" is accepted as
+// an explicit spelling of the empty mode.
+func ParseQueryMode(mode string) (string, error) {
+	switch mode {
+	case "", "none":
+		return "", nil
+	case QueryModeMerge, QueryModeOverride:
+		return mode, nil
+	}
+	return "", ErrInvalidQueryMode
+}
+
+// Destination returns the URL a link to longURL redirects to when requested
+// with the escaped path suffix (after the short code, "" or starting with "/")
+// and the raw query string rawQuery. The suffix is appended to the destination
+// path with dot segments, escaped or not, removed, and the query is combined per
+// queryMode. Path segments and parameters keep their original order and encoding.
+func Destination(longURL string, suffix string, rawQuery string, queryMode string) (string, error) {
+	if suffix == "" && (rawQuery == "" || queryMode == "") {
+		return longURL, nil
+	}
+	destination, err := url.Parse(longURL)
+	if err != nil {
+		return "", err
+	}
+
+	if suffix != "" {
+		cleaned, err := cleanSuffix(suffix)
+		if err != nil {
+			return "", err
+		}
+		rawPath := strings.TrimSuffix(destination.EscapedPath(), "/") + cleaned
+		unescaped, err := url.PathUnescape(rawPath)
+		if err != nil {
+			return "", err
+		}
+		destination.Path, destination.RawPath = unescaped, rawPath
+	}
+
+	if rawQuery != "" && queryMode != "" {
+		destination.RawQuery = mergeQuery(destination.RawQuery, rawQuery, queryMode == QueryModeOverride)
+	}
+	return destination.String(), nil
+}
+
+// cleanSuffix removes the dot segments of the escaped path suffix, comparing
+// segments unescaped, so %2e%2e goes up a level within the suffix like .. does
+// and never above it. Escaping is otherwise kept.
+func cleanSuffix(suffix string) (string, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(suffix, "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case unescaped == "" || unescaped == ".":
+		case unescaped == "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		case hidesDotSegment(unescaped):
+			return "", ErrInvalidPath
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	cleaned := "/" + strings.Join(segments, "/")
+	if strings.HasSuffix(suffix, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+// hidesDotSegment reports whether the unescaped path segment contains a dot
+// segment that servers splitting on backslashes or decoded slashes, or ignoring
+// ";" parameters, would resolve.
+func hidesDotSegment(segment string) bool {
+	parts := strings.FieldsFunc(segment, func(r rune) bool { return r == '/' || r == '\\' })
+	for _, part := range parts {
+		if name, _, _ := strings.Cut(part, ";"); name == "." || name == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeQuery combines the raw query strings of the destination and the request,
+// destination parameters first. When a name occurs in both, the destination's
+// values are kept, or with override the incoming ones.
+func mergeQuery(destination string, incoming string, override bool) string {
+	winners := destination
+	if override {
+		winners = incoming
+	}
+	taken := make(map[string]bool)
+	for _, pair := range splitQuery(winners) {
+		taken[queryName(pair)] = true
+	}
+	var merged []string
+	for _, pair := range splitQuery(destination) {
+		if !override || !taken[queryName(pair)] {
+			merged = append(merged, pair)
+		}
+	}
+	for _, pair := range splitQuery(incoming) {
+		if override || !taken[queryName(pair)] {
+			merged = append(merged, pair)
+		}
+	}
+	return strings.Join(merged, "&")
+}
+
+// RemoveQueryParam removes the parameters called name from a raw query string,
+// leaving the others, their order and their encoding untouched.
+func RemoveQueryParam(rawQuery string, name string) string {
+	var kept []string
+	for _, pair := range splitQuery(rawQuery) {
+		if queryName(pair) != name {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// splitQuery returns the non-empty name=value pairs of a raw query string.
+func splitQuery(rawQuery string) []string {
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// queryName returns the unescaped name of a raw name=value pair.
+func queryName(pair string) string {
+	name, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
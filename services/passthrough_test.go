@@ -0,0 +1,175 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDestination(t *testing.T) {
+	tests := []struct {
+		name      string
+		longURL   string
+		suffix    string
+		rawQuery  string
+		queryMode string
+		expected  string
+	}{
+		{
+			name:     "No Passthrough",
+			longURL:  "https://example.com/docs?ref=short",
+			rawQuery: "utm_source=mail",
+			expected: "https://example.com/docs?ref=short",
+		},
+		{
+			name:      "Merge Adds New Parameters",
+			longURL:   "https://example.com/docs?ref=short",
+			rawQuery:  "utm_source=mail&utm_medium=email",
+			queryMode: QueryModeMerge,
+			expected:  "https://example.com/docs?ref=short&utm_source=mail&utm_medium=email",
+		},
+		{
+			name:      "Merge Keeps Destination Values",
+			longURL:   "https://example.com/?utm_source=site&a=1",
+			rawQuery:  "utm_source=mail&b=2",
+			queryMode: QueryModeMerge,
+			expected:  "https://example.com/?utm_source=site&a=1&b=2",
+		},
+		{
+			name:      "Override Replaces Destination Values",
+			longURL:   "https://example.com/?tag=x&tag=y&a=1",
+			rawQuery:  "tag=z&b=2",
+			queryMode: QueryModeOverride,
+			expected:  "https://example.com/?a=1&tag=z&b=2",
+		},
+		{
+			name:      "Names Are Compared Unescaped",
+			longURL:   "https://example.com/?a%20b=1",
+			rawQuery:  "a+b=2",
+			queryMode: QueryModeMerge,
+			expected:  "https://example.com/?a%20b=1",
+		},
+		{
+			name:      "Fragment Stays Last",
+			longURL:   "https://example.com/page#top",
+			rawQuery:  "q=1",
+			queryMode: QueryModeMerge,
+			expected:  "https://example.com/page?q=1#top",
+		},
+		{
+			name:     "Path Suffix",
+			longURL:  "https://example.com/docs",
+			suffix:   "/guide/intro",
+			expected: "https://example.com/docs/guide/intro",
+		},
+		{
+			name:     "Path Suffix After Trailing Slash",
+			longURL:  "https://example.com/docs/",
+			suffix:   "/guide/",
+			expected: "https://example.com/docs/guide/",
+		},
+		{
+			name:     "Dot Segments Are Removed",
+			longURL:  "https://example.com/docs",
+			suffix:   "/a/../../b",
+			expected: "https://example.com/docs/b",
+		},
+		{
+			name:     "Escaped Dot Segments Are Removed",
+			longURL:  "https://e.com/docs/",
+			suffix:   "/%2e%2e/admin",
+			expected: "https://e.com/docs/admin",
+		},
+		{
+			name:     "Mixed Case Escaped Dot Segments Are Removed",
+			longURL:  "https://e.com/docs",
+			suffix:   "/a/.%2E/%2E./b/%2e",
+			expected: "https://e.com/docs/b",
+		},
+		{
+			name:     "Empty Segments Are Removed",
+			longURL:  "https://e.com/docs",
+			suffix:   "//a//b/",
+			expected: "https://e.com/docs/a/b/",
+		},
+		{
+			name:     "Escaping Is Kept",
+			longURL:  "https://example.com",
+			suffix:   "/a%2Fb/c%20d",
+			expected: "https://example.com/a%2Fb/c%20d",
+		},
+		{
+			name:      "Path And Query",
+			longURL:   "https://example.com/docs?v=2",
+			suffix:    "/api",
+			rawQuery:  "lang=de",
+			queryMode: QueryModeOverride,
+			expected:  "https://example.com/docs/api?v=2&lang=de",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := Destination(tt.longURL, tt.suffix, tt.rawQuery, tt.queryMode)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, destination)
+		})
+	}
+
+	// Test case: Dot segments hidden from the cleanup are refused
+	for _, suffix := range []string{"/..%2Fadmin", "/%2e%2e%2fadmin", "/..%5Cadmin", "/a/..;/admin", "/x%2F.%2F..%2Fadmin"} {
+		_, err := Destination("https://e.com/docs/", suffix, "", "")
+		assert.ErrorIs(t, err, ErrInvalidPath, suffix)
+	}
+}
+
+func TestParseQueryMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected string
+		valid    bool
+	}{
+		{mode: "", expected: "", valid: true},
+		{mode: "none", expected: "", valid: true}, // Test case: Explicit spelling of the default
+		{mode: "merge", expected: QueryModeMerge, valid: true},
+		{mode: "override", expected: QueryModeOverride, valid: true},
+		{mode: "Merge", valid: false},
+		{mode: "append", valid: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.mode, func(t *testing.T) {
+			mode, err := ParseQueryMode(tt.mode)
+			if !tt.valid {
+				assert.ErrorIs(t, err, ErrInvalidQueryMode)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, mode)
+		})
+	}
+}
+
+func TestRemoveQueryParam(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawQuery string
+		expected string
+	}{
+		{name: "Empty", rawQuery: "", expected: ""},
+		{name: "Absent", rawQuery: "q=a+b&sig=x%2Fy", expected: "q=a+b&sig=x%2Fy"},
+		{name: "Only Parameter", rawQuery: "confirm=1", expected: ""},
+		{name: "Encoding And Order Kept", rawQuery: "b=%7E&confirm=1&a=x+y&b=2", expected: "b=%7E&a=x+y&b=2"},
+		{name: "Every Occurrence", rawQuery: "confirm=1&x=&confirm&%63onfirm=2", expected: "x="},
+		{name: "Similar Names Kept", rawQuery: "confirmed=1&confirm[]=2", expected: "confirmed=1&confirm[]=2"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, RemoveQueryParam(tt.rawQuery, "confirm"))
+		})
+	}
+}
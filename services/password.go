@@ -0,0 +1,31 @@
+package services
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxPasswordLength is the longest link password in bytes; bcrypt ignores anything past it.
+const MaxPasswordLength = 72
+
+// ErrInvalidPassword is returned by HashPassword for empty or overlong passwords.
+var ErrInvalidPassword = errors.New("password must be between 1 and 72 bytes long")
+
+// HashPassword returns a salted bcrypt hash of password for storing with a link.
+// bcrypt is deliberately slow, so hashes leaked from the store resist guessing.
+func HashPassword(password string) (string, error) {
+	if password == "" || len(password) > MaxPasswordLength {
+		return "", ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches a hash from HashPassword.
+func CheckPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("open sesame")
+	assert.NoError(t, err)
+	assert.NotContains(t, hash, "open sesame", "The password should not be stored in the clear")
+
+	// Test case: Only the right password matches
+	assert.True(t, CheckPassword(hash, "open sesame"))
+	assert.False(t, CheckPassword(hash, "open sesame!"))
+	assert.False(t, CheckPassword(hash, ""))
+
+	// Test case: Hashes are salted
+	again, err := HashPassword("open sesame")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, again)
+
+	// Test case: Empty and overlong passwords are rejected
+	_, err = HashPassword("")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+	_, err = HashPassword(strings.Repeat("x", MaxPasswordLength+1))
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+}
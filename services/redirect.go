@@ -0,0 +1,19 @@
+package services
+
+import "net/http"
+
+// IsValidRedirectCode reports whether code is a status links may redirect with:
+// 301 or 308 for permanent links, 302 or 307 for temporary ones. 307 and 308
+// make clients repeat the original method and body.
+func IsValidRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// IsPermanentRedirect reports whether clients may cache a redirect with code.
+func IsPermanentRedirect(code int) bool {
+	return code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
+}
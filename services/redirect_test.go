@@ -0,0 +1,32 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectCodes(t *testing.T) {
+	tests := []struct {
+		code      int
+		valid     bool
+		permanent bool
+	}{
+		{code: 301, valid: true, permanent: true},
+		{code: 302, valid: true, permanent: false},
+		{code: 307, valid: true, permanent: false},
+		{code: 308, valid: true, permanent: true},
+		{code: 0, valid: false},   // Test case: Unset codes are resolved by the caller
+		{code: 303, valid: false}, // Test case: See Other turns every request into a GET
+		{code: 200, valid: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(strconv.Itoa(tt.code), func(t *testing.T) {
+			assert.Equal(t, tt.valid, IsValidRedirectCode(tt.code))
+			assert.Equal(t, tt.permanent, IsPermanentRedirect(tt.code))
+		})
+	}
+}
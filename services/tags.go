@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+)
+
+// MaxTags caps the number of query parameters a link may append to its destination.
+const MaxTags = 20
+
+// ErrInvalidTags is returned by CampaignTags for unusable tag sets.
+var ErrInvalidTags = errors.New("tags must have non-empty, unique names and at most 20 entries")
+
+// CampaignTags combines the UTM fields of a request with its extra parameters
+// into the tag set stored with a link. Empty UTM fields are left out, and an
+// extra parameter may not repeat a UTM field that is set. nil is returned when
+// there are no tags.
+func CampaignTags(source string, medium string, campaign string, params map[string]string) (map[string]string, error) {
+	tags := make(map[string]string, len(params)+3)
+	for name, value := range params {
+		if name == "" {
+			return nil, ErrInvalidTags
+		}
+		tags[name] = value
+	}
+	for _, utm := range []struct{ name, value string }{
+		{"utm_source", source},
+		{"utm_medium", medium},
+		{"utm_campaign", campaign},
+	} {
+		if utm.value == "" {
+			continue
+		}
+		if _, exists := tags[utm.name]; exists {
+			return nil, ErrInvalidTags
+		}
+		tags[utm.name] = utm.value
+	}
+	if len(tags) > MaxTags {
+		return nil, ErrInvalidTags
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	return tags, nil
+}
+
+// EncodeTags returns tags as a query string sorted by name, or "" for no tags.
+func EncodeTags(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for name, value := range tags {
+		values.Set(name, value)
+	}
+	return values.Encode()
+}
+
+// DecodeTags parses a query string written by EncodeTags. nil is returned for "".
+func DecodeTags(encoded string) (map[string]string, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(encoded)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(values))
+	for name := range values {
+		tags[name] = values.Get(name)
+	}
+	return tags, nil
+}
+
+// DedupKey identifies a destination for duplicate detection: the long URL, or
+// with tags the long URL and its encoded tags, so every campaign for the same
+// destination gets its own link. URLs cannot contain the newline separating them.
+func DedupKey(longURL string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return longURL
+	}
+	return longURL + "\n" + EncodeTags(tags)
+}
+
+// TaggedURL returns longURL with tags set in its query string. Tags replace
+// destination parameters of the same name and follow the remaining ones,
+// sorted by name.
+func TaggedURL(longURL string, tags map[string]string) (string, error) {
+	if len(tags) == 0 {
+		return longURL, nil
+	}
+	destination, err := url.Parse(longURL)
+	if err != nil {
+		return "", err
+	}
+	destination.RawQuery = mergeQuery(destination.RawQuery, EncodeTags(tags), true)
+	return destination.String(), nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCampaignTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		medium      string
+		campaign    string
+		params      map[string]string
+		expected    map[string]string
+		expectedErr error
+	}{
+		{
+			name:     "UTM Fields",
+			source:   "newsletter",
+			medium:   "email",
+			campaign: "spring",
+			expected: map[string]string{"utm_source": "newsletter", "utm_medium": "email", "utm_campaign": "spring"},
+		},
+		{
+			name:     "Extra Parameters",
+			source:   "newsletter",
+			params:   map[string]string{"ref": "partner", "utm_term": "shoes"},
+			expected: map[string]string{"utm_source": "newsletter", "ref": "partner", "utm_term": "shoes"},
+		},
+		{
+			name:     "No Tags",
+			expected: nil,
+		},
+		{
+			name:        "Empty Parameter Name",
+			params:      map[string]string{"": "x"},
+			expectedErr: ErrInvalidTags,
+		},
+		{
+			name:        "Parameter Repeats UTM Field",
+			source:      "newsletter",
+			params:      map[string]string{"utm_source": "blog"},
+			expectedErr: ErrInvalidTags,
+		},
+		{
+			name:        "Too Many Tags",
+			params:      manyTags(MaxTags + 1),
+			expectedErr: ErrInvalidTags,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			tags, err := CampaignTags(tt.source, tt.medium, tt.campaign, tt.params)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, tags)
+		})
+	}
+}
+
+func TestTaggedURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		longURL  string
+		tags     map[string]string
+		expected string
+	}{
+		{
+			name:     "No Tags",
+			longURL:  "https://example.com/docs?ref=short",
+			expected: "https://example.com/docs?ref=short",
+		},
+		{
+			name:     "Tags Sorted After Destination Parameters",
+			longURL:  "https://example.com/docs?ref=short",
+			tags:     map[string]string{"utm_source": "news letter", "utm_medium": "email"},
+			expected: "https://example.com/docs?ref=short&utm_medium=email&utm_source=news+letter",
+		},
+		{
+			name:     "Tags Replace Destination Parameters",
+			longURL:  "https://example.com/?utm_source=site&a=1",
+			tags:     map[string]string{"utm_source": "newsletter"},
+			expected: "https://example.com/?a=1&utm_source=newsletter",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			tagged, err := TaggedURL(tt.longURL, tt.tags)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, tagged)
+		})
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	// Test case: Untagged links are keyed by their long URL
+	assert.Equal(t, "https://example.com", DedupKey("https://example.com", nil))
+
+	// Test case: Tag order does not matter, tag values do
+	a := DedupKey("https://example.com", map[string]string{"utm_source": "x", "utm_medium": "y"})
+	b := DedupKey("https://example.com", map[string]string{"utm_medium": "y", "utm_source": "x"})
+	c := DedupKey("https://example.com", map[string]string{"utm_source": "z", "utm_medium": "y"})
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+	assert.NotEqual(t, "https://example.com", a)
+
+	// Test case: Encoded tags round-trip
+	tags := map[string]string{"utm_source": "news letter", "ref": "a&b"}
+	decoded, err := DecodeTags(EncodeTags(tags))
+	assert.NoError(t, err)
+	assert.Equal(t, tags, decoded)
+}
+
+// manyTags returns n distinct extra parameters.
+func manyTags(n int) map[string]string {
+	tags := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		tags[string(rune('a'+i))] = "x"
+	}
+	return tags
+}
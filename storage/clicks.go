@@ -0,0 +1,356 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Codedude1/shorty/analytics"
+	"github.com/Codedude1/shorty/models"
+)
+
+// Click count granularities accepted by ClickSeries.
+const (
+	GranularityMinute = "minute"
+	GranularityHour   = "hour"
+	GranularityDay    = "day"
+)
+
+// MaxClickBuckets caps how many buckets a single ClickSeries call may return.
+const MaxClickBuckets = 1440
+
+// maxBreakdownValues caps the distinct values kept per link and breakdown
+// dimension. Clicks with further values are counted as analytics.ValueOther,
+// so a link shared on many sites cannot grow its breakdowns without bound.
+const maxBreakdownValues = 1000
+
+// clickPruneInterval is how often CleanupExpiredURLs drops buckets past their retention.
+const clickPruneInterval = 10 * time.Minute
+
+// ErrInvalidSeries is returned by ClickSeries for unknown granularities and bad ranges.
+var ErrInvalidSeries = errors.New("invalid click series")
+
+// clickGranularity describes one level of click rollups.
+type clickGranularity struct {
+	name string
+	// size is the width of a bucket; buckets start at multiples of size in UTC.
+	size time.Duration
+	// retention is how long a bucket is kept after it ends.
+	retention time.Duration
+}
+
+// clickGranularities lists every rollup level, finest first. Each click is
+// counted once at every level, so any granularity is answered without
+// aggregating finer buckets.
+var clickGranularities = []clickGranularity{
+	{name: GranularityMinute, size: time.Minute, retention: 48 * time.Hour},
+	{name: GranularityHour, size: time.Hour, retention: 90 * 24 * time.Hour},
+	{name: GranularityDay, size: 24 * time.Hour, retention: 400 * 24 * time.Hour},
+}
+
+// findGranularity returns the rollup level called name.
+func findGranularity(name string) (clickGranularity, bool) {
+	for _, g := range clickGranularities {
+		if g.name == name {
+			return g, true
+		}
+	}
+	return clickGranularity{}, false
+}
+
+// ClickRetention returns how long click counts of granularity are kept.
+func ClickRetention(granularity string) time.Duration {
+	g, _ := findGranularity(granularity)
+	return g.retention
+}
+
+// seriesBuckets validates a ClickSeries request and returns the start of every
+// bucket of granularity overlapping [from, to), in order.
+func seriesBuckets(granularity string, from time.Time, to time.Time) (clickGranularity, []time.Time, error) {
+	g, ok := findGranularity(granularity)
+	if !ok {
+		return g, nil, fmt.Errorf("%w: unknown granularity %q", ErrInvalidSeries, granularity)
+	}
+	if !from.Before(to) {
+		return g, nil, fmt.Errorf("%w: from must be before to", ErrInvalidSeries)
+	}
+	first := from.UTC().Truncate(g.size)
+	count := int((to.Sub(first) + g.size - 1) / g.size)
+	if count > MaxClickBuckets {
+		return g, nil, fmt.Errorf("%w: %d buckets exceed the limit of %d", ErrInvalidSeries, count, MaxClickBuckets)
+	}
+	starts := make([]time.Time, count)
+	for i := range starts {
+		starts[i] = first.Add(time.Duration(i) * g.size)
+	}
+	return g, starts, nil
+}
+
+// humanClicks returns the events not classified as bots, which are all that
+// rollups, visitor sketches and breakdowns are built from.
+func humanClicks(events []models.ClickEvent) []models.ClickEvent {
+	humans := make([]models.ClickEvent, 0, len(events))
+	for _, event := range events {
+		if !event.Bot {
+			humans = append(humans, event)
+		}
+	}
+	return humans
+}
+
+// granularityTotal keys the lifetime rollup of a link. It is never pruned and
+// cannot be requested through ClickSeries.
+const granularityTotal = "total"
+
+// clickCountKey identifies one bucket of one link.
+type clickCountKey struct {
+	granularity string
+	start       int64 // Unix seconds
+}
+
+// clickBucketKeys returns the buckets a click at at is counted in: one per
+// granularity, plus the lifetime rollup.
+func clickBucketKeys(at time.Time) []clickCountKey {
+	keys := make([]clickCountKey, 0, len(clickGranularities)+1)
+	for _, g := range clickGranularities {
+		keys = append(keys, clickCountKey{granularity: g.name, start: at.UTC().Truncate(g.size).Unix()})
+	}
+	return append(keys, clickCountKey{granularity: granularityTotal})
+}
+
+// clickBucket is the rollup of one bucket: the number of clicks and a sketch
+// of the visitors behind them.
+type clickBucket struct {
+	count    int64
+	visitors analytics.Sketch
+}
+
+// breakdownCounts holds the clicks per value of each breakdown dimension of a link.
+type breakdownCounts map[string]map[string]int64
+
+// clickCounts holds click rollups and breakdowns in memory for the map-based stores.
+type clickCounts struct {
+	mu         sync.Mutex
+	links      map[string]map[clickCountKey]*clickBucket
+	breakdowns map[string]breakdownCounts
+	prunedAt   time.Time
+}
+
+// newClickCounts returns an empty set of click rollups.
+func newClickCounts() *clickCounts {
+	return &clickCounts{
+		links:      make(map[string]map[clickCountKey]*clickBucket),
+		breakdowns: make(map[string]breakdownCounts),
+	}
+}
+
+// addBreakdownLocked adds count clicks with value to one dimension of shortCode,
+// folding new values into analytics.ValueOther once the dimension is full.
+// Callers must hold cc.mu.
+func (cc *clickCounts) addBreakdownLocked(shortCode string, dimension string, value string, count int64) {
+	breakdowns, exists := cc.breakdowns[shortCode]
+	if !exists {
+		breakdowns = make(breakdownCounts)
+		cc.breakdowns[shortCode] = breakdowns
+	}
+	values, exists := breakdowns[dimension]
+	if !exists {
+		values = make(map[string]int64)
+		breakdowns[dimension] = values
+	}
+	if _, known := values[value]; !known && len(values) >= maxBreakdownValues {
+		value = analytics.ValueOther
+	}
+	values[value] += count
+}
+
+// bucketLocked returns the bucket key of shortCode, creating it if needed. Callers must hold cc.mu.
+func (cc *clickCounts) bucketLocked(shortCode string, key clickCountKey) *clickBucket {
+	buckets, exists := cc.links[shortCode]
+	if !exists {
+		buckets = make(map[clickCountKey]*clickBucket)
+		cc.links[shortCode] = buckets
+	}
+	bucket, exists := buckets[key]
+	if !exists {
+		bucket = &clickBucket{}
+		buckets[key] = bucket
+	}
+	return bucket
+}
+
+// add counts event in every bucket it falls in.
+func (cc *clickCounts) add(event models.ClickEvent) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for _, key := range clickBucketKeys(event.AccessedAt) {
+		bucket := cc.bucketLocked(event.ShortCode, key)
+		bucket.count++
+		if event.VisitorID != "" {
+			bucket.visitors.Add(event.VisitorID)
+		}
+	}
+	for i, value := range analytics.Classify(event) {
+		cc.addBreakdownLocked(event.ShortCode, analytics.Dimensions[i], value, 1)
+	}
+}
+
+// setBreakdown restores a single breakdown value, as read back from a snapshot.
+func (cc *clickCounts) setBreakdown(record breakdownRecord) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.addBreakdownLocked(record.ShortCode, record.Dimension, record.Value, record.Count)
+}
+
+// set restores a single bucket, as read back from a snapshot.
+func (cc *clickCounts) set(record clickCountRecord) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	bucket := cc.bucketLocked(record.ShortCode, clickCountKey{granularity: record.Granularity, start: record.Start})
+	bucket.count = record.Count
+	if len(record.Visitors) == 0 {
+		return nil
+	}
+	return bucket.visitors.UnmarshalBinary(record.Visitors)
+}
+
+// series returns the counts of shortCode for the given bucket starts.
+func (cc *clickCounts) series(shortCode string, g clickGranularity, starts []time.Time) []models.ClickBucket {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	buckets := cc.links[shortCode]
+	series := make([]models.ClickBucket, len(starts))
+	for i, start := range starts {
+		series[i] = models.ClickBucket{Start: start}
+		if bucket, exists := buckets[clickCountKey{granularity: g.name, start: start.Unix()}]; exists {
+			series[i].Count = bucket.count
+			series[i].UniqueVisitors = bucket.visitors.Estimate()
+		}
+	}
+	return series
+}
+
+// uniqueVisitors estimates the distinct visitors of shortCode over its lifetime.
+func (cc *clickCounts) uniqueVisitors(shortCode string) int64 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if bucket, exists := cc.links[shortCode][clickCountKey{granularity: granularityTotal}]; exists {
+		return bucket.visitors.Estimate()
+	}
+	return 0
+}
+
+// topBreakdowns returns the limit most clicked values of every dimension of shortCode.
+func (cc *clickCounts) topBreakdowns(shortCode string, limit int) map[string][]models.BreakdownEntry {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	top := make(map[string][]models.BreakdownEntry, len(analytics.Dimensions))
+	for _, dimension := range analytics.Dimensions {
+		values := cc.breakdowns[shortCode][dimension]
+		entries := make([]models.BreakdownEntry, 0, len(values))
+		for value, count := range values {
+			entries = append(entries, models.BreakdownEntry{Value: value, Count: count})
+		}
+		sortBreakdown(entries)
+		if len(entries) > limit {
+			entries = entries[:limit]
+		}
+		top[dimension] = entries
+	}
+	return top
+}
+
+// sortBreakdown orders entries by clicks, most first, and then by value.
+func sortBreakdown(entries []models.BreakdownEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Value < entries[j].Value
+	})
+}
+
+// remove drops every bucket and breakdown of shortCode.
+func (cc *clickCounts) remove(shortCode string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	delete(cc.links, shortCode)
+	delete(cc.breakdowns, shortCode)
+}
+
+// prune drops buckets past their retention, at most once per clickPruneInterval.
+func (cc *clickCounts) prune(now time.Time) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if now.Sub(cc.prunedAt) < clickPruneInterval {
+		return
+	}
+	cc.prunedAt = now
+	for shortCode, buckets := range cc.links {
+		for key := range buckets {
+			g, bounded := findGranularity(key.granularity)
+			if bounded && now.Sub(time.Unix(key.start, 0).Add(g.size)) > g.retention {
+				delete(buckets, key)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(cc.links, shortCode)
+		}
+	}
+}
+
+// clickCountRecord is a single bucket as written to file store snapshots.
+type clickCountRecord struct {
+	ShortCode   string `json:"short_code"`
+	Granularity string `json:"granularity"`
+	Start       int64  `json:"start"`
+	Count       int64  `json:"count"`
+	Visitors    []byte `json:"visitors,omitempty"` // Encoded analytics.Sketch
+}
+
+// breakdownRecord is a single breakdown value as written to file store snapshots.
+type breakdownRecord struct {
+	ShortCode string `json:"short_code"`
+	Dimension string `json:"dimension"`
+	Value     string `json:"value"`
+	Count     int64  `json:"count"`
+}
+
+// breakdownRecords returns every breakdown value for a snapshot.
+func (cc *clickCounts) breakdownRecords() []breakdownRecord {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	var records []breakdownRecord
+	for shortCode, breakdowns := range cc.breakdowns {
+		for dimension, values := range breakdowns {
+			for value, count := range values {
+				records = append(records, breakdownRecord{ShortCode: shortCode, Dimension: dimension, Value: value, Count: count})
+			}
+		}
+	}
+	return records
+}
+
+// records returns every bucket for a snapshot.
+func (cc *clickCounts) records() []clickCountRecord {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	var records []clickCountRecord
+	for shortCode, buckets := range cc.links {
+		for key, bucket := range buckets {
+			record := clickCountRecord{
+				ShortCode:   shortCode,
+				Granularity: key.granularity,
+				Start:       key.start,
+				Count:       bucket.count,
+			}
+			if !bucket.visitors.Empty() {
+				record.Visitors, _ = bucket.visitors.MarshalBinary()
+			}
+			records = append(records, record)
+		}
+	}
+	return records
+}
@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clicksAt builds click events on shortCode at the given times.
+func clicksAt(shortCode string, times ...time.Time) []models.ClickEvent {
+	events := make([]models.ClickEvent, len(times))
+	for i, at := range times {
+		events[i] = models.ClickEvent{ShortCode: shortCode, AccessedAt: at}
+	}
+	return events
+}
+
+// seriesCounts returns just the counts of a click series.
+func seriesCounts(series []models.ClickBucket) []int64 {
+	counts := make([]int64, len(series))
+	for i, bucket := range series {
+		counts[i] = bucket.Count
+	}
+	return counts
+}
+
+func TestStore_ClickSeries(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		require.NoError(t, store.AddURL("https://www.example.com", "clicked", time.Time{}))
+		hour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+
+		// Two clicks in the first minute, one in the third and one an hour later,
+		// written in two batches so rollups accumulate
+		require.NoError(t, store.CountClicks(clicksAt("clicked",
+			hour.Add(10*time.Second), hour.Add(50*time.Second), hour.Add(2*time.Minute),
+		)))
+		require.NoError(t, store.CountClicks(clicksAt("clicked", hour.Add(time.Hour+5*time.Minute))))
+
+		// Test case: Minute buckets are zero-filled over the range
+		series, err := store.ClickSeries("clicked", GranularityMinute, hour, hour.Add(4*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, []int64{2, 0, 1, 0}, seriesCounts(series))
+		assert.True(t, series[0].Start.Equal(hour))
+		assert.True(t, series[3].Start.Equal(hour.Add(3*time.Minute)))
+
+		// Test case: Hour buckets come from their own rollup
+		series, err = store.ClickSeries("clicked", GranularityHour, hour, hour.Add(2*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, []int64{3, 1}, seriesCounts(series))
+
+		// Test case: A range starting mid-bucket includes that whole bucket
+		series, err = store.ClickSeries("clicked", GranularityDay, hour.Add(30*time.Minute), hour.Add(31*time.Minute))
+		require.NoError(t, err)
+		require.Len(t, series, 1)
+		assert.Equal(t, int64(4), series[0].Count)
+
+		// Test case: Clicks on unknown links are ignored
+		require.NoError(t, store.CountClicks(clicksAt("missing", hour)))
+		series, err = store.ClickSeries("missing", GranularityHour, hour, hour.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, []int64{0}, seriesCounts(series))
+
+		// Test case: Deleting a link drops its rollups
+		require.NoError(t, store.DeleteURL("clicked"))
+		require.NoError(t, store.AddURL("https://www.example.com", "clicked", time.Time{}))
+		series, err = store.ClickSeries("clicked", GranularityHour, hour, hour.Add(2*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, []int64{0, 0}, seriesCounts(series))
+	})
+}
+
+func TestSeriesBuckets(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		granularity string
+		from        time.Time
+		to          time.Time
+		wantBuckets int
+		wantErr     bool
+	}{
+		{
+			// Test case: Day buckets over a week
+			name:        "Week of days",
+			granularity: GranularityDay,
+			from:        start,
+			to:          start.Add(7 * 24 * time.Hour),
+			wantBuckets: 7,
+		},
+		{
+			// Test case: A partial trailing bucket is included
+			name:        "Partial last bucket",
+			granularity: GranularityHour,
+			from:        start,
+			to:          start.Add(90 * time.Minute),
+			wantBuckets: 2,
+		},
+		{
+			// Test case: Unknown granularity
+			name:        "Unknown granularity",
+			granularity: "week",
+			from:        start,
+			to:          start.Add(time.Hour),
+			wantErr:     true,
+		},
+		{
+			// Test case: Empty range
+			name:        "Empty range",
+			granularity: GranularityHour,
+			from:        start,
+			to:          start,
+			wantErr:     true,
+		},
+		{
+			// Test case: Too many buckets
+			name:        "Too many buckets",
+			granularity: GranularityMinute,
+			from:        start,
+			to:          start.Add(MaxClickBuckets*time.Minute + time.Minute),
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, starts, err := seriesBuckets(tt.granularity, tt.from, tt.to)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSeries)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, starts, tt.wantBuckets)
+		})
+	}
+}
+
+func TestClickCounts_Prune(t *testing.T) {
+	counts := newClickCounts()
+	now := time.Now()
+	counts.add(models.ClickEvent{ShortCode: "old", AccessedAt: now.Add(-72 * time.Hour)})
+	counts.add(models.ClickEvent{ShortCode: "new", AccessedAt: now})
+
+	counts.prune(now)
+
+	// Minute buckets of the old click are past their retention; its hour, day and lifetime buckets are not
+	for _, record := range counts.records() {
+		if record.ShortCode == "old" {
+			assert.NotEqual(t, GranularityMinute, record.Granularity)
+		}
+	}
+	assert.Len(t, counts.records(), 7)
+}
+
+func TestFileStorage_ClickCountsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	hour := time.Now().UTC().Truncate(time.Hour)
+
+	store, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	require.NoError(t, store.AddURL("https://www.example.com", "durable", time.Time{}))
+	events := clicksAt("durable", hour, hour.Add(time.Minute))
+	events[0].VisitorID, events[1].VisitorID = "first", "second"
+	require.NoError(t, store.CountClicks(events))
+	require.NoError(t, store.Snapshot())
+	// Counted after the snapshot, so only the WAL holds this click
+	events = clicksAt("durable", hour.Add(2*time.Minute))
+	events[0].VisitorID = "third"
+	require.NoError(t, store.CountClicks(events))
+	require.NoError(t, store.wal.Close())
+
+	reopened, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	defer reopened.Close()
+	series, err := reopened.ClickSeries("durable", GranularityMinute, hour, hour.Add(3*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 1, 1}, seriesCounts(series))
+	unique, err := reopened.UniqueVisitors("durable")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), unique)
+}
+
+func TestStore_UniqueVisitors(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		require.NoError(t, store.AddURL("https://www.example.com", "visited", time.Time{}))
+		hour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+		click := func(at time.Time, visitorID string) models.ClickEvent {
+			return models.ClickEvent{ShortCode: "visited", AccessedAt: at, VisitorID: visitorID}
+		}
+
+		// Test case: No clicks yet
+		unique, err := store.UniqueVisitors("visited")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), unique)
+
+		// Visitor a refreshes twice; b and c return an hour later in a second batch,
+		// so stored sketches are merged with new ones
+		require.NoError(t, store.CountClicks([]models.ClickEvent{
+			click(hour, "a"), click(hour.Add(time.Second), "a"), click(hour.Add(time.Minute), "b"),
+		}))
+		require.NoError(t, store.CountClicks([]models.ClickEvent{
+			click(hour.Add(time.Hour), "b"), click(hour.Add(time.Hour), "c"), click(hour.Add(time.Hour), ""),
+		}))
+
+		unique, err = store.UniqueVisitors("visited")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), unique)
+
+		// Test case: Buckets estimate their own visitors
+		series, err := store.ClickSeries("visited", GranularityHour, hour, hour.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, series, 2)
+		assert.Equal(t, []int64{3, 3}, seriesCounts(series))
+		assert.Equal(t, int64(2), series[0].UniqueVisitors)
+		assert.Equal(t, int64(2), series[1].UniqueVisitors)
+
+		// Test case: Deleting a link drops its visitors
+		require.NoError(t, store.DeleteURL("visited"))
+		unique, err = store.UniqueVisitors("visited")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), unique)
+	})
+}
+
+func TestStore_Breakdowns(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		require.NoError(t, store.AddURL("https://www.example.com", "sources", time.Time{}))
+		const (
+			chrome  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+			iphone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1"
+			firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+		)
+		click := func(referrer string, userAgent string, country string) models.ClickEvent {
+			return models.ClickEvent{ShortCode: "sources", AccessedAt: time.Now(), Referrer: referrer, UserAgent: userAgent, Country: country}
+		}
+
+		// Six clicks over two batches: mostly from t.co on iPhones in Germany
+		require.NoError(t, store.CountClicks([]models.ClickEvent{
+			click("https://t.co/x", iphone, "DE"),
+			click("https://t.co/y", iphone, "DE"),
+			click("https://www.reddit.com/r/golang", chrome, "US"),
+		}))
+		require.NoError(t, store.CountClicks([]models.ClickEvent{
+			click("https://t.co/z", iphone, "DE"),
+			click("https://www.reddit.com/", chrome, "FR"),
+			click("", firefox, ""),
+		}))
+
+		breakdowns, err := store.Breakdowns("sources", 2)
+		require.NoError(t, err)
+		assert.Equal(t, []models.BreakdownEntry{{Value: "t.co", Count: 3}, {Value: "reddit.com", Count: 2}}, breakdowns["referrer"])
+		assert.Equal(t, []models.BreakdownEntry{{Value: "Safari", Count: 3}, {Value: "Chrome", Count: 2}}, breakdowns["browser"])
+		assert.Equal(t, []models.BreakdownEntry{{Value: "iOS", Count: 3}, {Value: "Windows", Count: 2}}, breakdowns["os"])
+		// mobile and desktop tie, so only the counts are compared
+		if assert.Len(t, breakdowns["device"], 2) {
+			assert.Equal(t, int64(3), breakdowns["device"][0].Count)
+			assert.Equal(t, int64(3), breakdowns["device"][1].Count)
+		}
+		assert.Len(t, breakdowns["country"], 2)
+		assert.Equal(t, models.BreakdownEntry{Value: "DE", Count: 3}, breakdowns["country"][0])
+
+		// Test case: Clicks on unknown links are ignored
+		require.NoError(t, store.CountClicks([]models.ClickEvent{{ShortCode: "missing", AccessedAt: time.Now()}}))
+		breakdowns, err = store.Breakdowns("missing", 5)
+		require.NoError(t, err)
+		assert.Empty(t, breakdowns["referrer"])
+
+		// Test case: Deleting a link drops its breakdowns
+		require.NoError(t, store.DeleteURL("sources"))
+		require.NoError(t, store.AddURL("https://www.example.com", "sources", time.Time{}))
+		breakdowns, err = store.Breakdowns("sources", 5)
+		require.NoError(t, err)
+		assert.Empty(t, breakdowns["country"])
+	})
+}
+
+func TestClickCounts_BreakdownLimit(t *testing.T) {
+	counts := newClickCounts()
+	for i := 0; i < maxBreakdownValues+5; i++ {
+		counts.add(models.ClickEvent{ShortCode: "viral", Referrer: "https://site" + strconv.Itoa(i) + ".example"})
+	}
+	// A value seen before the dimension filled up is still counted on its own
+	counts.add(models.ClickEvent{ShortCode: "viral", Referrer: "https://site0.example"})
+
+	top := counts.topBreakdowns("viral", 2)
+	assert.Equal(t, []models.BreakdownEntry{{Value: "other", Count: 5}, {Value: "site0.example", Count: 2}}, top["referrer"])
+	assert.Len(t, counts.breakdowns["viral"]["referrer"], maxBreakdownValues+1)
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"container/heap"
+	"expvar"
+	"time"
+)
+
+// expiryBatchSize caps how many links a sweep removes while holding a lock, so
+// redirects are only ever blocked for one small batch at a time.
+const expiryBatchSize = 256
+
+// expiredLinks counts links removed by expiry sweeps. It is published through
+// expvar and served at /debug/vars.
+var expiredLinks = expvar.NewInt("expired_links_total")
+
+// ExpiredLinks returns the number of links removed by expiry sweeps since startup.
+func ExpiredLinks() int64 {
+	return expiredLinks.Value()
+}
+
+// expiryItem is a short code scheduled to expire at expiresAt.
+type expiryItem struct {
+	shortCode string
+	expiresAt time.Time
+}
+
+// expiryIndex is a min-heap of short codes ordered by expiration time. Entries
+// are never removed eagerly: when a link is deleted or its expiry changes, the
+// stale entry stays in the heap and is discarded by the caller when popped.
+type expiryIndex []expiryItem
+
+func (h expiryIndex) Len() int           { return len(h) }
+func (h expiryIndex) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expiryIndex) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryIndex) Push(x any)        { *h = append(*h, x.(expiryItem)) }
+func (h *expiryIndex) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// schedule adds shortCode to the index if it has an expiration time.
+func (h *expiryIndex) schedule(shortCode string, expiresAt time.Time) {
+	if expiresAt.IsZero() {
+		return
+	}
+	heap.Push(h, expiryItem{shortCode: shortCode, expiresAt: expiresAt})
+}
+
+// popDue removes and returns up to limit entries that expired before now.
+func (h *expiryIndex) popDue(now time.Time, limit int) []expiryItem {
+	var due []expiryItem
+	for h.Len() > 0 && len(due) < limit && now.After((*h)[0].expiresAt) {
+		due = append(due, heap.Pop(h).(expiryItem))
+	}
+	return due
+}
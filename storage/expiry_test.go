@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiryIndex_PopDue(t *testing.T) {
+	var index expiryIndex
+	now := time.Now()
+
+	// Schedule out of order; links without expiry are ignored
+	index.schedule("late", now.Add(-1*time.Minute))
+	index.schedule("never", time.Time{})
+	index.schedule("future", now.Add(time.Hour))
+	index.schedule("early", now.Add(-3*time.Minute))
+	index.schedule("middle", now.Add(-2*time.Minute))
+	assert.Equal(t, 4, index.Len(), "Links without expiry should not be indexed")
+
+	// Test case: Due entries come out earliest first and respect the limit
+	due := index.popDue(now, 2)
+	assert.Equal(t, []string{"early", "middle"}, itemCodes(due))
+
+	// Test case: Entries that are not yet due stay in the index
+	due = index.popDue(now, 10)
+	assert.Equal(t, []string{"late"}, itemCodes(due))
+	assert.Equal(t, 1, index.Len(), "Future entry should remain indexed")
+}
+
+func TestStorage_ExpirySweepBatches(t *testing.T) {
+	store := NewStorage()
+	past := time.Now().Add(-time.Minute)
+
+	// More due links than a single batch holds
+	total := expiryBatchSize*2 + 10
+	for i := 0; i < total; i++ {
+		store.AddURL(fmt.Sprintf("https://www.batch%d.com", i), fmt.Sprintf("b%d", i), past)
+	}
+	store.AddURL("https://www.keep.com", "keep1", time.Now().Add(time.Hour))
+
+	before := ExpiredLinks()
+	assert.NoError(t, store.CleanupExpiredURLs())
+	assert.Equal(t, int64(total), ExpiredLinks()-before, "Metric should count every expired link")
+
+	urls, _ := store.ListURLs()
+	assert.Len(t, urls, 1, "Only the unexpired link should remain")
+	assert.Equal(t, 1, store.expiry.Len(), "Only the unexpired link should remain indexed")
+}
+
+func TestStorage_ExpirySkipsStaleEntries(t *testing.T) {
+	store := NewStorage()
+	past := time.Now().Add(-time.Minute)
+
+	// A deleted link leaves a stale index entry behind
+	store.AddURL("https://www.deleted.com", "gone1", past)
+	store.DeleteURL("gone1")
+
+	// A link replaced with a later expiry must survive its old deadline
+	store.AddURL("https://www.renewed.com", "renew1", past)
+	store.AddURL("https://www.renewed.com", "renew1", time.Now().Add(time.Hour))
+
+	before := ExpiredLinks()
+	assert.NoError(t, store.CleanupExpiredURLs())
+	assert.Zero(t, ExpiredLinks()-before, "Stale index entries should not count as expirations")
+
+	_, exists := store.GetURL("renew1")
+	assert.True(t, exists, "Renewed link should not be expired by its old deadline")
+}
+
+func TestShardedStorage_ExpirySweep(t *testing.T) {
+	store := NewShardedStorage(4)
+	past := time.Now().Add(-time.Minute)
+	for i := 0; i < 20; i++ {
+		store.AddURL(fmt.Sprintf("https://www.shard%d.com", i), fmt.Sprintf("sh%d", i), past)
+	}
+	store.AddURL("https://www.keep.com", "keep1", time.Time{})
+
+	before := ExpiredLinks()
+	assert.NoError(t, store.CleanupExpiredURLs())
+	assert.Equal(t, int64(20), ExpiredLinks()-before)
+
+	urls, _ := store.ListURLs()
+	assert.Len(t, urls, 1, "Only the link without expiry should remain")
+}
+
+// itemCodes returns the short codes of the given expiry items, in order.
+func itemCodes(items []expiryItem) []string {
+	codes := make([]string, 0, len(items))
+	for _, item := range items {
+		codes = append(codes, item.shortCode)
+	}
+	return codes
+}
@@ -0,0 +1,694 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	// walHeaderSize is the length prefix plus CRC32 checksum written before every record.
+	walHeaderSize = 8
+
+	// maxWALRecordSize guards replay against allocating huge buffers for a corrupt length prefix.
+	// Larger records are refused when written, since replay would discard them and all that follow.
+	maxWALRecordSize = 1 << 20
+
+	// maxWALClicks caps the clicks recorded per WAL record.
+	maxWALClicks = 256
+
+	// maxWALClickField caps the User-Agent and Referer headers kept per click, so a
+	// record of maxWALClicks clicks stays well below maxWALRecordSize.
+	maxWALClickField = 512
+
+	// DefaultSnapshotEvery is the number of WAL records after which a snapshot is taken.
+	DefaultSnapshotEvery = 10000
+)
+
+// WAL operations recorded for each mutation.
+const (
+	walOpAdd       = "add"
+	walOpUpdate    = "update"
+	walOpDelete    = "delete"
+	walOpIncrement = "incr"
+	walOpBot       = "bot"
+	walOpClicks    = "clicks"
+
+	// walOpGeneration heads every WAL and names its generation; see snapshot.
+	walOpGeneration = "gen"
+)
+
+// walRecord is a single mutation appended to the write-ahead log.
+type walRecord struct {
+	Op        string      `json:"op"`
+	ShortCode string      `json:"short_code"`
+	URL       *models.URL `json:"url,omitempty"`
+	// Clicks holds the clicks counted by a walOpClicks record.
+	Clicks []walClick `json:"clicks,omitempty"`
+	// Generation is the generation of the WAL headed by a walOpGeneration record.
+	Generation uint64 `json:"generation,omitempty"`
+}
+
+// walClick is the part of a click event the rollups and breakdowns are built from.
+// Headers are cut to what classification needs; see newWALClick.
+type walClick struct {
+	AccessedAt time.Time `json:"t"`
+	VisitorID  string    `json:"v,omitempty"`
+	Referrer   string    `json:"r,omitempty"`
+	UserAgent  string    `json:"u,omitempty"`
+	Country    string    `json:"c,omitempty"`
+}
+
+// snapshot is the compacted on-disk image of the whole store. It covers every
+// WAL of an earlier generation than WALGeneration, so a log left behind by a
+// crash between installing the snapshot and truncating the log is not replayed.
+type snapshot struct {
+	TakenAt       time.Time          `json:"taken_at"`
+	WALGeneration uint64             `json:"wal_generation,omitempty"`
+	URLs          []*models.URL      `json:"urls"`
+	Clicks        []clickCountRecord `json:"clicks,omitempty"`
+	Breakdowns    []breakdownRecord  `json:"breakdowns,omitempty"`
+}
+
+// FileStorage is a durable Store that keeps its working set in memory and
+// persists every mutation to a write-ahead log, compacted into periodic snapshots.
+type FileStorage struct {
+	mu            sync.Mutex
+	mem           *Storage
+	dir           string
+	wal           *os.File
+	walRecords    int
+	walSize       int64  // End of the last complete WAL record
+	generation    uint64 // Generation of the current WAL
+	walHeaded     bool   // Whether the WAL starts with its generation record yet
+	snapshotEvery int
+	syncWrites    bool
+}
+
+// NewFileStorage opens (or creates) a file-backed store in dir, replaying the
+// latest snapshot and any WAL records written after it. A truncated or corrupt
+// record at the tail of the WAL, as left by a crash mid-write, is discarded.
+func NewFileStorage(dir string, snapshotEvery int, syncWrites bool) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+	if snapshotEvery <= 0 {
+		snapshotEvery = DefaultSnapshotEvery
+	}
+
+	fs := &FileStorage{
+		mem:           NewStorage(),
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+		syncWrites:    syncWrites,
+	}
+	if err := fs.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := fs.replayWAL(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// AddURL adds a new URL mapping and records it in the WAL.
+func (fs *FileStorage) AddURL(url string, shortCode string, expiresAt time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	urlModel := newURL(url, shortCode, expiresAt)
+	if err := fs.append(walRecord{Op: walOpAdd, ShortCode: shortCode, URL: urlModel}); err != nil {
+		return err
+	}
+	fs.mem.putURL(urlModel)
+	fs.maybeSnapshot()
+	return nil
+}
+
+// CreateURL atomically stores urlModel, deduplicating generated links by long URL and tags,
+// and records new mappings in the WAL.
+func (fs *FileStorage) CreateURL(urlModel *models.URL) (string, bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// fs.mu serializes every write, so nothing can change between these checks and the insert.
+	if deduplicated(urlModel) {
+		if existing, exists := fs.mem.GetShortCode(urlModel.LongURL, urlModel.Tags); exists {
+			return existing, false, nil
+		}
+	}
+	if _, exists := fs.mem.GetURL(urlModel.ShortCode); exists {
+		return "", false, ErrShortCodeExists
+	}
+	copied := *urlModel
+	if err := fs.append(walRecord{Op: walOpAdd, ShortCode: copied.ShortCode, URL: &copied}); err != nil {
+		return "", false, err
+	}
+	fs.mem.putURL(&copied)
+	fs.maybeSnapshot()
+	return copied.ShortCode, true, nil
+}
+
+// GetURL retrieves a URL model by its short code.
+func (fs *FileStorage) GetURL(shortCode string) (*models.URL, bool) {
+	return fs.mem.GetURL(shortCode)
+}
+
+// GetShortCode retrieves the short code for a given long URL and tag set.
+func (fs *FileStorage) GetShortCode(url string, tags map[string]string) (string, bool) {
+	return fs.mem.GetShortCode(url, tags)
+}
+
+// UpdateURL atomically applies update to the mapping for shortCode and records
+// the resulting model in the WAL.
+func (fs *FileStorage) UpdateURL(shortCode string, update func(*models.URL) error) (*models.URL, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	current, exists := fs.mem.GetURL(shortCode)
+	if !exists {
+		return nil, ErrURLNotFound
+	}
+	updated, err := applyUpdate(current, update)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.append(walRecord{Op: walOpUpdate, ShortCode: shortCode, URL: updated}); err != nil {
+		return nil, err
+	}
+	stored, err := fs.mem.UpdateURL(shortCode, replaceWith(updated))
+	if err != nil {
+		return nil, err
+	}
+	fs.maybeSnapshot()
+	return stored, nil
+}
+
+// DeleteURL removes a URL mapping and records the deletion in the WAL.
+func (fs *FileStorage) DeleteURL(shortCode string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, exists := fs.mem.GetURL(shortCode); !exists {
+		return nil
+	}
+	if err := fs.append(walRecord{Op: walOpDelete, ShortCode: shortCode}); err != nil {
+		return err
+	}
+	fs.mem.DeleteURL(shortCode)
+	fs.maybeSnapshot()
+	return nil
+}
+
+// IncrementAccessCount increments the access count and records it in the WAL.
+func (fs *FileStorage) IncrementAccessCount(shortCode string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	urlModel, exists := fs.mem.GetURL(shortCode)
+	if !exists {
+		return nil
+	}
+	if !clicksLeft(urlModel, urlModel.AccessCount) {
+		return ErrClickLimitReached
+	}
+	if err := fs.append(walRecord{Op: walOpIncrement, ShortCode: shortCode}); err != nil {
+		return err
+	}
+	fs.mem.IncrementAccessCount(shortCode)
+	fs.maybeSnapshot()
+	return nil
+}
+
+// IncrementBotCount increments the bot count and records it in the WAL.
+func (fs *FileStorage) IncrementBotCount(shortCode string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, exists := fs.mem.GetURL(shortCode); !exists {
+		return nil
+	}
+	if err := fs.append(walRecord{Op: walOpBot, ShortCode: shortCode}); err != nil {
+		return err
+	}
+	fs.mem.IncrementBotCount(shortCode)
+	fs.maybeSnapshot()
+	return nil
+}
+
+// CountClicks adds the human clicks among events to the click rollups and records
+// them in the WAL, one record per link. Clicks on links that no longer exist are skipped.
+func (fs *FileStorage) CountClicks(events []models.ClickEvent) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var order []string
+	records := make(map[string]*walRecord)
+	for _, event := range humanClicks(events) {
+		rec, seen := records[event.ShortCode]
+		if !seen {
+			if _, exists := fs.mem.GetURL(event.ShortCode); !exists {
+				continue
+			}
+			rec = &walRecord{Op: walOpClicks, ShortCode: event.ShortCode}
+			records[event.ShortCode] = rec
+			order = append(order, event.ShortCode)
+		}
+		rec.Clicks = append(rec.Clicks, newWALClick(event))
+	}
+	for _, shortCode := range order {
+		clicks := records[shortCode].Clicks
+		for len(clicks) > 0 {
+			n := min(len(clicks), maxWALClicks)
+			rec := walRecord{Op: walOpClicks, ShortCode: shortCode, Clicks: clicks[:n]}
+			if err := fs.append(rec); err != nil {
+				return err
+			}
+			fs.apply(rec)
+			clicks = clicks[n:]
+		}
+	}
+	fs.maybeSnapshot()
+	return nil
+}
+
+// Breakdowns returns the limit most clicked values of every breakdown dimension of shortCode.
+func (fs *FileStorage) Breakdowns(shortCode string, limit int) (map[string][]models.BreakdownEntry, error) {
+	return fs.mem.Breakdowns(shortCode, limit)
+}
+
+// ClickSeries returns the click counts of shortCode per bucket of granularity over [from, to).
+func (fs *FileStorage) ClickSeries(shortCode string, granularity string, from time.Time, to time.Time) ([]models.ClickBucket, error) {
+	return fs.mem.ClickSeries(shortCode, granularity, from, to)
+}
+
+// UniqueVisitors estimates the distinct visitors of shortCode over its lifetime.
+func (fs *FileStorage) UniqueVisitors(shortCode string) (int64, error) {
+	return fs.mem.UniqueVisitors(shortCode)
+}
+
+// CleanupExpiredURLs removes expired URLs and records each deletion in the WAL.
+// Like the in-memory sweep it works in small batches, releasing the lock between
+// them. Click rollups past their retention are dropped without a record, since
+// replay drops them again on the next cleanup.
+func (fs *FileStorage) CleanupExpiredURLs() error {
+	now := time.Now()
+	for {
+		more, err := fs.removeExpiredBatch(now)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.mem.clicks.prune(now)
+	return nil
+}
+
+// removeExpiredBatch removes up to expiryBatchSize due links, records their
+// deletion in the WAL and reports whether more may be due.
+func (fs *FileStorage) removeExpiredBatch(now time.Time) (bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	removed, more := fs.mem.removeExpiredBatch(now)
+	for _, shortCode := range removed {
+		if err := fs.append(walRecord{Op: walOpDelete, ShortCode: shortCode}); err != nil {
+			return false, err
+		}
+	}
+	fs.maybeSnapshot()
+	return more, nil
+}
+
+// ListURLs returns a snapshot of every URL mapping in the store.
+func (fs *FileStorage) ListURLs() ([]*models.URL, error) {
+	return fs.mem.ListURLs()
+}
+
+// QueryURLs filters, orders and pages a snapshot of every URL mapping.
+func (fs *FileStorage) QueryURLs(query ListQuery) (*ListPage, error) {
+	urls, err := fs.ListURLs()
+	if err != nil {
+		return nil, err
+	}
+	return queryURLs(urls, query)
+}
+
+// Snapshot writes a compacted image of the store and truncates the WAL.
+func (fs *FileStorage) Snapshot() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.snapshot()
+}
+
+// Close writes a final snapshot and closes the WAL.
+func (fs *FileStorage) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.wal == nil {
+		return nil
+	}
+	if err := fs.snapshot(); err != nil {
+		return err
+	}
+	err := fs.wal.Close()
+	fs.wal = nil
+	return err
+}
+
+// append encodes rec and writes it to the WAL. Callers must hold fs.mu.
+func (fs *FileStorage) append(rec walRecord) error {
+	if fs.wal == nil {
+		return errors.New("file storage is closed")
+	}
+	buf, err := encodeWALRecord(rec)
+	if err != nil {
+		return err
+	}
+	if !fs.walHeaded {
+		// An empty log gets its generation record together with its first record
+		header, err := encodeWALRecord(walRecord{Op: walOpGeneration, Generation: fs.generation})
+		if err != nil {
+			return err
+		}
+		buf = append(header, buf...)
+	}
+
+	// Write the whole frame in a single call so a crash leaves at most one partial record.
+	if _, err := fs.wal.Write(buf); err != nil {
+		return fs.rewind(fmt.Errorf("write WAL record: %w", err))
+	}
+	if fs.syncWrites {
+		if err := fs.wal.Sync(); err != nil {
+			return fs.rewind(fmt.Errorf("sync WAL: %w", err))
+		}
+	}
+	fs.walSize += int64(len(buf))
+	fs.walHeaded = true
+	fs.walRecords++
+	return nil
+}
+
+// rewind cuts the WAL back to the end of the last complete record after an
+// append failed with cause, so later records do not land behind a partial one
+// that replay would stop at. If that fails too, the WAL is closed so that no
+// further records are written. Callers must hold fs.mu.
+func (fs *FileStorage) rewind(cause error) error {
+	err := fs.wal.Truncate(fs.walSize)
+	if err == nil {
+		_, err = fs.wal.Seek(fs.walSize, io.SeekStart)
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to discard a partial WAL record, refusing further writes: %v", err)
+		fs.wal.Close()
+		fs.wal = nil
+		return errors.Join(cause, fmt.Errorf("rewind WAL: %w", err))
+	}
+	return cause
+}
+
+// encodeWALRecord returns rec framed with its length and checksum.
+func encodeWALRecord(rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("encode WAL record: %w", err)
+	}
+	if len(payload) > maxWALRecordSize {
+		return nil, fmt.Errorf("WAL record of %d bytes exceeds limit", len(payload))
+	}
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[walHeaderSize:], payload)
+	return buf, nil
+}
+
+// maybeSnapshot compacts the WAL once it holds snapshotEvery records. A failed
+// snapshot does not fail the write that triggered it, which the WAL already
+// holds; it is logged and retried on the next write. Callers must hold fs.mu.
+func (fs *FileStorage) maybeSnapshot() {
+	if fs.walRecords < fs.snapshotEvery {
+		return
+	}
+	if err := fs.snapshot(); err != nil {
+		log.Printf("[ERROR] Failed to snapshot file storage: %v", err)
+	}
+}
+
+// snapshot atomically replaces the snapshot file and then empties the WAL,
+// which starts the next generation. Callers must hold fs.mu.
+func (fs *FileStorage) snapshot() error {
+	urls, _ := fs.mem.ListURLs()
+	generation := fs.generation + 1
+	data, err := json.Marshal(snapshot{
+		TakenAt:       time.Now(),
+		WALGeneration: generation,
+		URLs:          urls,
+		Clicks:        fs.mem.clicks.records(),
+		Breakdowns:    fs.mem.clicks.breakdownRecords(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	// Write to a temporary file and rename it so readers never observe a partial snapshot.
+	tmpPath := filepath.Join(fs.dir, snapshotFileName+".tmp")
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(fs.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("install snapshot: %w", err)
+	}
+	syncDir(fs.dir)
+
+	// The snapshot now covers every WAL record, so the log can start over. Should
+	// that fail, replay skips the old log by its generation.
+	fs.generation = generation
+	fs.walHeaded = false
+	fs.walRecords = 0
+	fs.walSize = 0
+	if err := fs.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate WAL: %w", err)
+	}
+	if _, err := fs.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewind WAL: %w", err)
+	}
+	return nil
+}
+
+// loadSnapshot restores the store from the snapshot file, if one exists.
+func (fs *FileStorage) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(fs.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	fs.generation = snap.WALGeneration
+	for _, urlModel := range snap.URLs {
+		fs.mem.putURL(urlModel)
+	}
+	for _, record := range snap.Clicks {
+		if err := fs.mem.clicks.set(record); err != nil {
+			return fmt.Errorf("decode click counts of %s: %w", record.ShortCode, err)
+		}
+	}
+	for _, record := range snap.Breakdowns {
+		fs.mem.clicks.setBreakdown(record)
+	}
+	return nil
+}
+
+// replayWAL applies every intact WAL record and opens the log for appending.
+// Anything after the last intact record is truncated away, and so is a log of
+// an earlier generation than the snapshot, which already covers it. Logs
+// written before generations were recorded count as generation 0.
+func (fs *FileStorage) replayWAL() error {
+	wal, err := os.OpenFile(filepath.Join(fs.dir, walFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open WAL: %w", err)
+	}
+
+	reader := bufio.NewReader(wal)
+	var offset int64
+	var generation uint64
+	for {
+		rec, size, err := readWALRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("[WARN] Discarding WAL tail at offset %d: %v", offset, err)
+			break
+		}
+		offset += size
+		if rec.Op == walOpGeneration {
+			generation = rec.Generation
+			continue
+		}
+		if generation < fs.generation {
+			continue
+		}
+		fs.apply(rec)
+		fs.walRecords++
+	}
+	if offset > 0 && generation < fs.generation {
+		log.Printf("[INFO] Discarding WAL of generation %d, which the snapshot of generation %d covers", generation, fs.generation)
+		offset = 0
+	}
+	// Without its snapshot the log may be ahead; later snapshots must still cover it
+	fs.generation = max(fs.generation, generation)
+	fs.walHeaded = offset > 0
+	fs.walSize = offset
+
+	if err := wal.Truncate(offset); err != nil {
+		wal.Close()
+		return fmt.Errorf("truncate WAL: %w", err)
+	}
+	if _, err := wal.Seek(offset, io.SeekStart); err != nil {
+		wal.Close()
+		return fmt.Errorf("seek WAL: %w", err)
+	}
+	fs.wal = wal
+	return nil
+}
+
+// apply replays a single WAL record against the in-memory state.
+func (fs *FileStorage) apply(rec walRecord) {
+	switch rec.Op {
+	case walOpAdd:
+		if rec.URL != nil {
+			fs.mem.putURL(rec.URL)
+		}
+	case walOpUpdate:
+		if rec.URL != nil {
+			fs.mem.UpdateURL(rec.ShortCode, replaceWith(rec.URL))
+		}
+	case walOpDelete:
+		fs.mem.DeleteURL(rec.ShortCode)
+	case walOpIncrement:
+		fs.mem.IncrementAccessCount(rec.ShortCode)
+	case walOpBot:
+		fs.mem.IncrementBotCount(rec.ShortCode)
+	case walOpClicks:
+		events := make([]models.ClickEvent, len(rec.Clicks))
+		for i, click := range rec.Clicks {
+			events[i] = models.ClickEvent{
+				ShortCode:  rec.ShortCode,
+				AccessedAt: click.AccessedAt,
+				VisitorID:  click.VisitorID,
+				Referrer:   click.Referrer,
+				UserAgent:  click.UserAgent,
+				Country:    click.Country,
+			}
+		}
+		fs.mem.CountClicks(events)
+	default:
+		log.Printf("[WARN] Skipping WAL record with unknown op %q", rec.Op)
+	}
+}
+
+// newWALClick returns the part of event recorded in the WAL. Of the Referer
+// header only the origin is kept, which is all its breakdown uses, and the
+// User-Agent header is cut to maxWALClickField bytes.
+func newWALClick(event models.ClickEvent) walClick {
+	referrer := event.Referrer
+	if parsed, err := url.Parse(referrer); err == nil && parsed.Host != "" {
+		referrer = (&url.URL{Scheme: parsed.Scheme, Host: parsed.Host}).String()
+	}
+	return walClick{
+		AccessedAt: event.AccessedAt,
+		VisitorID:  event.VisitorID,
+		Referrer:   truncate(referrer, maxWALClickField),
+		UserAgent:  truncate(event.UserAgent, maxWALClickField),
+		Country:    event.Country,
+	}
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// replaceWith returns an update that overwrites a mapping with urlModel.
+func replaceWith(urlModel *models.URL) func(*models.URL) error {
+	return func(current *models.URL) error {
+		*current = *urlModel
+		return nil
+	}
+}
+
+// readWALRecord reads one framed record and returns it with its size on disk.
+// It returns io.EOF only when the log ends cleanly on a record boundary.
+func readWALRecord(r io.Reader) (walRecord, int64, error) {
+	var rec walRecord
+	header := make([]byte, walHeaderSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF && n == 0 {
+			return rec, 0, io.EOF
+		}
+		return rec, 0, fmt.Errorf("truncated record header: %w", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxWALRecordSize {
+		return rec, 0, fmt.Errorf("record length %d exceeds limit", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return rec, 0, fmt.Errorf("truncated record payload: %w", err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return rec, 0, errors.New("record checksum mismatch")
+	}
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return rec, 0, fmt.Errorf("decode record: %w", err)
+	}
+	return rec, int64(walHeaderSize) + int64(length), nil
+}
+
+// writeFileSync writes data to path and flushes it to stable storage.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes directory metadata so a rename survives a crash. Errors are
+// ignored because not every platform supports syncing directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
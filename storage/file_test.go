@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/analytics"
+	"github.com/Codedude1/shorty/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_ReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// Write a few mutations without closing, as if the process was killed
+	store, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	assert.NoError(t, store.AddURL("https://www.durable.com", "dur1", time.Time{}))
+	assert.NoError(t, store.AddURL("https://www.deleted.com", "del1", time.Time{}))
+	assert.NoError(t, store.IncrementAccessCount("dur1"))
+	assert.NoError(t, store.IncrementAccessCount("dur1"))
+	assert.NoError(t, store.IncrementBotCount("dur1"))
+	assert.NoError(t, store.DeleteURL("del1"))
+
+	// Reopen the store from the same directory
+	reopened, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+
+	urlModel, exists := reopened.GetURL("dur1")
+	assert.True(t, exists, "Short code should survive a restart")
+	assert.Equal(t, "https://www.durable.com", urlModel.LongURL, "Long URL should be replayed")
+	assert.Equal(t, 2, urlModel.AccessCount, "Access count should be replayed")
+	assert.Equal(t, 1, urlModel.BotCount, "Bot count should be replayed")
+
+	shortCode, exists := reopened.GetShortCode("https://www.durable.com", nil)
+	assert.True(t, exists, "Long URL index should be rebuilt")
+	assert.Equal(t, "dur1", shortCode)
+
+	_, exists = reopened.GetURL("del1")
+	assert.False(t, exists, "Deleted short code should stay deleted")
+}
+
+func TestFileStorage_TruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	assert.NoError(t, store.AddURL("https://www.first.com", "first1", time.Time{}))
+	assert.NoError(t, store.AddURL("https://www.second.com", "second1", time.Time{}))
+
+	// Chop the last record in half to simulate a crash mid-write
+	walPath := filepath.Join(dir, walFileName)
+	info, err := os.Stat(walPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(walPath, info.Size()-10))
+
+	reopened, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err, "Truncated tail record should be tolerated")
+
+	_, exists := reopened.GetURL("first1")
+	assert.True(t, exists, "Intact records should be replayed")
+	_, exists = reopened.GetURL("second1")
+	assert.False(t, exists, "Truncated record should be discarded")
+
+	// New writes after recovery must be readable on the next restart
+	assert.NoError(t, reopened.AddURL("https://www.third.com", "third1", time.Time{}))
+	again, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	_, exists = again.GetURL("third1")
+	assert.True(t, exists, "Records appended after recovery should be replayed")
+}
+
+func TestFileStorage_FailedAppend(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	assert.NoError(t, store.AddURL("https://www.first.com", "first1", time.Time{}))
+
+	// Leave half a record behind, as a short write would, and fail the append
+	partial, err := encodeWALRecord(walRecord{Op: walOpAdd, ShortCode: "lost1", URL: newURL("https://www.lost.com", "lost1", time.Time{})})
+	require.NoError(t, err)
+	_, err = store.wal.Write(partial[:len(partial)/2])
+	require.NoError(t, err)
+	assert.Error(t, store.rewind(errors.New("short write")))
+
+	// Records appended after the failure survive a restart
+	assert.NoError(t, store.AddURL("https://www.second.com", "second1", time.Time{}))
+	reopened, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	_, exists := reopened.GetURL("first1")
+	assert.True(t, exists)
+	_, exists = reopened.GetURL("second1")
+	assert.True(t, exists, "Records after a failed append should be replayed")
+	_, exists = reopened.GetURL("lost1")
+	assert.False(t, exists, "The partial record should be discarded")
+}
+
+func TestFileStorage_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	// A low threshold forces a snapshot after three records
+	store, err := NewFileStorage(dir, 3, true)
+	require.NoError(t, err)
+	assert.NoError(t, store.AddURL("https://www.snap.com", "snap1", time.Time{}))
+	assert.NoError(t, store.IncrementAccessCount("snap1"))
+	assert.NoError(t, store.IncrementAccessCount("snap1"))
+
+	// The WAL should have been compacted into the snapshot
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "WAL should be truncated after a snapshot")
+	_, err = os.Stat(filepath.Join(dir, snapshotFileName))
+	assert.NoError(t, err, "Snapshot file should exist")
+
+	// Records written after the snapshot are replayed on top of it
+	assert.NoError(t, store.IncrementAccessCount("snap1"))
+	assert.NoError(t, store.Close())
+
+	reopened, err := NewFileStorage(dir, 3, true)
+	require.NoError(t, err)
+	urlModel, exists := reopened.GetURL("snap1")
+	assert.True(t, exists, "Short code should be restored from the snapshot")
+	assert.Equal(t, 3, urlModel.AccessCount, "Access count should combine snapshot and WAL")
+}
+
+func TestFileStorage_CrashDuringSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	assert.NoError(t, store.AddURL("https://www.snap.com", "snap1", time.Time{}))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, store.IncrementAccessCount("snap1"))
+	}
+
+	// Put the WAL back after the snapshot, as if the process died before truncating it
+	walPath := filepath.Join(dir, walFileName)
+	wal, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	require.NoError(t, store.Snapshot())
+	require.NoError(t, os.WriteFile(walPath, wal, 0o644))
+
+	// The snapshot already covers the old log, so it is not replayed on top
+	reopened, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	urlModel, exists := reopened.GetURL("snap1")
+	assert.True(t, exists)
+	assert.Equal(t, 3, urlModel.AccessCount, "Records covered by the snapshot should not be replayed")
+
+	// Records written after recovery are replayed on the next restart
+	assert.NoError(t, reopened.IncrementAccessCount("snap1"))
+	again, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	urlModel, _ = again.GetURL("snap1")
+	assert.Equal(t, 4, urlModel.AccessCount, "Records after recovery should be replayed")
+}
+
+func TestFileStorage_CleanupExpiredURLs(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	assert.NoError(t, store.AddURL("https://www.stale.com", "stale1", time.Now().Add(-time.Hour)))
+	assert.NoError(t, store.AddURL("https://www.fresh.com", "fresh1", time.Now().Add(time.Hour)))
+	assert.NoError(t, store.CleanupExpiredURLs())
+
+	// Cleanup deletions must be durable too
+	reopened, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	_, exists := reopened.GetURL("stale1")
+	assert.False(t, exists, "Expired short code should not be replayed")
+	_, exists = reopened.GetURL("fresh1")
+	assert.True(t, exists, "Unexpired short code should be replayed")
+
+	// Sweeps of more than one batch remove every expired link
+	for i := 0; i < 2*expiryBatchSize+1; i++ {
+		shortCode := fmt.Sprintf("old%d", i)
+		assert.NoError(t, reopened.AddURL("https://www.stale.com/"+shortCode, shortCode, time.Now().Add(-time.Hour)))
+	}
+	assert.NoError(t, reopened.CleanupExpiredURLs())
+	again, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	urls, err := again.ListURLs()
+	require.NoError(t, err)
+	assert.Len(t, urls, 1, "Only the unexpired short code should be left")
+}
+
+func TestFileStorage_CreateURL(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	shortCode, created, err := store.CreateURL(newURL("https://www.create.com", "crt1", time.Time{}))
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "crt1", shortCode)
+
+	_, _, err = store.CreateURL(newURL("https://www.other.com", "crt1", time.Time{}))
+	assert.ErrorIs(t, err, ErrShortCodeExists)
+
+	// Created mappings are durable
+	reopened, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	shortCode, created, err = reopened.CreateURL(newURL("https://www.create.com", "crt2", time.Time{}))
+	assert.NoError(t, err)
+	assert.False(t, created, "Replayed long URL should be deduplicated")
+	assert.Equal(t, "crt1", shortCode)
+}
+
+func TestFileStorage_FailedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	// A directory in the way of the temporary snapshot file makes every snapshot fail
+	require.NoError(t, os.Mkdir(filepath.Join(dir, snapshotFileName+".tmp"), 0o755))
+	store, err := NewFileStorage(dir, 1, false)
+	require.NoError(t, err)
+
+	// Test case: Writes that trigger a failed snapshot still succeed
+	shortCode, created, err := store.CreateURL(newURL("https://www.create.com", "crt1", time.Time{}))
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "crt1", shortCode)
+	assert.NoError(t, store.IncrementAccessCount("crt1"))
+
+	// Test case: The WAL keeps them durable
+	reopened, err := NewFileStorage(dir, 1, false)
+	require.NoError(t, err)
+	urlModel, exists := reopened.GetURL("crt1")
+	assert.True(t, exists)
+	assert.Equal(t, 1, urlModel.AccessCount)
+}
+
+func TestFileStorage_UpdateURL(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	assert.NoError(t, store.AddURL("https://www.before.com", "upd1", time.Time{}))
+	assert.NoError(t, store.IncrementAccessCount("upd1"))
+	_, err = store.UpdateURL("upd1", func(u *models.URL) error {
+		u.LongURL = "https://www.after.com"
+		u.Disabled = true
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Updates are replayed from the WAL
+	reopened, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	urlModel, exists := reopened.GetURL("upd1")
+	assert.True(t, exists)
+	assert.Equal(t, "https://www.after.com", urlModel.LongURL, "Retarget should be replayed")
+	assert.True(t, urlModel.Disabled, "Disabled flag should be replayed")
+	assert.Equal(t, 1, urlModel.AccessCount, "Access count should be kept")
+	_, exists = reopened.GetShortCode("https://www.before.com", nil)
+	assert.False(t, exists, "Old destination should not be re-indexed")
+}
+
+func TestFileStorage_OversizedRecords(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	assert.NoError(t, store.AddURL("https://www.example.com", "big1", time.Time{}))
+
+	// Oversized click headers are cut down instead of growing the record past the replay limit
+	long := strings.Repeat("a", 64<<10)
+	referrer := "https://news.example.org/" + long
+	userAgent := "Mozilla/5.0 (Windows NT 10.0) Firefox/120.0 " + long
+	events := make([]models.ClickEvent, maxWALClicks+1)
+	for i := range events {
+		events[i] = models.ClickEvent{ShortCode: "big1", AccessedAt: time.Now(), Referrer: referrer, UserAgent: userAgent}
+	}
+	assert.NoError(t, store.CountClicks(events))
+
+	// Records replay could not read back are refused
+	huge := strings.Repeat("a", maxWALRecordSize)
+	assert.Error(t, store.AddURL("https://www.example.com/"+huge, "big2", time.Time{}))
+
+	// Writes after them survive a restart
+	assert.NoError(t, store.AddURL("https://www.example.com/after", "after1", time.Time{}))
+	reopened, err := NewFileStorage(dir, 100, false)
+	require.NoError(t, err)
+	_, exists := reopened.GetURL("after1")
+	assert.True(t, exists, "Records after oversized writes should be replayed")
+	_, exists = reopened.GetURL("big2")
+	assert.False(t, exists, "Refused records should not be applied")
+
+	breakdowns, err := reopened.Breakdowns("big1", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.BreakdownEntry{{Value: "news.example.org", Count: int64(len(events))}}, breakdowns[analytics.DimensionReferrer])
+	assert.Equal(t, []models.BreakdownEntry{{Value: "Firefox", Count: int64(len(events))}}, breakdowns[analytics.DimensionBrowser])
+}
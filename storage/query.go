@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+)
+
+// Sort fields accepted by ListQuery.SortBy.
+const (
+	SortCreatedAt   = "created_at"
+	SortAccessCount = "access_count"
+	SortExpiresAt   = "expires_at"
+)
+
+// Status filters accepted by ListQuery.Status. An empty status matches every link.
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+)
+
+// DefaultListLimit is the page size used when ListQuery.Limit is not set.
+const DefaultListLimit = 20
+
+var (
+	// ErrInvalidQuery is returned by QueryURLs for unknown sort fields or statuses.
+	ErrInvalidQuery = errors.New("invalid list query")
+	// ErrInvalidCursor is returned by QueryURLs for cursors it did not issue for the same sort order.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// ListQuery selects, orders and pages links for QueryURLs.
+type ListQuery struct {
+	// SortBy is one of the Sort constants; empty sorts by creation time.
+	SortBy     string
+	Descending bool
+
+	// Host keeps links whose destination host contains this substring, ignoring case.
+	Host string
+	// Status is StatusActive, StatusExpired or empty for both.
+	Status string
+	// CreatedFrom and CreatedTo bound the creation time to [CreatedFrom, CreatedTo).
+	// Zero values leave that side open.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	// Limit caps the page size; zero or less uses DefaultListLimit.
+	Limit int
+	// Cursor continues after the last link of a previous page, as returned in ListPage.NextCursor.
+	Cursor string
+}
+
+// ListPage is one page of QueryURLs results.
+type ListPage struct {
+	URLs []*models.URL
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// listCursor is the position after which a page starts. Links are ordered by
+// their sort key and then by short code, so every link has a unique position.
+type listCursor struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d"`
+	Key        int64  `json:"k"`
+	ShortCode  string `json:"c"`
+}
+
+// normalize validates query, applies defaults and decodes its cursor, which is
+// nil for the first page.
+func (query ListQuery) normalize() (ListQuery, *listCursor, error) {
+	if query.SortBy == "" {
+		query.SortBy = SortCreatedAt
+	}
+	switch query.SortBy {
+	case SortCreatedAt, SortAccessCount, SortExpiresAt:
+	default:
+		return query, nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, query.SortBy)
+	}
+	switch query.Status {
+	case "", StatusActive, StatusExpired:
+	default:
+		return query, nil, fmt.Errorf("%w: unknown status %q", ErrInvalidQuery, query.Status)
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultListLimit
+	}
+	query.Host = strings.ToLower(query.Host)
+	if query.Cursor == "" {
+		return query, nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return query, nil, ErrInvalidCursor
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return query, nil, ErrInvalidCursor
+	}
+	if cursor.SortBy != query.SortBy || cursor.Descending != query.Descending {
+		return query, nil, ErrInvalidCursor
+	}
+	return query, &cursor, nil
+}
+
+// encode returns the opaque form of cursor handed to clients.
+func (cursor listCursor) encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// after reports whether the link at (key, shortCode) comes after cursor.
+func (cursor listCursor) after(key int64, shortCode string) bool {
+	if key != cursor.Key {
+		return (key > cursor.Key) != cursor.Descending
+	}
+	if shortCode == cursor.ShortCode {
+		return false
+	}
+	return (shortCode > cursor.ShortCode) != cursor.Descending
+}
+
+// matches reports whether urlModel passes the filters of query.
+func (query ListQuery) matches(urlModel *models.URL, now time.Time) bool {
+	if query.Host != "" && !strings.Contains(urlHost(urlModel.LongURL), query.Host) {
+		return false
+	}
+	expired := !urlModel.ExpiresAt.IsZero() && now.After(urlModel.ExpiresAt)
+	if (query.Status == StatusActive && expired) || (query.Status == StatusExpired && !expired) {
+		return false
+	}
+	if !query.CreatedFrom.IsZero() && urlModel.CreatedAt.Before(query.CreatedFrom) {
+		return false
+	}
+	if !query.CreatedTo.IsZero() && !urlModel.CreatedAt.Before(query.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+// sortKey returns the value of urlModel that query orders by. Links without an
+// expiry sort after every link that has one.
+func (query ListQuery) sortKey(urlModel *models.URL) int64 {
+	switch query.SortBy {
+	case SortAccessCount:
+		return int64(urlModel.AccessCount)
+	case SortExpiresAt:
+		if urlModel.ExpiresAt.IsZero() {
+			return math.MaxInt64
+		}
+		return urlModel.ExpiresAt.UnixNano()
+	default:
+		return urlModel.CreatedAt.UnixNano()
+	}
+}
+
+// queryURLs answers query from a full snapshot of the store. It backs every
+// store that cannot filter and order links natively.
+func queryURLs(urls []*models.URL, query ListQuery) (*ListPage, error) {
+	query, cursor, err := query.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	type keyedURL struct {
+		key int64
+		url *models.URL
+	}
+	now := time.Now()
+	matched := make([]keyedURL, 0, len(urls))
+	for _, urlModel := range urls {
+		key := query.sortKey(urlModel)
+		if !query.matches(urlModel, now) || (cursor != nil && !cursor.after(key, urlModel.ShortCode)) {
+			continue
+		}
+		matched = append(matched, keyedURL{key: key, url: urlModel})
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if a.key != b.key {
+			return (a.key < b.key) != query.Descending
+		}
+		return (a.url.ShortCode < b.url.ShortCode) != query.Descending
+	})
+
+	page := &ListPage{}
+	for i, item := range matched {
+		if i == query.Limit {
+			last := matched[i-1]
+			page.NextCursor = listCursor{
+				SortBy:     query.SortBy,
+				Descending: query.Descending,
+				Key:        last.key,
+				ShortCode:  last.url.ShortCode,
+			}.encode()
+			break
+		}
+		page.URLs = append(page.URLs, item.url)
+	}
+	return page, nil
+}
+
+// urlHost returns the lower-cased host of a long URL, or "" if it cannot be parsed.
+func urlHost(longURL string) string {
+	parsedURL, err := url.Parse(longURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsedURL.Hostname())
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedQueryLinks stores links with distinct creation times, access counts and expiries.
+func seedQueryLinks(t *testing.T, store Store) time.Time {
+	t.Helper()
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	links := []struct {
+		url       string
+		code      string
+		hits      int
+		expiresIn time.Duration
+	}{
+		{"https://www.example.com/a", "q1", 3, 0},
+		{"https://blog.example.com/b", "q2", 1, 2 * time.Hour},
+		{"https://www.other.org/c", "q3", 5, time.Hour},
+		{"https://www.example.com/d", "q4", 0, 0},
+		{"https://WWW.Other.org/e", "q5", 2, 3 * time.Hour},
+	}
+	for i, link := range links {
+		urlModel := newURL(link.url, link.code, time.Time{})
+		urlModel.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if link.expiresIn > 0 {
+			urlModel.ExpiresAt = time.Now().Add(link.expiresIn)
+		}
+		_, _, err := store.CreateURL(urlModel)
+		require.NoError(t, err)
+		for j := 0; j < link.hits; j++ {
+			require.NoError(t, store.IncrementAccessCount(link.code))
+		}
+	}
+	return base
+}
+
+// queryAll follows cursors until the last page and returns the short codes in order.
+func queryAll(t *testing.T, store Store, query ListQuery) []string {
+	t.Helper()
+	var codes []string
+	for {
+		page, err := store.QueryURLs(query)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.URLs), query.Limit, "Page should respect the limit")
+		for _, urlModel := range page.URLs {
+			codes = append(codes, urlModel.ShortCode)
+		}
+		if page.NextCursor == "" {
+			return codes
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+func TestStore_QueryURLs(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		base := seedQueryLinks(t, store)
+
+		// Test case: Default order is by creation time, paged through cursors
+		assert.Equal(t, []string{"q1", "q2", "q3", "q4", "q5"}, queryAll(t, store, ListQuery{Limit: 2}))
+		assert.Equal(t, []string{"q5", "q4", "q3", "q2", "q1"}, queryAll(t, store, ListQuery{Limit: 2, Descending: true}))
+
+		// Test case: Sorting by access count
+		assert.Equal(t, []string{"q3", "q1", "q5", "q2", "q4"},
+			queryAll(t, store, ListQuery{SortBy: SortAccessCount, Descending: true, Limit: 3}))
+
+		// Test case: Sorting by expiry puts links without one last
+		assert.Equal(t, []string{"q3", "q2", "q5", "q1", "q4"},
+			queryAll(t, store, ListQuery{SortBy: SortExpiresAt, Limit: 2}))
+
+		// Test case: Host filter matches a case-insensitive substring of the host only
+		assert.Equal(t, []string{"q1", "q2", "q4"}, queryAll(t, store, ListQuery{Host: "Example.com", Limit: 10}))
+		assert.Equal(t, []string{"q3", "q5"}, queryAll(t, store, ListQuery{Host: "other", Limit: 10}))
+		assert.Empty(t, queryAll(t, store, ListQuery{Host: "/a", Limit: 10}), "Paths should not match the host filter")
+
+		// Test case: Creation date range is inclusive at the start and exclusive at the end
+		assert.Equal(t, []string{"q2", "q3"}, queryAll(t, store, ListQuery{
+			CreatedFrom: base.Add(time.Minute),
+			CreatedTo:   base.Add(3 * time.Minute),
+			Limit:       10,
+		}))
+
+		// Test case: Status filter
+		assert.Equal(t, []string{"q1", "q2", "q3", "q4", "q5"}, queryAll(t, store, ListQuery{Status: StatusActive, Limit: 10}))
+		assert.Empty(t, queryAll(t, store, ListQuery{Status: StatusExpired, Limit: 10}))
+
+		// Test case: Invalid queries and cursors
+		_, err := store.QueryURLs(ListQuery{SortBy: "long_url"})
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+		_, err = store.QueryURLs(ListQuery{Status: "deleted"})
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+		_, err = store.QueryURLs(ListQuery{Cursor: "not-a-cursor"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+		page, err := store.QueryURLs(ListQuery{Limit: 1})
+		require.NoError(t, err)
+		_, err = store.QueryURLs(ListQuery{Limit: 1, SortBy: SortAccessCount, Cursor: page.NextCursor})
+		assert.ErrorIs(t, err, ErrInvalidCursor, "Cursors should only continue the sort order they came from")
+	})
+}
+
+func TestStore_QueryURLsExpired(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		if _, ok := store.(*RedisStorage); ok {
+			t.Skip("Redis drops expired links on its own, so they are never listed")
+		}
+		_, _, err := store.CreateURL(newURL("https://www.active.com", "act1", time.Now().Add(time.Hour)))
+		require.NoError(t, err)
+		_, _, err = store.CreateURL(newURL("https://www.expired.com", "exp1", time.Now().Add(-time.Hour)))
+		require.NoError(t, err)
+		_, _, err = store.CreateURL(newURL("https://www.forever.com", "for1", time.Time{}))
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"exp1"}, queryAll(t, store, ListQuery{Status: StatusExpired, Limit: 10}))
+		assert.ElementsMatch(t, []string{"act1", "for1"}, queryAll(t, store, ListQuery{Status: StatusActive, Limit: 10}))
+	})
+}
+
+func TestQueryURLs_ConcurrentInsertKeepsPosition(t *testing.T) {
+	store := NewStorage()
+	for _, code := range []string{"k1", "k2", "k3"} {
+		urlModel := newURL("https://www.example.com/"+code, code, time.Time{})
+		urlModel.CreatedAt = time.Unix(1700000000, 0)
+		_, _, err := store.CreateURL(urlModel)
+		require.NoError(t, err)
+	}
+
+	page, err := store.QueryURLs(ListQuery{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k1", "k2"}, shortCodes(page.URLs), "Ties should be broken by short code")
+
+	// A link inserted before the cursor position must not shift the next page
+	_, _, err = store.CreateURL(&models.URL{BaseURL: models.BaseURL{LongURL: "https://www.example.com/k0", CreatedAt: time.Unix(1600000000, 0)}, ShortCode: "k0"})
+	require.NoError(t, err)
+	page, err = store.QueryURLs(ListQuery{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k3"}, shortCodes(page.URLs))
+	assert.Empty(t, page.NextCursor, "Last page should not have a cursor")
+}
+
+// shortCodes returns the short codes of urls, in order.
+func shortCodes(urls []*models.URL) []string {
+	codes := make([]string, 0, len(urls))
+	for _, urlModel := range urls {
+		codes = append(codes, urlModel.ShortCode)
+	}
+	return codes
+}
@@ -0,0 +1,904 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Codedude1/shorty/analytics"
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisKeyPrefix namespaces every key written by RedisStorage.
+const DefaultRedisKeyPrefix = "shorty:"
+
+// redisTimeout bounds every Redis round trip made by the store.
+const redisTimeout = 2 * time.Second
+
+// redisClickStreamMaxLen caps the click event stream; older events are trimmed
+// approximately so appends stay cheap.
+const redisClickStreamMaxLen = 1000000
+
+// redisWatchRetries caps how often a watched transaction is retried when a key changes.
+const redisWatchRetries = 10
+
+// redisListBatch is the number of links QueryURLs and ListURLs read per round trip.
+const redisListBatch = 200
+
+// Status codes returned by createScript.
+const (
+	redisCreated   = 1
+	redisDuplicate = 0
+	redisCodeTaken = -1
+)
+
+// createScript inserts a mapping only if the short code is free and, when
+// deduplicating, the long URL is not indexed yet, so the check and insert happen
+// atomically. New mappings are added to the creation and expiry indexes.
+// KEYS: url key, count key, long URL key, creation index key, expiry index key.
+// ARGV: URL JSON, short code, expiry in unix ms (0 for none), 1 to deduplicate by
+// long URL and tags, creation time in unix ms.
+var createScript = redis.NewScript(`
+local dedup = ARGV[4] == '1'
+if dedup then
+	local existing = redis.call('GET', KEYS[3])
+	if existing then
+		return {existing, 0}
+	end
+end
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return {'', -1}
+end
+redis.call('SET', KEYS[1], ARGV[1])
+redis.call('SET', KEYS[2], 0)
+local written = 2
+if dedup then
+	redis.call('SET', KEYS[3], ARGV[2])
+	written = 3
+end
+redis.call('ZADD', KEYS[4], ARGV[5], ARGV[2])
+local expireAt = tonumber(ARGV[3])
+if expireAt > 0 then
+	for i = 1, written do
+		redis.call('PEXPIREAT', KEYS[i], expireAt)
+	end
+	redis.call('ZADD', KEYS[5], expireAt, ARGV[2])
+end
+return {ARGV[2], 1}
+`)
+
+// removeExpiredScript drops up to ARGV[2] links that expired by ARGV[1] from
+// the creation and expiry indexes; Redis has already expired their keys.
+// KEYS: creation index key, expiry index key.
+// ARGV: the current time in unix ms, the batch size.
+var removeExpiredScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #due > 0 then
+	redis.call('ZREM', KEYS[1], unpack(due))
+	redis.call('ZREM', KEYS[2], unpack(due))
+end
+return #due
+`)
+
+// incrementScript bumps the counter only while the mapping exists, so hits on a
+// just-expired code cannot recreate a counter key without a TTL. Links with a
+// max_clicks limit are not counted past it, and -1 is returned instead.
+// KEYS: url key, count key.
+var incrementScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return 0
+end
+local limit = cjson.decode(data).max_clicks
+if limit and tonumber(redis.call('GET', KEYS[2]) or '0') >= limit then
+	return -1
+end
+return redis.call('INCR', KEYS[2])
+`)
+
+// incrementBotScript bumps the bot counter only while the mapping exists. The
+// counter is created on first use, so it takes over the TTL of the mapping.
+// KEYS: url key, bot count key.
+var incrementBotScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local count = redis.call('INCR', KEYS[2])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return count
+`)
+
+// countClicksScript adds click counts and visitor IDs to rollup buckets only
+// while the mapping exists, so late clicks on a deleted code cannot recreate its
+// buckets. Every bucket key is recorded in the bucket index of the link, scored
+// by when it expires, and expired ones are trimmed from it. The lifetime visitor
+// sketch and the bucket index share the TTL of the mapping.
+// KEYS: url key, lifetime visitors key, bucket index key, then per bucket its
+// count and visitors keys.
+// ARGV: the current time in unix ms, then per bucket the count to add, the
+// bucket TTL in ms, the number of visitor IDs and the IDs themselves.
+var countClicksScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local now = tonumber(ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', now)
+local arg = 2
+for i = 4, #KEYS, 2 do
+	local ttl, n = ARGV[arg + 1], tonumber(ARGV[arg + 2])
+	local expireAt = now + tonumber(ttl)
+	redis.call('INCRBY', KEYS[i], ARGV[arg])
+	redis.call('PEXPIRE', KEYS[i], ttl)
+	redis.call('ZADD', KEYS[3], expireAt, KEYS[i])
+	if n > 0 then
+		local ids = {unpack(ARGV, arg + 3, arg + 2 + n)}
+		redis.call('PFADD', KEYS[i + 1], unpack(ids))
+		redis.call('PEXPIRE', KEYS[i + 1], ttl)
+		redis.call('ZADD', KEYS[3], expireAt, KEYS[i + 1])
+		redis.call('PFADD', KEYS[2], unpack(ids))
+	end
+	arg = arg + 3 + n
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+	redis.call('PEXPIRE', KEYS[3], ttl)
+end
+return 1
+`)
+
+// countBreakdownsScript adds click counts to the breakdown sorted sets of a link
+// only while the mapping exists. New values are counted as ARGV[2] once a set
+// holds ARGV[1] members. The sets share the TTL of the mapping.
+// KEYS: url key, then one breakdown key per dimension.
+// ARGV: value cap, overflow value, then per dimension the number of values and
+// that many value, count pairs.
+var countBreakdownsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local limit = tonumber(ARGV[1])
+local ttl = redis.call('PTTL', KEYS[1])
+local arg = 3
+for i = 2, #KEYS do
+	local n = tonumber(ARGV[arg])
+	arg = arg + 1
+	for j = 1, n do
+		local value, count = ARGV[arg], ARGV[arg + 1]
+		arg = arg + 2
+		if not redis.call('ZSCORE', KEYS[i], value) and redis.call('ZCARD', KEYS[i]) >= limit then
+			value = ARGV[2]
+		end
+		redis.call('ZINCRBY', KEYS[i], count, value)
+	end
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[i], ttl)
+	end
+end
+return 1
+`)
+
+// RedisStorage is a Store backed by Redis. Expiry uses native key TTLs, access
+// counts use INCR and the long URL dedup index is kept in reverse keys. Links
+// are listed from a sorted set of short codes scored by creation time, and a
+// second one scored by expiry lets cleanups drop expired links from it.
+type RedisStorage struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStorage returns a Store using client, verifying the connection first.
+func NewRedisStorage(client redis.UniversalClient, prefix string) (*RedisStorage, error) {
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return &RedisStorage{client: client, prefix: prefix}, nil
+}
+
+func (r *RedisStorage) urlKey(shortCode string) string   { return r.prefix + "url:" + shortCode }
+func (r *RedisStorage) countKey(shortCode string) string { return r.prefix + "count:" + shortCode }
+func (r *RedisStorage) longKey(url string) string        { return r.prefix + "long:" + url }
+func (r *RedisStorage) clicksKey() string                { return r.prefix + "clicks" }
+func (r *RedisStorage) createdIndexKey() string          { return r.prefix + "index:created" }
+func (r *RedisStorage) expiryIndexKey() string           { return r.prefix + "index:expiry" }
+
+// botCountKey names the counter of redirects of shortCode classified as bots.
+func (r *RedisStorage) botCountKey(shortCode string) string {
+	return r.prefix + "botcount:" + shortCode
+}
+
+// clickCountKey names the rollup bucket of shortCode starting at start. Buckets
+// are separate keys so each one expires on its own once past its retention.
+func (r *RedisStorage) clickCountKey(shortCode string, granularity string, start time.Time) string {
+	return r.prefix + "clickcount:" + shortCode + ":" + granularity + ":" + strconv.FormatInt(start.Unix(), 10)
+}
+
+// visitorsKey names the HyperLogLog of the visitors behind a rollup bucket.
+func (r *RedisStorage) visitorsKey(shortCode string, granularity string, start time.Time) string {
+	return r.prefix + "visitors:" + shortCode + ":" + granularity + ":" + strconv.FormatInt(start.Unix(), 10)
+}
+
+// clickKeysKey names the sorted set of the rollup bucket and visitor sketch keys
+// of shortCode, scored by when they expire, so deletes find them without a scan.
+func (r *RedisStorage) clickKeysKey(shortCode string) string {
+	return r.prefix + "clickkeys:" + shortCode
+}
+
+// breakdownKey names the sorted set of clicks per value of one breakdown dimension of shortCode.
+func (r *RedisStorage) breakdownKey(shortCode string, dimension string) string {
+	return r.prefix + "breakdown:" + shortCode + ":" + dimension
+}
+
+// linkScopedKeys returns the keys that live exactly as long as the mapping of shortCode.
+func (r *RedisStorage) linkScopedKeys(shortCode string) []string {
+	keys := []string{r.countKey(shortCode), r.botCountKey(shortCode), r.lifetimeVisitorsKey(shortCode), r.clickKeysKey(shortCode)}
+	for _, dimension := range analytics.Dimensions {
+		keys = append(keys, r.breakdownKey(shortCode, dimension))
+	}
+	return keys
+}
+
+// lifetimeVisitorsKey names the HyperLogLog of every visitor of shortCode.
+func (r *RedisStorage) lifetimeVisitorsKey(shortCode string) string {
+	return r.prefix + "visitors:" + shortCode
+}
+
+// AddURL adds a new URL mapping, replacing any existing mapping for the short code.
+func (r *RedisStorage) AddURL(url string, shortCode string, expiresAt time.Time) error {
+	urlModel := newURL(url, shortCode, expiresAt)
+	data, err := json.Marshal(urlModel)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	ttl := redisTTL(expiresAt)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.urlKey(shortCode), data, ttl)
+		pipe.Set(ctx, r.countKey(shortCode), 0, ttl)
+		pipe.Del(ctx, r.botCountKey(shortCode))
+		if deduplicated(urlModel) {
+			pipe.Set(ctx, r.longKey(url), shortCode, ttl)
+		}
+		pipe.ZAdd(ctx, r.createdIndexKey(), redis.Z{Score: float64(urlModel.CreatedAt.UnixMilli()), Member: shortCode})
+		r.indexExpiry(ctx, pipe, shortCode, expiresAt)
+		return nil
+	})
+	return err
+}
+
+// indexExpiry queues the update of the expiry index entry of shortCode.
+func (r *RedisStorage) indexExpiry(ctx context.Context, pipe redis.Pipeliner, shortCode string, expiresAt time.Time) {
+	if expiresAt.IsZero() {
+		pipe.ZRem(ctx, r.expiryIndexKey(), shortCode)
+		return
+	}
+	pipe.ZAdd(ctx, r.expiryIndexKey(), redis.Z{Score: float64(expiresAt.UnixMilli()), Member: shortCode})
+}
+
+// CreateURL atomically stores urlModel, deduplicating generated links by long URL and tags.
+func (r *RedisStorage) CreateURL(urlModel *models.URL) (string, bool, error) {
+	data, err := json.Marshal(urlModel)
+	if err != nil {
+		return "", false, err
+	}
+	var expireAt int64
+	if !urlModel.ExpiresAt.IsZero() {
+		expireAt = urlModel.ExpiresAt.UnixMilli()
+	}
+	dedup := 1
+	if !deduplicated(urlModel) {
+		dedup = 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	shortCode := urlModel.ShortCode
+	keys := []string{r.urlKey(shortCode), r.countKey(shortCode), r.longKey(dedupKey(urlModel)), r.createdIndexKey(), r.expiryIndexKey()}
+	result, err := createScript.Run(ctx, r.client, keys, data, shortCode, expireAt, dedup, urlModel.CreatedAt.UnixMilli()).Slice()
+	if err != nil {
+		return "", false, err
+	}
+	if len(result) != 2 {
+		return "", false, fmt.Errorf("unexpected create script reply %v", result)
+	}
+	code, _ := result[0].(string)
+	status, _ := result[1].(int64)
+	switch status {
+	case redisCreated:
+		return code, true, nil
+	case redisDuplicate:
+		return code, false, nil
+	case redisCodeTaken:
+		return "", false, ErrShortCodeExists
+	default:
+		return "", false, fmt.Errorf("unexpected create script status %d", status)
+	}
+}
+
+// GetURL retrieves a URL model by its short code.
+func (r *RedisStorage) GetURL(shortCode string) (*models.URL, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	values, err := r.client.MGet(ctx, r.urlKey(shortCode), r.countKey(shortCode), r.botCountKey(shortCode)).Result()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load short code %s: %v", shortCode, err)
+		return nil, false
+	}
+	urlModel, err := decodeRedisURL(values[0], values[1], values[2])
+	if err != nil {
+		log.Printf("[ERROR] Failed to decode short code %s: %v", shortCode, err)
+		return nil, false
+	}
+	return urlModel, urlModel != nil
+}
+
+// GetShortCode retrieves the short code for a given long URL and tag set.
+func (r *RedisStorage) GetShortCode(url string, tags map[string]string) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	shortCode, err := r.client.Get(ctx, r.longKey(services.DedupKey(url, tags))).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("[ERROR] Failed to look up long URL %s: %v", url, err)
+		}
+		return "", false
+	}
+	return shortCode, true
+}
+
+// UpdateURL atomically applies update to the mapping for shortCode. The mapping
+// and the reverse keys it touches are watched, and the update is retried if any
+// of them changes before the transaction commits.
+func (r *RedisStorage) UpdateURL(shortCode string, update func(*models.URL) error) (*models.URL, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	var updated *models.URL
+	txf := func(tx *redis.Tx) error {
+		values, err := tx.MGet(ctx, r.urlKey(shortCode), r.countKey(shortCode), r.botCountKey(shortCode)).Result()
+		if err != nil {
+			return err
+		}
+		current, err := decodeRedisURL(values[0], values[1], values[2])
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return ErrURLNotFound
+		}
+		updated, err = applyUpdate(current, update)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(updated)
+		if err != nil {
+			return err
+		}
+
+		oldLongKey, newLongKey := r.longKey(dedupKey(current)), r.longKey(dedupKey(updated))
+		if err := tx.Watch(ctx, oldLongKey, newLongKey).Err(); err != nil {
+			return err
+		}
+		owners, err := tx.MGet(ctx, oldLongKey, newLongKey).Result()
+		if err != nil {
+			return err
+		}
+		oldOwner, _ := owners[0].(string)
+		newOwner, _ := owners[1].(string)
+
+		ttl := redisTTL(updated.ExpiresAt)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, r.urlKey(shortCode), data, ttl)
+			for _, key := range r.linkScopedKeys(shortCode) {
+				if ttl > 0 {
+					pipe.PExpire(ctx, key, ttl)
+				} else {
+					pipe.Persist(ctx, key)
+				}
+			}
+			if oldOwner == shortCode && (!deduplicated(updated) || oldLongKey != newLongKey) {
+				pipe.Del(ctx, oldLongKey)
+			}
+			if deduplicated(updated) && (newOwner == "" || newOwner == shortCode) {
+				pipe.Set(ctx, newLongKey, shortCode, ttl)
+			}
+			r.indexExpiry(ctx, pipe, shortCode, updated.ExpiresAt)
+			return nil
+		})
+		return err
+	}
+
+	if err := r.watch(ctx, txf, r.urlKey(shortCode)); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteURL removes a URL mapping, its reverse index entry and its click rollups.
+// The mapping is watched so a concurrent retarget cannot leave a reverse key behind.
+func (r *RedisStorage) DeleteURL(shortCode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, r.urlKey(shortCode)).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		urlModel, err := decodeRedisURL(data, nil, nil)
+		if err != nil {
+			return err
+		}
+		longKey := r.longKey(dedupKey(urlModel))
+		if err := tx.Watch(ctx, longKey).Err(); err != nil {
+			return err
+		}
+		owner, err := tx.Get(ctx, longKey).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, r.urlKey(shortCode), r.countKey(shortCode), r.botCountKey(shortCode))
+			if owner == shortCode {
+				pipe.Del(ctx, longKey)
+			}
+			pipe.ZRem(ctx, r.createdIndexKey(), shortCode)
+			pipe.ZRem(ctx, r.expiryIndexKey(), shortCode)
+			return nil
+		})
+		return err
+	}, r.urlKey(shortCode))
+	if err != nil {
+		return err
+	}
+	return r.deleteClickCounts(ctx, shortCode)
+}
+
+// deleteClickCounts removes every rollup bucket, visitor sketch and breakdown of
+// shortCode, taking the bucket keys from its bucket index. The mapping is already
+// gone, so countClicksScript cannot add new ones meanwhile.
+func (r *RedisStorage) deleteClickCounts(ctx context.Context, shortCode string) error {
+	keys, err := r.client.ZRange(ctx, r.clickKeysKey(shortCode), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	keys = append(keys, r.linkScopedKeys(shortCode)...)
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// IncrementAccessCount increments the access count with INCR.
+func (r *RedisStorage) IncrementAccessCount(shortCode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	keys := []string{r.urlKey(shortCode), r.countKey(shortCode)}
+	count, err := incrementScript.Run(ctx, r.client, keys).Int64()
+	if err != nil {
+		return err
+	}
+	if count < 0 {
+		return ErrClickLimitReached
+	}
+	return nil
+}
+
+// IncrementBotCount increments the bot count, which shares the TTL of the mapping.
+func (r *RedisStorage) IncrementBotCount(shortCode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	keys := []string{r.urlKey(shortCode), r.botCountKey(shortCode)}
+	return incrementBotScript.Run(ctx, r.client, keys).Err()
+}
+
+// WriteClicks appends click events to a capped stream using the AccessLogs field names.
+func (r *RedisStorage) WriteClicks(events []models.ClickEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, event := range events {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: r.clicksKey(),
+				MaxLen: redisClickStreamMaxLen,
+				Approx: true,
+				Values: map[string]any{
+					"short_code":      event.ShortCode,
+					"accessed_at":     event.AccessedAt.UTC().Format(time.RFC3339Nano),
+					"referrer":        event.Referrer,
+					"user_agent":      event.UserAgent,
+					"ip_address":      event.IPAddress,
+					"accept_language": event.AcceptLanguage,
+					"is_bot":          event.Bot,
+				},
+			})
+		}
+		return nil
+	})
+	return err
+}
+
+// CountClicks adds the human clicks among events to the click rollups, visitor
+// sketches and breakdowns, with two script calls per link. Each bucket expires once it is past the retention of its granularity.
+func (r *RedisStorage) CountClicks(events []models.ClickEvent) error {
+	type bucket struct {
+		count       int64
+		visitorIDs  []string
+		start       time.Time
+		granularity string
+		expireAt    time.Time
+	}
+	var order []string
+	buckets := make(map[string][]*bucket)
+	index := make(map[string]*bucket)
+	breakdowns := make(map[string]breakdownCounts)
+	for _, event := range humanClicks(events) {
+		if _, seen := buckets[event.ShortCode]; !seen {
+			order = append(order, event.ShortCode)
+			breakdowns[event.ShortCode] = make(breakdownCounts)
+		}
+		for i, value := range analytics.Classify(event) {
+			dimension := analytics.Dimensions[i]
+			if breakdowns[event.ShortCode][dimension] == nil {
+				breakdowns[event.ShortCode][dimension] = make(map[string]int64)
+			}
+			breakdowns[event.ShortCode][dimension][value]++
+		}
+		for _, g := range clickGranularities {
+			start := event.AccessedAt.UTC().Truncate(g.size)
+			key := r.clickCountKey(event.ShortCode, g.name, start)
+			b, exists := index[key]
+			if !exists {
+				b = &bucket{start: start, granularity: g.name, expireAt: start.Add(g.size + g.retention)}
+				index[key] = b
+				buckets[event.ShortCode] = append(buckets[event.ShortCode], b)
+			}
+			b.count++
+			if event.VisitorID != "" {
+				b.visitorIDs = append(b.visitorIDs, event.VisitorID)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	for _, shortCode := range order {
+		keys := []string{r.urlKey(shortCode), r.lifetimeVisitorsKey(shortCode), r.clickKeysKey(shortCode)}
+		args := []any{time.Now().UnixMilli()}
+		for _, b := range buckets[shortCode] {
+			keys = append(keys,
+				r.clickCountKey(shortCode, b.granularity, b.start),
+				r.visitorsKey(shortCode, b.granularity, b.start),
+			)
+			args = append(args, b.count, time.Until(b.expireAt).Milliseconds(), len(b.visitorIDs))
+			for _, visitorID := range b.visitorIDs {
+				args = append(args, visitorID)
+			}
+		}
+		if err := countClicksScript.Run(ctx, r.client, keys, args...).Err(); err != nil {
+			return err
+		}
+
+		keys = []string{r.urlKey(shortCode)}
+		args = []any{maxBreakdownValues, analytics.ValueOther}
+		for _, dimension := range analytics.Dimensions {
+			values := breakdowns[shortCode][dimension]
+			keys = append(keys, r.breakdownKey(shortCode, dimension))
+			args = append(args, len(values))
+			for value, count := range values {
+				args = append(args, value, count)
+			}
+		}
+		if err := countBreakdownsScript.Run(ctx, r.client, keys, args...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Breakdowns returns the limit most clicked values of every breakdown dimension
+// of shortCode. Values with the same count come in reverse lexical order.
+func (r *RedisStorage) Breakdowns(shortCode string, limit int) (map[string][]models.BreakdownEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	ranges := make([]*redis.ZSliceCmd, len(analytics.Dimensions))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, dimension := range analytics.Dimensions {
+			ranges[i] = pipe.ZRevRangeWithScores(ctx, r.breakdownKey(shortCode, dimension), 0, int64(limit-1))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	top := make(map[string][]models.BreakdownEntry, len(analytics.Dimensions))
+	for i, dimension := range analytics.Dimensions {
+		entries := []models.BreakdownEntry{}
+		for _, member := range ranges[i].Val() {
+			value, _ := member.Member.(string)
+			entries = append(entries, models.BreakdownEntry{Value: value, Count: int64(member.Score)})
+		}
+		top[dimension] = entries
+	}
+	return top, nil
+}
+
+// ClickSeries returns the click counts of shortCode per bucket of granularity over [from, to).
+func (r *RedisStorage) ClickSeries(shortCode string, granularity string, from time.Time, to time.Time) ([]models.ClickBucket, error) {
+	g, starts, err := seriesBuckets(granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	counts := make([]*redis.StringCmd, len(starts))
+	visitors := make([]*redis.IntCmd, len(starts))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, start := range starts {
+			counts[i] = pipe.Get(ctx, r.clickCountKey(shortCode, g.name, start))
+			visitors[i] = pipe.PFCount(ctx, r.visitorsKey(shortCode, g.name, start))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	series := make([]models.ClickBucket, len(starts))
+	for i, start := range starts {
+		series[i] = models.ClickBucket{Start: start, UniqueVisitors: visitors[i].Val()}
+		if count, err := counts[i].Int64(); err == nil {
+			series[i].Count = count
+		} else if !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+	}
+	return series, nil
+}
+
+// UniqueVisitors estimates the distinct visitors of shortCode over its lifetime with PFCOUNT.
+func (r *RedisStorage) UniqueVisitors(shortCode string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return r.client.PFCount(ctx, r.lifetimeVisitorsKey(shortCode)).Result()
+}
+
+// CleanupExpiredURLs drops expired links from the link indexes in small
+// batches. Redis expires their keys, click rollups included, on its own.
+func (r *RedisStorage) CleanupExpiredURLs() error {
+	keys := []string{r.createdIndexKey(), r.expiryIndexKey()}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		removed, err := removeExpiredScript.Run(ctx, r.client, keys, time.Now().UnixMilli(), expiryBatchSize).Int()
+		cancel()
+		if err != nil {
+			return err
+		}
+		if removed < expiryBatchSize {
+			return nil
+		}
+	}
+}
+
+// ListURLs returns every URL mapping, reading the creation index in batches.
+func (r *RedisStorage) ListURLs() ([]*models.URL, error) {
+	var urls []*models.URL
+	for start := int64(0); ; start += redisListBatch {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		shortCodes, err := r.client.ZRange(ctx, r.createdIndexKey(), start, start+redisListBatch-1).Result()
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		batch, err := r.loadURLs(shortCodes)
+		if err != nil {
+			return nil, err
+		}
+		for _, urlModel := range batch {
+			if urlModel != nil {
+				urls = append(urls, urlModel)
+			}
+		}
+		if len(shortCodes) < redisListBatch {
+			return urls, nil
+		}
+	}
+}
+
+// QueryURLs pages links by creation time straight from the creation index,
+// reading them in batches until the page is full. Creation times are compared
+// as whole milliseconds, the resolution of the index. Other orders sort every
+// link in memory.
+func (r *RedisStorage) QueryURLs(query ListQuery) (*ListPage, error) {
+	query, cursor, err := query.normalize()
+	if err != nil {
+		return nil, err
+	}
+	if query.SortBy != SortCreatedAt {
+		urls, err := r.ListURLs()
+		if err != nil {
+			return nil, err
+		}
+		return queryURLs(urls, query)
+	}
+
+	// Narrow the score range to the cursor and the creation time filter
+	lowest, highest := int64(math.MinInt64), int64(math.MaxInt64)
+	if !query.CreatedFrom.IsZero() {
+		lowest = query.CreatedFrom.UnixMilli()
+	}
+	if !query.CreatedTo.IsZero() {
+		highest = query.CreatedTo.UnixMilli()
+	}
+	if cursor != nil && query.Descending {
+		highest = min(highest, cursor.Key)
+	} else if cursor != nil {
+		lowest = max(lowest, cursor.Key)
+	}
+	opt := redis.ZRangeBy{Min: redisScore(lowest), Max: redisScore(highest), Count: redisListBatch}
+
+	now := time.Now()
+	page := &ListPage{}
+	var lastKey int64
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		var members []redis.Z
+		if query.Descending {
+			members, err = r.client.ZRevRangeByScoreWithScores(ctx, r.createdIndexKey(), &opt).Result()
+		} else {
+			members, err = r.client.ZRangeByScoreWithScores(ctx, r.createdIndexKey(), &opt).Result()
+		}
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		shortCodes := make([]string, len(members))
+		for i, member := range members {
+			shortCodes[i], _ = member.Member.(string)
+		}
+		urls, err := r.loadURLs(shortCodes)
+		if err != nil {
+			return nil, err
+		}
+		for i, urlModel := range urls {
+			key := int64(members[i].Score)
+			if urlModel == nil || (cursor != nil && !cursor.after(key, urlModel.ShortCode)) || !query.matches(urlModel, now) {
+				continue
+			}
+			if len(page.URLs) == query.Limit {
+				page.NextCursor = listCursor{
+					SortBy:     query.SortBy,
+					Descending: query.Descending,
+					Key:        lastKey,
+					ShortCode:  page.URLs[len(page.URLs)-1].ShortCode,
+				}.encode()
+				return page, nil
+			}
+			page.URLs = append(page.URLs, urlModel)
+			lastKey = key
+		}
+		if len(members) < redisListBatch {
+			return page, nil
+		}
+		opt.Offset += redisListBatch
+	}
+}
+
+// loadURLs reads the mappings of shortCodes in one round trip. Mappings that
+// no longer exist are nil.
+func (r *RedisStorage) loadURLs(shortCodes []string) ([]*models.URL, error) {
+	if len(shortCodes) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	keys := make([]string, 0, 3*len(shortCodes))
+	for _, shortCode := range shortCodes {
+		keys = append(keys, r.urlKey(shortCode), r.countKey(shortCode), r.botCountKey(shortCode))
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]*models.URL, len(shortCodes))
+	for i := range shortCodes {
+		if urls[i], err = decodeRedisURL(values[3*i], values[3*i+1], values[3*i+2]); err != nil {
+			return nil, err
+		}
+	}
+	return urls, nil
+}
+
+// Close closes the Redis client.
+func (r *RedisStorage) Close() error {
+	return r.client.Close()
+}
+
+// watch runs txf in an optimistic transaction over keys, retrying when one of
+// them changes before the transaction commits.
+func (r *RedisStorage) watch(ctx context.Context, txf func(*redis.Tx) error, keys ...string) error {
+	for attempt := 0; attempt < redisWatchRetries; attempt++ {
+		err := r.client.Watch(ctx, txf, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("watched keys %v kept changing", keys)
+}
+
+// decodeRedisURL combines the stored URL JSON with its access and bot counters.
+// It returns nil without an error if the mapping does not exist.
+func decodeRedisURL(data any, count any, botCount any) (*models.URL, error) {
+	raw, ok := data.(string)
+	if !ok {
+		return nil, nil
+	}
+	var urlModel models.URL
+	if err := json.Unmarshal([]byte(raw), &urlModel); err != nil {
+		return nil, err
+	}
+	if countStr, ok := count.(string); ok {
+		accessCount, err := strconv.Atoi(countStr)
+		if err != nil {
+			return nil, err
+		}
+		urlModel.AccessCount = accessCount
+	}
+	if countStr, ok := botCount.(string); ok {
+		bots, err := strconv.Atoi(countStr)
+		if err != nil {
+			return nil, err
+		}
+		urlModel.BotCount = bots
+	}
+	return &urlModel, nil
+}
+
+// redisScore formats a sorted set score bound, where the extremes of int64
+// leave that side open.
+func redisScore(score int64) string {
+	switch score {
+	case math.MinInt64:
+		return "-inf"
+	case math.MaxInt64:
+		return "+inf"
+	default:
+		return strconv.FormatInt(score, 10)
+	}
+}
+
+// redisTTL converts an expiry time into a key TTL, where zero means no expiry.
+// Already expired links get the shortest TTL Redis accepts so they vanish immediately.
+func redisTTL(expiresAt time.Time) time.Duration {
+	if expiresAt.IsZero() {
+		return 0
+	}
+	if ttl := time.Until(expiresAt); ttl > time.Millisecond {
+		return ttl
+	}
+	return time.Millisecond
+}
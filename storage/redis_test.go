@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRedisStorage returns a store connected to an in-process Redis stand-in.
+func newTestRedisStorage(t *testing.T) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	store, err := NewRedisStorage(redis.NewClient(&redis.Options{Addr: server.Addr()}), "")
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func TestRedisStorage_AddAndGet(t *testing.T) {
+	store, _ := newTestRedisStorage(t)
+
+	assert.NoError(t, store.AddURL("https://www.example.com", "exmpl1", time.Time{}))
+	urlModel, exists := store.GetURL("exmpl1")
+	assert.True(t, exists, "Short code should exist in Redis")
+	assert.Equal(t, "https://www.example.com", urlModel.LongURL)
+	assert.Equal(t, "exmpl1", urlModel.ShortCode)
+	assert.Equal(t, 0, urlModel.AccessCount)
+	assert.True(t, urlModel.ExpiresAt.IsZero())
+
+	shortCode, exists := store.GetShortCode("https://www.example.com", nil)
+	assert.True(t, exists, "Reverse key should index the long URL")
+	assert.Equal(t, "exmpl1", shortCode)
+
+	_, exists = store.GetURL("nonexist")
+	assert.False(t, exists)
+	_, exists = store.GetShortCode("https://www.nonexistent.com", nil)
+	assert.False(t, exists)
+}
+
+func TestRedisStorage_NativeTTL(t *testing.T) {
+	store, server := newTestRedisStorage(t)
+
+	assert.NoError(t, store.AddURL("https://www.ttl.com", "ttl1", time.Now().Add(time.Hour)))
+	assert.NoError(t, store.IncrementAccessCount("ttl1"))
+	assert.NoError(t, store.IncrementBotCount("ttl1"))
+	assert.True(t, server.TTL(store.urlKey("ttl1")) > 0, "URL key should carry a TTL")
+	assert.True(t, server.TTL(store.countKey("ttl1")) > 0, "Counter key should keep its TTL after INCR")
+	assert.True(t, server.TTL(store.botCountKey("ttl1")) > 0, "Bot counter should take the TTL of the URL key")
+	assert.False(t, server.Exists(store.longKey("https://www.ttl.com")), "Expiring links should not be indexed")
+
+	// Redis drops the keys on its own once the TTL passes
+	server.FastForward(2 * time.Hour)
+	_, exists := store.GetURL("ttl1")
+	assert.False(t, exists, "Expired short code should be gone without a cleanup scan")
+	_, exists = store.GetShortCode("https://www.ttl.com", nil)
+	assert.False(t, exists, "Expired reverse key should be gone")
+
+	// Hits on an expired code must not recreate the counter
+	assert.NoError(t, store.IncrementAccessCount("ttl1"))
+	assert.NoError(t, store.IncrementBotCount("ttl1"))
+	assert.False(t, server.Exists(store.countKey("ttl1")), "Counter should not be recreated")
+	assert.False(t, server.Exists(store.botCountKey("ttl1")), "Bot counter should not be recreated")
+}
+
+func TestRedisStorage_IncrementAndDelete(t *testing.T) {
+	store, server := newTestRedisStorage(t)
+	assert.NoError(t, store.AddURL("https://www.twitter.com", "twit1", time.Time{}))
+
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, store.IncrementAccessCount("twit1"))
+	}
+	urlModel, exists := store.GetURL("twit1")
+	assert.True(t, exists)
+	assert.Equal(t, 3, urlModel.AccessCount, "Access count should come from the INCR counter")
+
+	// Click rollups are indexed per link, so deleting it needs no key space scan
+	assert.NoError(t, store.CountClicks([]models.ClickEvent{{ShortCode: "twit1", AccessedAt: time.Now(), VisitorID: "v1"}}))
+	buckets, err := server.ZMembers(store.clickKeysKey("twit1"))
+	require.NoError(t, err)
+	assert.Len(t, buckets, 2*len(clickGranularities), "Every bucket and visitor sketch key should be indexed")
+
+	assert.NoError(t, store.DeleteURL("twit1"))
+	_, exists = store.GetURL("twit1")
+	assert.False(t, exists)
+	_, exists = store.GetShortCode("https://www.twitter.com", nil)
+	assert.False(t, exists)
+	assert.Empty(t, server.Keys(), "Deleting should remove every key of the mapping")
+
+	// Deleting a missing code is a no-op
+	assert.NoError(t, store.DeleteURL("nonexist"))
+}
+
+func TestRedisStorage_CreateURL(t *testing.T) {
+	store, _ := newTestRedisStorage(t)
+
+	shortCode, created, err := store.CreateURL(newURL("https://www.create.com", "crt1", time.Time{}))
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "crt1", shortCode)
+
+	// Test case: Same long URL returns the existing short code
+	shortCode, created, err = store.CreateURL(newURL("https://www.create.com", "crt2", time.Time{}))
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "crt1", shortCode)
+
+	// Test case: Short code taken by another long URL
+	_, _, err = store.CreateURL(newURL("https://www.other.com", "crt1", time.Time{}))
+	assert.ErrorIs(t, err, ErrShortCodeExists)
+}
+
+func TestRedisStorage_CreateURLConcurrent(t *testing.T) {
+	store, _ := newTestRedisStorage(t)
+
+	// Many requests race to shorten the same URL under different candidate codes
+	const workers = 20
+	codes := make([]string, workers)
+	createdCount := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			shortCode, created, err := store.CreateURL(newURL("https://www.race.com", "race"+string(rune('a'+i)), time.Time{}))
+			assert.NoError(t, err)
+			mu.Lock()
+			defer mu.Unlock()
+			codes[i] = shortCode
+			if created {
+				createdCount++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, createdCount, "Exactly one mapping should be created")
+	for _, shortCode := range codes {
+		assert.Equal(t, codes[0], shortCode, "Every request should get the same short code")
+	}
+	urls, err := store.ListURLs()
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1, "Only one mapping should be stored")
+}
+
+func TestRedisStorage_LinkIndexes(t *testing.T) {
+	store, server := newTestRedisStorage(t)
+
+	// Test case: Pages span several index batches without scanning the key space
+	base := time.Now().Add(-time.Hour)
+	var expected []string
+	for i := 0; i < 2*redisListBatch+5; i++ {
+		shortCode := fmt.Sprintf("idx%03d", i)
+		urlModel := newURL("https://www.example.com/"+shortCode, shortCode, time.Time{})
+		urlModel.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		_, _, err := store.CreateURL(urlModel)
+		require.NoError(t, err)
+		expected = append(expected, shortCode)
+	}
+	assert.Equal(t, expected, queryAll(t, store, ListQuery{Limit: 70}))
+
+	// Test case: Deleted links leave the index
+	require.NoError(t, store.DeleteURL("idx000"))
+	members, err := server.ZMembers(store.createdIndexKey())
+	require.NoError(t, err)
+	assert.NotContains(t, members, "idx000")
+
+	// Test case: Expired links are skipped and dropped from the indexes by the cleanup
+	require.NoError(t, store.AddURL("https://www.ttl.com", "ttl1", time.Now().Add(-time.Minute)))
+	server.FastForward(time.Second)
+	page, err := store.QueryURLs(ListQuery{Descending: true, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, expected[len(expected)-1], page.URLs[0].ShortCode, "Expired links should not be listed")
+	require.NoError(t, store.CleanupExpiredURLs())
+	members, err = server.ZMembers(store.createdIndexKey())
+	require.NoError(t, err)
+	assert.NotContains(t, members, "ttl1")
+	assert.False(t, server.Exists(store.expiryIndexKey()), "Expiry index should be empty")
+}
+
+func TestRedisStorage_WriteClicks(t *testing.T) {
+	store, server := newTestRedisStorage(t)
+
+	events := []models.ClickEvent{
+		{ShortCode: "clk1", AccessedAt: time.Now(), Referrer: "https://news.example.com/", UserAgent: "curl/8.0"},
+		{ShortCode: "clk1", AccessedAt: time.Now(), IPAddress: "203.0.113.7", AcceptLanguage: "en-GB"},
+	}
+	assert.NoError(t, store.WriteClicks(events))
+
+	stream, err := server.Stream(store.clicksKey())
+	require.NoError(t, err)
+	require.Len(t, stream, 2, "Every click event should be appended")
+	assert.Contains(t, stream[0].Values, "https://news.example.com/", "Referrer should be stored")
+	assert.Contains(t, stream[1].Values, "203.0.113.7", "IP address should be stored")
+
+	urls, err := store.ListURLs()
+	assert.NoError(t, err)
+	assert.Empty(t, urls, "The click stream should not be listed as a link")
+}
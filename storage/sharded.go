@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+)
+
+// DefaultShardCount is the number of shards used when none is configured.
+const DefaultShardCount = 64
+
+// shardedEntry holds a stored URL with its access and bot counts kept outside
+// the model so redirects can bump them atomically under a shared lock.
+type shardedEntry struct {
+	url         *models.URL
+	accessCount atomic.Int64
+	botCount    atomic.Int64
+}
+
+// urlShard owns the short codes hashed to it, along with their click rollups.
+type urlShard struct {
+	mu     sync.RWMutex
+	urls   map[string]*shardedEntry
+	expiry expiryIndex
+	clicks *clickCounts
+}
+
+// longURLShard owns the long URL index entries hashed to it.
+type longURLShard struct {
+	mu    sync.RWMutex
+	codes map[string]string
+}
+
+// ShardedStorage is an in-memory Store that spreads short codes and the long URL
+// index over independently locked shards. Redirects only take a shard read lock,
+// so they never serialize behind each other or behind writes to other shards.
+//
+// Operations that touch both indexes always lock the long URL shard before the
+// short code shard to avoid deadlocks.
+type ShardedStorage struct {
+	urlShards  []*urlShard
+	longShards []*longURLShard
+}
+
+// NewShardedStorage returns a ShardedStorage with shardCount shards per index.
+func NewShardedStorage(shardCount int) *ShardedStorage {
+	if shardCount <= 0 {
+		shardCount = DefaultShardCount
+	}
+	s := &ShardedStorage{
+		urlShards:  make([]*urlShard, shardCount),
+		longShards: make([]*longURLShard, shardCount),
+	}
+	for i := 0; i < shardCount; i++ {
+		s.urlShards[i] = &urlShard{urls: make(map[string]*shardedEntry), clicks: newClickCounts()}
+		s.longShards[i] = &longURLShard{codes: make(map[string]string)}
+	}
+	return s
+}
+
+// shardIndex maps a key onto one of n shards using an allocation-free FNV-1a hash.
+func shardIndex(key string, n int) int {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	hash := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+	return int(hash % uint32(n))
+}
+
+func (s *ShardedStorage) urlShard(shortCode string) *urlShard {
+	return s.urlShards[shardIndex(shortCode, len(s.urlShards))]
+}
+
+func (s *ShardedStorage) longShard(url string) *longURLShard {
+	return s.longShards[shardIndex(url, len(s.longShards))]
+}
+
+// AddURL adds a new URL mapping, replacing any existing mapping for the short code.
+func (s *ShardedStorage) AddURL(url string, shortCode string, expiresAt time.Time) error {
+	longShard, codeShard := s.longShard(url), s.urlShard(shortCode)
+	longShard.mu.Lock()
+	defer longShard.mu.Unlock()
+	codeShard.mu.Lock()
+	defer codeShard.mu.Unlock()
+	urlModel := newURL(url, shortCode, expiresAt)
+	codeShard.urls[shortCode] = &shardedEntry{url: urlModel}
+	codeShard.expiry.schedule(shortCode, expiresAt)
+	if deduplicated(urlModel) {
+		longShard.codes[url] = shortCode
+	}
+	return nil
+}
+
+// CreateURL atomically stores a copy of urlModel, deduplicating generated links by long URL and tags.
+func (s *ShardedStorage) CreateURL(urlModel *models.URL) (string, bool, error) {
+	key := dedupKey(urlModel)
+	longShard, codeShard := s.longShard(key), s.urlShard(urlModel.ShortCode)
+	longShard.mu.Lock()
+	defer longShard.mu.Unlock()
+	if deduplicated(urlModel) {
+		if existing, exists := longShard.codes[key]; exists {
+			return existing, false, nil
+		}
+	}
+	codeShard.mu.Lock()
+	defer codeShard.mu.Unlock()
+	if _, exists := codeShard.urls[urlModel.ShortCode]; exists {
+		return "", false, ErrShortCodeExists
+	}
+	copied := *urlModel
+	entry := &shardedEntry{url: &copied}
+	entry.accessCount.Store(int64(copied.AccessCount))
+	entry.botCount.Store(int64(copied.BotCount))
+	codeShard.urls[copied.ShortCode] = entry
+	codeShard.expiry.schedule(copied.ShortCode, copied.ExpiresAt)
+	if deduplicated(&copied) {
+		longShard.codes[key] = copied.ShortCode
+	}
+	return copied.ShortCode, true, nil
+}
+
+// GetURL retrieves a copy of the URL model by its short code.
+func (s *ShardedStorage) GetURL(shortCode string) (*models.URL, bool) {
+	codeShard := s.urlShard(shortCode)
+	codeShard.mu.RLock()
+	defer codeShard.mu.RUnlock()
+	entry, exists := codeShard.urls[shortCode]
+	if !exists {
+		return nil, false
+	}
+	return entry.snapshot(), true
+}
+
+// GetShortCode retrieves the short code for a given long URL and tag set.
+func (s *ShardedStorage) GetShortCode(url string, tags map[string]string) (string, bool) {
+	key := services.DedupKey(url, tags)
+	longShard := s.longShard(key)
+	longShard.mu.RLock()
+	defer longShard.mu.RUnlock()
+	shortCode, exists := longShard.codes[key]
+	return shortCode, exists
+}
+
+// UpdateURL atomically applies update to the mapping for shortCode. The update is
+// computed outside the locks and retried if the mapping changed in the meantime.
+func (s *ShardedStorage) UpdateURL(shortCode string, update func(*models.URL) error) (*models.URL, error) {
+	codeShard := s.urlShard(shortCode)
+	for {
+		codeShard.mu.RLock()
+		entry, exists := codeShard.urls[shortCode]
+		var stored, current *models.URL
+		if exists {
+			stored, current = entry.url, entry.snapshot()
+		}
+		codeShard.mu.RUnlock()
+		if !exists {
+			return nil, ErrURLNotFound
+		}
+
+		updated, err := applyUpdate(current, update)
+		if err != nil {
+			return nil, err
+		}
+		if result, ok := s.replaceIf(entry, stored, updated); ok {
+			return result, nil
+		}
+	}
+}
+
+// replaceIf swaps the model of entry for updated if entry still holds stored,
+// moving its long URL index entry along, and returns the new snapshot.
+func (s *ShardedStorage) replaceIf(entry *shardedEntry, stored *models.URL, updated *models.URL) (*models.URL, bool) {
+	oldKey, newKey := dedupKey(stored), dedupKey(updated)
+	oldShard, newShard := s.longShard(oldKey), s.longShard(newKey)
+	// Lock both long URL shards in index order so concurrent retargets cannot deadlock.
+	first, second := oldShard, newShard
+	if shardIndex(newKey, len(s.longShards)) < shardIndex(oldKey, len(s.longShards)) {
+		first, second = newShard, oldShard
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	if second != first {
+		second.mu.Lock()
+		defer second.mu.Unlock()
+	}
+	codeShard := s.urlShard(stored.ShortCode)
+	codeShard.mu.Lock()
+	defer codeShard.mu.Unlock()
+
+	// Every write installs a new model, so pointer identity detects concurrent changes.
+	if codeShard.urls[stored.ShortCode] != entry || entry.url != stored {
+		return nil, false
+	}
+	if oldShard.codes[oldKey] == stored.ShortCode && (!deduplicated(updated) || newKey != oldKey) {
+		delete(oldShard.codes, oldKey)
+	}
+	entry.url = updated
+	if deduplicated(updated) {
+		if _, taken := newShard.codes[newKey]; !taken {
+			newShard.codes[newKey] = updated.ShortCode
+		}
+	}
+	if !updated.ExpiresAt.Equal(stored.ExpiresAt) {
+		codeShard.expiry.schedule(updated.ShortCode, updated.ExpiresAt)
+	}
+	return entry.snapshot(), true
+}
+
+// DeleteURL removes a URL mapping from the storage.
+func (s *ShardedStorage) DeleteURL(shortCode string) error {
+	for {
+		urlModel, exists := s.GetURL(shortCode)
+		if !exists {
+			return nil
+		}
+		// Retry if the link was retargeted between the read and the delete
+		if s.deleteIf(shortCode, dedupKey(urlModel), func(*models.URL) bool { return true }) {
+			return nil
+		}
+	}
+}
+
+// IncrementAccessCount atomically increments the access count under a shard read
+// lock. Click-limited links compare and swap, so only one redirect can take the
+// last click.
+func (s *ShardedStorage) IncrementAccessCount(shortCode string) error {
+	codeShard := s.urlShard(shortCode)
+	codeShard.mu.RLock()
+	defer codeShard.mu.RUnlock()
+	entry, exists := codeShard.urls[shortCode]
+	if !exists {
+		return nil
+	}
+	if entry.url.MaxClicks == 0 {
+		entry.accessCount.Add(1)
+		return nil
+	}
+	for {
+		count := entry.accessCount.Load()
+		if !clicksLeft(entry.url, int(count)) {
+			return ErrClickLimitReached
+		}
+		if entry.accessCount.CompareAndSwap(count, count+1) {
+			return nil
+		}
+	}
+}
+
+// IncrementBotCount atomically increments the bot count under a shard read lock.
+func (s *ShardedStorage) IncrementBotCount(shortCode string) error {
+	codeShard := s.urlShard(shortCode)
+	codeShard.mu.RLock()
+	defer codeShard.mu.RUnlock()
+	if entry, exists := codeShard.urls[shortCode]; exists {
+		entry.botCount.Add(1)
+	}
+	return nil
+}
+
+// CountClicks adds the human clicks among events to the click rollups of links
+// that still exist. Each shard keeps its own rollups, so counting only takes
+// shard read locks.
+func (s *ShardedStorage) CountClicks(events []models.ClickEvent) error {
+	for _, event := range humanClicks(events) {
+		codeShard := s.urlShard(event.ShortCode)
+		codeShard.mu.RLock()
+		if _, exists := codeShard.urls[event.ShortCode]; exists {
+			codeShard.clicks.add(event)
+		}
+		codeShard.mu.RUnlock()
+	}
+	return nil
+}
+
+// ClickSeries returns the click counts of shortCode per bucket of granularity over [from, to).
+func (s *ShardedStorage) ClickSeries(shortCode string, granularity string, from time.Time, to time.Time) ([]models.ClickBucket, error) {
+	g, starts, err := seriesBuckets(granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return s.urlShard(shortCode).clicks.series(shortCode, g, starts), nil
+}
+
+// UniqueVisitors estimates the distinct visitors of shortCode over its lifetime.
+func (s *ShardedStorage) UniqueVisitors(shortCode string) (int64, error) {
+	return s.urlShard(shortCode).clicks.uniqueVisitors(shortCode), nil
+}
+
+// Breakdowns returns the limit most clicked values of every breakdown dimension of shortCode.
+func (s *ShardedStorage) Breakdowns(shortCode string, limit int) (map[string][]models.BreakdownEntry, error) {
+	return s.urlShard(shortCode).clicks.topBreakdowns(shortCode, limit), nil
+}
+
+// CleanupExpiredURLs removes due links using each shard's expiry index, in
+// small batches, so only one shard is briefly blocked at a time. Click rollups
+// past their retention are dropped along the way.
+func (s *ShardedStorage) CleanupExpiredURLs() error {
+	now := time.Now()
+	for _, codeShard := range s.urlShards {
+		codeShard.clicks.prune(now)
+		for {
+			codeShard.mu.Lock()
+			due := codeShard.expiry.popDue(now, expiryBatchSize)
+			codeShard.mu.Unlock()
+
+			for _, item := range due {
+				urlModel, exists := s.GetURL(item.shortCode)
+				if !exists {
+					continue
+				}
+				// Skip stale index entries left behind by deletes or expiry changes
+				removed := s.deleteIf(item.shortCode, dedupKey(urlModel), func(current *models.URL) bool {
+					return current.ExpiresAt.Equal(item.expiresAt)
+				})
+				if removed {
+					expiredLinks.Add(1)
+				}
+			}
+			if len(due) < expiryBatchSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// ListURLs returns copies of every URL model in the storage.
+func (s *ShardedStorage) ListURLs() ([]*models.URL, error) {
+	var urls []*models.URL
+	for _, codeShard := range s.urlShards {
+		codeShard.mu.RLock()
+		for _, entry := range codeShard.urls {
+			urls = append(urls, entry.snapshot())
+		}
+		codeShard.mu.RUnlock()
+	}
+	return urls, nil
+}
+
+// QueryURLs filters, orders and pages a snapshot of every URL mapping.
+func (s *ShardedStorage) QueryURLs(query ListQuery) (*ListPage, error) {
+	urls, err := s.ListURLs()
+	if err != nil {
+		return nil, err
+	}
+	return queryURLs(urls, query)
+}
+
+// deleteIf removes shortCode if it still has the dedup key and matches the predicate,
+// re-checking under both locks because the mapping may have changed since it was read.
+func (s *ShardedStorage) deleteIf(shortCode string, key string, matches func(*models.URL) bool) bool {
+	longShard, codeShard := s.longShard(key), s.urlShard(shortCode)
+	longShard.mu.Lock()
+	defer longShard.mu.Unlock()
+	codeShard.mu.Lock()
+	defer codeShard.mu.Unlock()
+	entry, exists := codeShard.urls[shortCode]
+	if !exists || dedupKey(entry.url) != key || !matches(entry.url) {
+		return false
+	}
+	delete(codeShard.urls, shortCode)
+	codeShard.clicks.remove(shortCode)
+	if longShard.codes[key] == shortCode {
+		delete(longShard.codes, key)
+	}
+	return true
+}
+
+// snapshot returns a copy of the entry's URL model with the current access and bot counts.
+func (e *shardedEntry) snapshot() *models.URL {
+	copied := *e.url
+	copied.AccessCount = int(e.accessCount.Load())
+	copied.BotCount = int(e.botCount.Load())
+	return &copied
+}
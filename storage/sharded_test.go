@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedStorage_Basics(t *testing.T) {
+	store := NewShardedStorage(4)
+
+	// Test case: Add and look up in both directions
+	assert.NoError(t, store.AddURL("https://www.example.com", "exmpl1", time.Time{}))
+	urlModel, exists := store.GetURL("exmpl1")
+	assert.True(t, exists, "Short code should exist in storage")
+	assert.Equal(t, "https://www.example.com", urlModel.LongURL)
+	assert.Equal(t, 0, urlModel.AccessCount)
+	shortCode, exists := store.GetShortCode("https://www.example.com", nil)
+	assert.True(t, exists)
+	assert.Equal(t, "exmpl1", shortCode)
+
+	// Test case: Increments show up in later reads
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, store.IncrementAccessCount("exmpl1"))
+	}
+	urlModel, _ = store.GetURL("exmpl1")
+	assert.Equal(t, 3, urlModel.AccessCount)
+
+	// Test case: CreateURL deduplicates and detects taken codes
+	shortCode, created, err := store.CreateURL(newURL("https://www.example.com", "exmpl2", time.Time{}))
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "exmpl1", shortCode)
+	_, _, err = store.CreateURL(newURL("https://www.other.com", "exmpl1", time.Time{}))
+	assert.ErrorIs(t, err, ErrShortCodeExists)
+
+	// Test case: Delete removes both index entries
+	assert.NoError(t, store.DeleteURL("exmpl1"))
+	_, exists = store.GetURL("exmpl1")
+	assert.False(t, exists)
+	_, exists = store.GetShortCode("https://www.example.com", nil)
+	assert.False(t, exists)
+	assert.NoError(t, store.DeleteURL("nonexist"))
+}
+
+func TestShardedStorage_CleanupAndList(t *testing.T) {
+	store := NewShardedStorage(4)
+	assert.NoError(t, store.AddURL("https://www.unexpired.com", "unexp1", time.Now().Add(2*time.Hour)))
+	assert.NoError(t, store.AddURL("https://www.expired.com", "expd1", time.Now().Add(-time.Hour)))
+	assert.NoError(t, store.AddURL("https://www.noexpiry.com", "noexp1", time.Time{}))
+
+	assert.NoError(t, store.CleanupExpiredURLs())
+
+	_, exists := store.GetShortCode("https://www.expired.com", nil)
+	assert.False(t, exists, "Expired long URL should be removed from the index")
+	urls, err := store.ListURLs()
+	assert.NoError(t, err)
+	var codes []string
+	for _, urlModel := range urls {
+		codes = append(codes, urlModel.ShortCode)
+	}
+	assert.ElementsMatch(t, []string{"unexp1", "noexp1"}, codes)
+}
+
+func TestShardedStorage_ConcurrentAccess(t *testing.T) {
+	store := NewShardedStorage(8)
+	const codes = 16
+	const hitsPerCode = 100
+	for i := 0; i < codes; i++ {
+		assert.NoError(t, store.AddURL(fmt.Sprintf("https://www.site%d.com", i), fmt.Sprintf("s%d", i), time.Time{}))
+	}
+
+	// Redirect every code concurrently while other goroutines create new links
+	var wg sync.WaitGroup
+	for i := 0; i < codes; i++ {
+		for j := 0; j < hitsPerCode; j++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				store.IncrementAccessCount(fmt.Sprintf("s%d", i))
+			}(i)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store.CreateURL(newURL(fmt.Sprintf("https://www.new%d.com", i), fmt.Sprintf("n%d", i), time.Time{}))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < codes; i++ {
+		urlModel, exists := store.GetURL(fmt.Sprintf("s%d", i))
+		assert.True(t, exists)
+		assert.Equal(t, hitsPerCode, urlModel.AccessCount, "No increments should be lost")
+	}
+	urls, _ := store.ListURLs()
+	assert.Len(t, urls, 2*codes)
+}
+
+// benchmarkRedirects simulates parallel redirect traffic: a lookup followed by
+// an access count increment, spread over a fixed set of short codes.
+func benchmarkRedirects(b *testing.B, store Store) {
+	const codes = 1024
+	for i := 0; i < codes; i++ {
+		store.AddURL(fmt.Sprintf("https://www.site%d.com", i), fmt.Sprintf("code%d", i), time.Time{})
+	}
+	shortCodes := make([]string, codes)
+	for i := range shortCodes {
+		shortCodes[i] = fmt.Sprintf("code%d", i)
+	}
+
+	var next atomic.Uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := next.Add(1) * 7919
+		for pb.Next() {
+			shortCode := shortCodes[i%codes]
+			if _, exists := store.GetURL(shortCode); exists {
+				store.IncrementAccessCount(shortCode)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkRedirect_Storage(b *testing.B) {
+	benchmarkRedirects(b, NewStorage())
+}
+
+func BenchmarkRedirect_ShardedStorage(b *testing.B) {
+	benchmarkRedirects(b, NewShardedStorage(DefaultShardCount))
+}
@@ -0,0 +1,951 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Codedude1/shorty/analytics"
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+
+	// The pure-Go SQLite driver lets the SQL store run without cgo or a server.
+	"modernc.org/sqlite"
+)
+
+// sqliteDriver is the database/sql driver name registered by modernc.org/sqlite.
+const sqliteDriver = "sqlite"
+
+func init() {
+	// url_host(long_url) exposes urlHost to queries so host filters match the
+	// other stores exactly.
+	sqlite.MustRegisterDeterministicScalarFunction("url_host", 1,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			longURL, _ := args[0].(string)
+			return urlHost(longURL), nil
+		},
+	)
+}
+
+// sqlMigrations holds the schema history. Each entry is applied once, in order,
+// and its 1-based index is recorded in schema_migrations. Append new migrations;
+// never edit ones that have shipped.
+var sqlMigrations = []string{
+	// 1: URLMappings and AccessLogs as documented in the README.
+	`CREATE TABLE URLMappings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		long_url TEXT NOT NULL UNIQUE,
+		short_code VARCHAR(10) NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		access_count INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME
+	);
+	CREATE TABLE AccessLogs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code VARCHAR(10) NOT NULL,
+		accessed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		user_agent TEXT,
+		ip_address VARCHAR(45),
+		FOREIGN KEY (short_code) REFERENCES URLMappings(short_code)
+	);
+	CREATE INDEX idx_accesslogs_short_code ON AccessLogs(short_code);`,
+	// 2: Expression index so expiry sweeps find due links without a table scan.
+	`CREATE INDEX idx_urlmappings_expires_at ON URLMappings(julianday(expires_at));`,
+	// 3: Custom aliases. Duplicate detection moves from the unique long_url column
+	// to dedup_key, which is NULL for aliases so one destination can have several
+	// codes. SQLite cannot drop a constraint in place, so both tables are rebuilt;
+	// AccessLogs is rebuilt first so dropping the old URLMappings orphans nothing.
+	`CREATE TABLE URLMappings_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		long_url TEXT NOT NULL,
+		short_code VARCHAR(64) NOT NULL UNIQUE,
+		dedup_key TEXT UNIQUE,
+		is_alias INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		access_count INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME
+	);
+	INSERT INTO URLMappings_new (id, long_url, short_code, dedup_key, created_at, access_count, expires_at)
+		SELECT id, long_url, short_code, long_url, created_at, access_count, expires_at FROM URLMappings;
+	CREATE TABLE AccessLogs_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code VARCHAR(64) NOT NULL,
+		accessed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		user_agent TEXT,
+		ip_address VARCHAR(45),
+		FOREIGN KEY (short_code) REFERENCES URLMappings_new(short_code)
+	);
+	INSERT INTO AccessLogs_new (id, short_code, accessed_at, user_agent, ip_address)
+		SELECT id, short_code, accessed_at, user_agent, ip_address FROM AccessLogs;
+	DROP TABLE AccessLogs;
+	DROP TABLE URLMappings;
+	ALTER TABLE URLMappings_new RENAME TO URLMappings;
+	ALTER TABLE AccessLogs_new RENAME TO AccessLogs;
+	CREATE INDEX idx_accesslogs_short_code ON AccessLogs(short_code);
+	CREATE INDEX idx_urlmappings_expires_at ON URLMappings(julianday(expires_at));`,
+	// 4: Links can be disabled without deleting them.
+	`ALTER TABLE URLMappings ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;`,
+	// 5: Click events carry the referrer and preferred languages.
+	`ALTER TABLE AccessLogs ADD COLUMN referrer TEXT;
+	ALTER TABLE AccessLogs ADD COLUMN accept_language TEXT;`,
+	// 6: Click rollups per link, granularity and UTC bucket start (Unix seconds).
+	`CREATE TABLE ClickCounts (
+		short_code VARCHAR(64) NOT NULL,
+		granularity TEXT NOT NULL,
+		bucket_start INTEGER NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (short_code, granularity, bucket_start),
+		FOREIGN KEY (short_code) REFERENCES URLMappings(short_code)
+	);
+	CREATE INDEX idx_clickcounts_granularity_bucket ON ClickCounts(granularity, bucket_start);`,
+	// 7: HyperLogLog sketch of the visitors behind each rollup, for unique visitor counts.
+	`ALTER TABLE ClickCounts ADD COLUMN visitors BLOB;`,
+	// 8: Lifetime clicks per link by referrer domain, browser, OS, device and country.
+	`CREATE TABLE ClickBreakdowns (
+		short_code VARCHAR(64) NOT NULL,
+		dimension TEXT NOT NULL,
+		value TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (short_code, dimension, value),
+		FOREIGN KEY (short_code) REFERENCES URLMappings(short_code)
+	);`,
+	// 9: Redirects classified as bots are counted apart from access_count and flagged in the access log.
+	`ALTER TABLE URLMappings ADD COLUMN bot_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE AccessLogs ADD COLUMN is_bot INTEGER NOT NULL DEFAULT 0;`,
+	// 10: Per-link redirect status code; 0 uses the server default.
+	`ALTER TABLE URLMappings ADD COLUMN redirect_code INTEGER NOT NULL DEFAULT 0;`,
+	// 11: Per-link query string and path suffix passthrough.
+	`ALTER TABLE URLMappings ADD COLUMN query_mode TEXT NOT NULL DEFAULT '';
+	ALTER TABLE URLMappings ADD COLUMN forward_path INTEGER NOT NULL DEFAULT 0;`,
+	// 12: Query parameters appended on redirect, encoded as a sorted query string. They
+	// are part of dedup_key, so one destination can be shortened once per campaign.
+	`ALTER TABLE URLMappings ADD COLUMN tags TEXT NOT NULL DEFAULT '';`,
+	// 13: Visits allowed before a link is gone; 0 for no limit.
+	`ALTER TABLE URLMappings ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0;`,
+	// 14: Scheduled links do not resolve before activates_at.
+	`ALTER TABLE URLMappings ADD COLUMN activates_at DATETIME;`,
+	// 15: bcrypt hash of the password protecting a link; '' for open links.
+	`ALTER TABLE URLMappings ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';`,
+	// 16: Links flagged as suspicious show a warning before redirecting.
+	`ALTER TABLE URLMappings ADD COLUMN flagged INTEGER NOT NULL DEFAULT 0;`,
+	// 17: Links with their own redirect status are no longer returned for duplicate submissions.
+	`UPDATE URLMappings SET dedup_key = NULL WHERE redirect_code != 0;`,
+	// 18: Nor are links with passthrough options.
+	`UPDATE URLMappings SET dedup_key = NULL WHERE query_mode != '' OR forward_path != 0;`,
+	// 19: Nor are expiring links.
+	`UPDATE URLMappings SET dedup_key = NULL WHERE expires_at IS NOT NULL;`,
+}
+
+// urlColumns lists the URLMappings columns read by scanURL, in order.
+const urlColumns = "short_code, long_url, is_alias, disabled, flagged, redirect_code, query_mode, forward_path, tags, max_clicks, password_hash, created_at, access_count, bot_count, activates_at, expires_at"
+
+// sqlSortKeys maps each sort field to the SQL expression QueryURLs orders by.
+// Times are compared as whole milliseconds and links without expiry sort last.
+var sqlSortKeys = map[string]string{
+	SortCreatedAt:   "CAST(julianday(created_at) * 86400000 AS INTEGER)",
+	SortAccessCount: "access_count",
+	SortExpiresAt:   "COALESCE(CAST(julianday(expires_at) * 86400000 AS INTEGER), 9223372036854775807)",
+}
+
+// SQLStorage is a Store backed by a database/sql connection using the README schema.
+type SQLStorage struct {
+	db *sql.DB
+
+	// clicksPrunedAt rate-limits the removal of click rollups past their retention.
+	pruneMu        sync.Mutex
+	clicksPrunedAt time.Time
+}
+
+// NewSQLiteStorage opens the SQLite database at path and migrates it to the latest schema.
+func NewSQLiteStorage(path string) (*SQLStorage, error) {
+	db, err := sql.Open(sqliteDriver, sqliteDSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+	// SQLite allows a single writer; one connection avoids "database is locked"
+	// errors and keeps ":memory:" databases from splitting across connections.
+	db.SetMaxOpenConns(1)
+	return NewSQLStorage(db)
+}
+
+// NewSQLStorage wraps an open database and migrates it to the latest schema.
+func NewSQLStorage(db *sql.DB) (*SQLStorage, error) {
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLStorage{db: db}, nil
+}
+
+// sqliteDSN appends the pragmas the SQL store relies on to a SQLite path.
+func sqliteDSN(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+}
+
+// migrate applies every migration newer than the version recorded in the database.
+func migrate(db *sql.DB) error {
+	return applyMigrations(db, sqlMigrations)
+}
+
+// applyMigrations brings db up to len(migrations), one transaction per migration.
+func applyMigrations(db *sql.DB, migrations []string) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", current, len(migrations))
+	}
+
+	for version := current + 1; version <= len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version-1]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %d: %w", version, err)
+		}
+		log.Printf("[INFO] Applied database migration %d", version)
+	}
+	return nil
+}
+
+// AddURL adds a new URL mapping, replacing any existing mapping for the short code.
+func (s *SQLStorage) AddURL(url string, shortCode string, expiresAt time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT INTO URLMappings (long_url, short_code, dedup_key, is_alias, created_at, access_count, expires_at)
+		VALUES (?, ?, ?, 0, ?, 0, ?)
+		ON CONFLICT(short_code) DO UPDATE SET
+			long_url = excluded.long_url,
+			dedup_key = excluded.dedup_key,
+			is_alias = 0,
+			disabled = 0,
+			flagged = 0,
+			redirect_code = 0,
+			query_mode = '',
+			forward_path = 0,
+			tags = '',
+			max_clicks = 0,
+			password_hash = '',
+			created_at = excluded.created_at,
+			access_count = 0,
+			bot_count = 0,
+			activates_at = NULL,
+			expires_at = excluded.expires_at`,
+		url, shortCode, sql.NullString{String: url, Valid: expiresAt.IsZero()}, time.Now().UTC(), nullTime(expiresAt),
+	)
+	return err
+}
+
+// CreateURL atomically stores urlModel, deduplicating generated links by long URL and tags.
+func (s *SQLStorage) CreateURL(urlModel *models.URL) (string, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+
+	if deduplicated(urlModel) {
+		var existing string
+		err = tx.QueryRow(`SELECT short_code FROM URLMappings WHERE dedup_key = ?`, dedupKey(urlModel)).Scan(&existing)
+		if err == nil {
+			return existing, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", false, err
+		}
+	}
+
+	var taken int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM URLMappings WHERE short_code = ?`, urlModel.ShortCode).Scan(&taken); err != nil {
+		return "", false, err
+	}
+	if taken > 0 {
+		return "", false, ErrShortCodeExists
+	}
+
+	key := sql.NullString{String: dedupKey(urlModel), Valid: deduplicated(urlModel)}
+	if _, err := tx.Exec(
+		`INSERT INTO URLMappings (long_url, short_code, dedup_key, is_alias, disabled, flagged, redirect_code, query_mode, forward_path,
+			tags, max_clicks, password_hash, created_at, access_count, bot_count, activates_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		urlModel.LongURL, urlModel.ShortCode, key, urlModel.Alias, urlModel.Disabled, urlModel.Flagged,
+		urlModel.RedirectCode, urlModel.QueryMode, urlModel.ForwardPath, services.EncodeTags(urlModel.Tags), urlModel.MaxClicks,
+		urlModel.PasswordHash, urlModel.CreatedAt.UTC(), urlModel.AccessCount, urlModel.BotCount, nullTime(urlModel.ActivatesAt), nullTime(urlModel.ExpiresAt),
+	); err != nil {
+		return "", false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", false, err
+	}
+	return urlModel.ShortCode, true, nil
+}
+
+// GetURL retrieves a URL model by its short code.
+func (s *SQLStorage) GetURL(shortCode string) (*models.URL, bool) {
+	row := s.db.QueryRow(`SELECT `+urlColumns+` FROM URLMappings WHERE short_code = ?`, shortCode)
+	urlModel, err := scanURL(row)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[ERROR] Failed to load short code %s: %v", shortCode, err)
+		}
+		return nil, false
+	}
+	return urlModel, true
+}
+
+// GetShortCode retrieves the short code for a given long URL and tag set.
+func (s *SQLStorage) GetShortCode(url string, tags map[string]string) (string, bool) {
+	var shortCode string
+	err := s.db.QueryRow(`SELECT short_code FROM URLMappings WHERE dedup_key = ?`, services.DedupKey(url, tags)).Scan(&shortCode)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[ERROR] Failed to look up long URL %s: %v", url, err)
+		}
+		return "", false
+	}
+	return shortCode, true
+}
+
+// UpdateURL atomically applies update to the mapping for shortCode. The dedup key
+// follows the long URL and tags unless another link already owns it.
+func (s *SQLStorage) UpdateURL(shortCode string, update func(*models.URL) error) (*models.URL, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := scanURL(tx.QueryRow(`SELECT `+urlColumns+` FROM URLMappings WHERE short_code = ?`, shortCode))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	updated, err := applyUpdate(current, update)
+	if err != nil {
+		return nil, err
+	}
+
+	key := sql.NullString{String: dedupKey(updated), Valid: deduplicated(updated)}
+	if key.Valid {
+		var owner string
+		err := tx.QueryRow(`SELECT short_code FROM URLMappings WHERE dedup_key = ?`, key).Scan(&owner)
+		if err == nil && owner != shortCode {
+			key.Valid = false
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE URLMappings SET long_url = ?, dedup_key = ?, disabled = ?, flagged = ?, redirect_code = ?, query_mode = ?, forward_path = ?,
+			tags = ?, max_clicks = ?, password_hash = ?, activates_at = ?, expires_at = ? WHERE short_code = ?`,
+		updated.LongURL, key, updated.Disabled, updated.Flagged, updated.RedirectCode, updated.QueryMode, updated.ForwardPath,
+		services.EncodeTags(updated.Tags), updated.MaxClicks, updated.PasswordHash, nullTime(updated.ActivatesAt), nullTime(updated.ExpiresAt), shortCode,
+	); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteURL removes a URL mapping along with its access logs, click rollups and breakdowns.
+func (s *SQLStorage) DeleteURL(shortCode string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM AccessLogs WHERE short_code = ?`, shortCode); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM ClickCounts WHERE short_code = ?`, shortCode); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM ClickBreakdowns WHERE short_code = ?`, shortCode); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM URLMappings WHERE short_code = ?`, shortCode); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IncrementAccessCount increments the access count for a given short code.
+func (s *SQLStorage) IncrementAccessCount(shortCode string) error {
+	result, err := s.db.Exec(
+		`UPDATE URLMappings SET access_count = access_count + 1
+		WHERE short_code = ? AND (max_clicks = 0 OR access_count < max_clicks)`,
+		shortCode,
+	)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated > 0 {
+		return err
+	}
+	// Nothing was counted: the link is gone or has used up its clicks
+	var limited int
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM URLMappings WHERE short_code = ? AND max_clicks > 0`, shortCode).Scan(&limited)
+	if err != nil {
+		return err
+	}
+	if limited > 0 {
+		return ErrClickLimitReached
+	}
+	return nil
+}
+
+// IncrementBotCount increments the bot count for a given short code.
+func (s *SQLStorage) IncrementBotCount(shortCode string) error {
+	_, err := s.db.Exec(`UPDATE URLMappings SET bot_count = bot_count + 1 WHERE short_code = ?`, shortCode)
+	return err
+}
+
+// WriteClicks records click events in AccessLogs in a single transaction.
+// Events for links deleted since the click are skipped.
+func (s *SQLStorage) WriteClicks(events []models.ClickEvent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(
+		`INSERT INTO AccessLogs (short_code, accessed_at, referrer, user_agent, ip_address, accept_language, is_bot)
+		SELECT ?, ?, ?, ?, ?, ?, ? WHERE EXISTS (SELECT 1 FROM URLMappings WHERE short_code = ?)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, event := range events {
+		if _, err := stmt.Exec(
+			event.ShortCode, event.AccessedAt.UTC(), nullString(event.Referrer), nullString(event.UserAgent),
+			nullString(event.IPAddress), nullString(event.AcceptLanguage), event.Bot, event.ShortCode,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CountClicks adds the human clicks among events to the click rollups and
+// breakdowns. Events are summed per bucket and value first, so a batch costs one
+// upsert per link, granularity and bucket plus one per breakdown value, and the
+// visitor sketch of the batch is merged into the stored one. Events for links
+// deleted since the click are skipped.
+func (s *SQLStorage) CountClicks(events []models.ClickEvent) error {
+	type bucketKey struct {
+		shortCode string
+		clickCountKey
+	}
+	type breakdownKey struct {
+		shortCode string
+		dimension string
+		value     string
+	}
+	var (
+		order          []bucketKey
+		breakdownOrder []breakdownKey
+	)
+	buckets := make(map[bucketKey]*clickBucket)
+	breakdowns := make(map[breakdownKey]int64)
+	for _, event := range humanClicks(events) {
+		for _, key := range clickBucketKeys(event.AccessedAt) {
+			bk := bucketKey{event.ShortCode, key}
+			bucket, seen := buckets[bk]
+			if !seen {
+				bucket = &clickBucket{}
+				buckets[bk] = bucket
+				order = append(order, bk)
+			}
+			bucket.count++
+			if event.VisitorID != "" {
+				bucket.visitors.Add(event.VisitorID)
+			}
+		}
+		for i, value := range analytics.Classify(event) {
+			bk := breakdownKey{event.ShortCode, analytics.Dimensions[i], value}
+			if _, seen := breakdowns[bk]; !seen {
+				breakdownOrder = append(breakdownOrder, bk)
+			}
+			breakdowns[bk]++
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// The WHERE clause also keeps SQLite from parsing ON CONFLICT as a join constraint.
+	stmt, err := tx.Prepare(
+		`INSERT INTO ClickCounts (short_code, granularity, bucket_start, count)
+		SELECT ?, ?, ?, ? WHERE EXISTS (SELECT 1 FROM URLMappings WHERE short_code = ?)
+		ON CONFLICT(short_code, granularity, bucket_start) DO UPDATE SET count = count + excluded.count`,
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, bk := range order {
+		bucket := buckets[bk]
+		result, err := stmt.Exec(bk.shortCode, bk.granularity, bk.start, bucket.count, bk.shortCode)
+		if err != nil {
+			return err
+		}
+		if inserted, _ := result.RowsAffected(); inserted == 0 || bucket.visitors.Empty() {
+			continue
+		}
+		if err := mergeVisitors(tx, bk.shortCode, bk.clickCountKey, &bucket.visitors); err != nil {
+			return err
+		}
+	}
+
+	// New values are folded into "other" once a dimension holds maxBreakdownValues.
+	breakdownStmt, err := tx.Prepare(
+		`INSERT INTO ClickBreakdowns (short_code, dimension, value, count)
+		SELECT ?1, ?2, CASE
+			WHEN EXISTS (SELECT 1 FROM ClickBreakdowns WHERE short_code = ?1 AND dimension = ?2 AND value = ?3)
+				OR (SELECT COUNT(*) FROM ClickBreakdowns WHERE short_code = ?1 AND dimension = ?2) < ?5
+			THEN ?3 ELSE ?6 END, ?4
+		WHERE EXISTS (SELECT 1 FROM URLMappings WHERE short_code = ?1)
+		ON CONFLICT(short_code, dimension, value) DO UPDATE SET count = count + excluded.count`,
+	)
+	if err != nil {
+		return err
+	}
+	defer breakdownStmt.Close()
+	for _, bk := range breakdownOrder {
+		if _, err := breakdownStmt.Exec(
+			bk.shortCode, bk.dimension, bk.value, breakdowns[bk], maxBreakdownValues, analytics.ValueOther,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Breakdowns returns the limit most clicked values of every breakdown dimension of shortCode.
+func (s *SQLStorage) Breakdowns(shortCode string, limit int) (map[string][]models.BreakdownEntry, error) {
+	rows, err := s.db.Query(
+		`SELECT dimension, value, count FROM (
+			SELECT dimension, value, count,
+				ROW_NUMBER() OVER (PARTITION BY dimension ORDER BY count DESC, value) AS position
+			FROM ClickBreakdowns WHERE short_code = ?
+		) WHERE position <= ? ORDER BY dimension, position`,
+		shortCode, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := make(map[string][]models.BreakdownEntry, len(analytics.Dimensions))
+	for _, dimension := range analytics.Dimensions {
+		top[dimension] = []models.BreakdownEntry{}
+	}
+	for rows.Next() {
+		var (
+			dimension string
+			entry     models.BreakdownEntry
+		)
+		if err := rows.Scan(&dimension, &entry.Value, &entry.Count); err != nil {
+			return nil, err
+		}
+		if _, known := top[dimension]; known {
+			top[dimension] = append(top[dimension], entry)
+		}
+	}
+	return top, rows.Err()
+}
+
+// mergeVisitors merges visitors into the stored sketch of one rollup bucket.
+func mergeVisitors(tx *sql.Tx, shortCode string, key clickCountKey, visitors *analytics.Sketch) error {
+	var stored []byte
+	if err := tx.QueryRow(
+		`SELECT visitors FROM ClickCounts WHERE short_code = ? AND granularity = ? AND bucket_start = ?`,
+		shortCode, key.granularity, key.start,
+	).Scan(&stored); err != nil {
+		return err
+	}
+	merged := analytics.NewSketch()
+	if len(stored) > 0 {
+		if err := merged.UnmarshalBinary(stored); err != nil {
+			return err
+		}
+	}
+	merged.Merge(visitors)
+	data, err := merged.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`UPDATE ClickCounts SET visitors = ? WHERE short_code = ? AND granularity = ? AND bucket_start = ?`,
+		data, shortCode, key.granularity, key.start,
+	)
+	return err
+}
+
+// ClickSeries returns the click counts of shortCode per bucket of granularity over [from, to).
+func (s *SQLStorage) ClickSeries(shortCode string, granularity string, from time.Time, to time.Time) ([]models.ClickBucket, error) {
+	g, starts, err := seriesBuckets(granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(
+		`SELECT bucket_start, count, visitors FROM ClickCounts
+		WHERE short_code = ? AND granularity = ? AND bucket_start >= ? AND bucket_start <= ?`,
+		shortCode, g.name, starts[0].Unix(), starts[len(starts)-1].Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := make(map[int64]models.ClickBucket)
+	for rows.Next() {
+		var (
+			start    int64
+			bucket   models.ClickBucket
+			visitors []byte
+		)
+		if err := rows.Scan(&start, &bucket.Count, &visitors); err != nil {
+			return nil, err
+		}
+		if bucket.UniqueVisitors, err = estimateVisitors(visitors); err != nil {
+			return nil, err
+		}
+		stored[start] = bucket
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	series := make([]models.ClickBucket, len(starts))
+	for i, start := range starts {
+		series[i] = stored[start.Unix()]
+		series[i].Start = start
+	}
+	return series, nil
+}
+
+// UniqueVisitors estimates the distinct visitors of shortCode over its lifetime.
+func (s *SQLStorage) UniqueVisitors(shortCode string) (int64, error) {
+	var visitors []byte
+	err := s.db.QueryRow(
+		`SELECT visitors FROM ClickCounts WHERE short_code = ? AND granularity = ? AND bucket_start = 0`,
+		shortCode, granularityTotal,
+	).Scan(&visitors)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return estimateVisitors(visitors)
+}
+
+// CleanupExpiredURLs removes expired URLs along with their access logs. Due links
+// are found through the expiry index and deleted in small transactions so the
+// write lock is never held for a full sweep. Click rollups past their retention
+// are removed at most once per clickPruneInterval.
+func (s *SQLStorage) CleanupExpiredURLs() error {
+	now := time.Now().UTC()
+	for {
+		removed, err := s.removeExpiredBatch(now)
+		if err != nil {
+			return err
+		}
+		expiredLinks.Add(removed)
+		if removed < expiryBatchSize {
+			break
+		}
+	}
+	return s.pruneClickCounts(now)
+}
+
+// pruneClickCounts deletes click rollups that ended more than their retention before now.
+func (s *SQLStorage) pruneClickCounts(now time.Time) error {
+	s.pruneMu.Lock()
+	defer s.pruneMu.Unlock()
+	if now.Sub(s.clicksPrunedAt) < clickPruneInterval {
+		return nil
+	}
+	for _, g := range clickGranularities {
+		cutoff := now.Add(-g.retention - g.size).Unix()
+		if _, err := s.db.Exec(
+			`DELETE FROM ClickCounts WHERE granularity = ? AND bucket_start < ?`, g.name, cutoff,
+		); err != nil {
+			return err
+		}
+	}
+	s.clicksPrunedAt = now
+	return nil
+}
+
+// removeExpiredBatch deletes up to expiryBatchSize links that expired before now.
+func (s *SQLStorage) removeExpiredBatch(now time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT short_code FROM URLMappings WHERE julianday(expires_at) < julianday(?) LIMIT ?`,
+		now, expiryBatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var due []any
+	for rows.Next() {
+		var shortCode string
+		if err := rows.Scan(&shortCode); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, shortCode)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(due)), ", ")
+	if _, err := tx.Exec(`DELETE FROM AccessLogs WHERE short_code IN (`+placeholders+`)`, due...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM ClickCounts WHERE short_code IN (`+placeholders+`)`, due...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM ClickBreakdowns WHERE short_code IN (`+placeholders+`)`, due...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM URLMappings WHERE short_code IN (`+placeholders+`)`, due...); err != nil {
+		return 0, err
+	}
+	return int64(len(due)), tx.Commit()
+}
+
+// ListURLs returns every URL mapping in the database.
+func (s *SQLStorage) ListURLs() ([]*models.URL, error) {
+	rows, err := s.db.Query(`SELECT ` + urlColumns + ` FROM URLMappings ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []*models.URL
+	for rows.Next() {
+		urlModel, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, urlModel)
+	}
+	return urls, rows.Err()
+}
+
+// QueryURLs filters, orders and pages links in the database, continuing after
+// the cursor with a keyset condition instead of an OFFSET.
+func (s *SQLStorage) QueryURLs(query ListQuery) (*ListPage, error) {
+	query, cursor, err := query.normalize()
+	if err != nil {
+		return nil, err
+	}
+	sortKey := sqlSortKeys[query.SortBy]
+
+	var (
+		conditions []string
+		args       []any
+	)
+	if query.Host != "" {
+		conditions = append(conditions, "instr(url_host(long_url), ?) > 0")
+		args = append(args, query.Host)
+	}
+	switch query.Status {
+	case StatusActive:
+		conditions = append(conditions, "(expires_at IS NULL OR julianday(expires_at) >= julianday(?))")
+		args = append(args, time.Now().UTC())
+	case StatusExpired:
+		conditions = append(conditions, "julianday(expires_at) < julianday(?)")
+		args = append(args, time.Now().UTC())
+	}
+	if !query.CreatedFrom.IsZero() {
+		conditions = append(conditions, "julianday(created_at) >= julianday(?)")
+		args = append(args, query.CreatedFrom.UTC())
+	}
+	if !query.CreatedTo.IsZero() {
+		conditions = append(conditions, "julianday(created_at) < julianday(?)")
+		args = append(args, query.CreatedTo.UTC())
+	}
+	order, comparison := "ASC", ">"
+	if query.Descending {
+		order, comparison = "DESC", "<"
+	}
+	if cursor != nil {
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND short_code %[2]s ?))", sortKey, comparison))
+		args = append(args, cursor.Key, cursor.Key, cursor.ShortCode)
+	}
+
+	statement := `SELECT ` + urlColumns + `, ` + sortKey + ` FROM URLMappings`
+	if len(conditions) > 0 {
+		statement += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to learn whether another page follows.
+	statement += fmt.Sprintf(` ORDER BY %s %s, short_code %s LIMIT ?`, sortKey, order, order)
+	args = append(args, query.Limit+1)
+
+	rows, err := s.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &ListPage{}
+	var lastKey int64
+	for rows.Next() {
+		var key int64
+		urlModel, err := scanURL(keyedRow{rowScanner: rows, key: &key})
+		if err != nil {
+			return nil, err
+		}
+		if len(page.URLs) == query.Limit {
+			last := page.URLs[len(page.URLs)-1]
+			page.NextCursor = listCursor{
+				SortBy:     query.SortBy,
+				Descending: query.Descending,
+				Key:        lastKey,
+				ShortCode:  last.ShortCode,
+			}.encode()
+			break
+		}
+		page.URLs = append(page.URLs, urlModel)
+		lastKey = key
+	}
+	return page, rows.Err()
+}
+
+// AccessLogCount returns the number of access log entries recorded for a short code.
+func (s *SQLStorage) AccessLogCount(shortCode string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM AccessLogs WHERE short_code = ?`, shortCode).Scan(&count)
+	return count, err
+}
+
+// Close closes the underlying database.
+func (s *SQLStorage) Close() error {
+	return s.db.Close()
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// keyedRow scans one extra trailing column, the sort key, into key.
+type keyedRow struct {
+	rowScanner
+	key *int64
+}
+
+func (r keyedRow) Scan(dest ...any) error {
+	return r.rowScanner.Scan(append(dest, r.key)...)
+}
+
+// scanURL reads the urlColumns of a single row into a URL model.
+func scanURL(row rowScanner) (*models.URL, error) {
+	var (
+		urlModel    models.URL
+		tags        string
+		activatesAt sql.NullTime
+		expiresAt   sql.NullTime
+	)
+	if err := row.Scan(
+		&urlModel.ShortCode,
+		&urlModel.LongURL,
+		&urlModel.Alias,
+		&urlModel.Disabled,
+		&urlModel.Flagged,
+		&urlModel.RedirectCode,
+		&urlModel.QueryMode,
+		&urlModel.ForwardPath,
+		&tags,
+		&urlModel.MaxClicks,
+		&urlModel.PasswordHash,
+		&urlModel.CreatedAt,
+		&urlModel.AccessCount,
+		&urlModel.BotCount,
+		&activatesAt,
+		&expiresAt,
+	); err != nil {
+		return nil, err
+	}
+	if activatesAt.Valid {
+		urlModel.ActivatesAt = activatesAt.Time
+	}
+	if expiresAt.Valid {
+		urlModel.ExpiresAt = expiresAt.Time
+	}
+	decoded, err := services.DecodeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	urlModel.Tags = decoded
+	return &urlModel, nil
+}
+
+// estimateVisitors decodes a stored visitor sketch and returns its estimate. A
+// NULL sketch means no visitor IDs were recorded.
+func estimateVisitors(data []byte) (int64, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var sketch analytics.Sketch
+	if err := sketch.UnmarshalBinary(data); err != nil {
+		return 0, err
+	}
+	return sketch.Estimate(), nil
+}
+
+// nullString maps the empty string to SQL NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullTime maps the zero time to SQL NULL and normalizes other times to UTC.
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSQLStorage opens a SQLite store in a temporary directory.
+func newTestSQLStorage(t *testing.T) *SQLStorage {
+	t.Helper()
+	store, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "shorty.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLStorage_AddAndGet(t *testing.T) {
+	store := newTestSQLStorage(t)
+
+	// Test case: Add a URL without expiration
+	assert.NoError(t, store.AddURL("https://www.example.com", "exmpl1", time.Time{}))
+	urlModel, exists := store.GetURL("exmpl1")
+	assert.True(t, exists, "Short code should exist in the database")
+	assert.Equal(t, "https://www.example.com", urlModel.LongURL)
+	assert.Equal(t, 0, urlModel.AccessCount)
+	assert.True(t, urlModel.ExpiresAt.IsZero(), "ExpiresAt should be zero for no expiration")
+	assert.WithinDuration(t, time.Now(), urlModel.CreatedAt, time.Minute)
+
+	// Test case: Add a URL with expiration
+	expiration := time.Now().Add(24 * time.Hour)
+	assert.NoError(t, store.AddURL("https://www.google.com", "googl1", expiration))
+	urlModel, exists = store.GetURL("googl1")
+	assert.True(t, exists)
+	assert.WithinDuration(t, expiration, urlModel.ExpiresAt, time.Millisecond)
+
+	// Test case: Reverse lookup by long URL; expiring links are not indexed
+	shortCode, exists := store.GetShortCode("https://www.example.com", nil)
+	assert.True(t, exists)
+	assert.Equal(t, "exmpl1", shortCode)
+	_, exists = store.GetShortCode("https://www.google.com", nil)
+	assert.False(t, exists)
+
+	// Test case: Missing entries
+	_, exists = store.GetURL("nonexist")
+	assert.False(t, exists)
+	_, exists = store.GetShortCode("https://www.nonexistent.com", nil)
+	assert.False(t, exists)
+}
+
+func TestSQLStorage_IncrementAndDelete(t *testing.T) {
+	store := newTestSQLStorage(t)
+	assert.NoError(t, store.AddURL("https://www.twitter.com", "twit1", time.Time{}))
+
+	// Each increment bumps the counter; click events fill the access log
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, store.IncrementAccessCount("twit1"))
+	}
+	urlModel, exists := store.GetURL("twit1")
+	assert.True(t, exists)
+	assert.Equal(t, 3, urlModel.AccessCount)
+	assert.NoError(t, store.WriteClicks([]models.ClickEvent{
+		{ShortCode: "twit1", AccessedAt: time.Now()},
+		{ShortCode: "twit1", AccessedAt: time.Now()},
+	}))
+	logs, err := store.AccessLogCount("twit1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, logs, "Every click event should be logged")
+
+	// Incrementing a missing code is a no-op
+	assert.NoError(t, store.IncrementAccessCount("nonexist"))
+
+	// Deleting removes the mapping and its access logs
+	assert.NoError(t, store.DeleteURL("twit1"))
+	_, exists = store.GetURL("twit1")
+	assert.False(t, exists)
+	_, exists = store.GetShortCode("https://www.twitter.com", nil)
+	assert.False(t, exists)
+	logs, err = store.AccessLogCount("twit1")
+	assert.NoError(t, err)
+	assert.Zero(t, logs)
+}
+
+func TestSQLStorage_CleanupAndList(t *testing.T) {
+	store := newTestSQLStorage(t)
+	assert.NoError(t, store.AddURL("https://www.unexpired.com", "unexp1", time.Now().Add(2*time.Hour)))
+	assert.NoError(t, store.AddURL("https://www.expired.com", "expd1", time.Now().Add(-time.Hour)))
+	assert.NoError(t, store.AddURL("https://www.noexpiry.com", "noexp1", time.Time{}))
+	assert.NoError(t, store.IncrementAccessCount("expd1"))
+
+	assert.NoError(t, store.CleanupExpiredURLs())
+
+	urls, err := store.ListURLs()
+	assert.NoError(t, err)
+	var codes []string
+	for _, urlModel := range urls {
+		codes = append(codes, urlModel.ShortCode)
+	}
+	assert.ElementsMatch(t, []string{"unexp1", "noexp1"}, codes, "Only unexpired URLs should remain")
+}
+
+func TestSQLStorage_Migrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shorty.db")
+
+	store, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+	assert.NoError(t, store.AddURL("https://www.persisted.com", "pers1", time.Time{}))
+	var version int
+	require.NoError(t, store.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+	assert.Equal(t, len(sqlMigrations), version, "All migrations should be recorded")
+	require.NoError(t, store.Close())
+
+	// Reopening an up-to-date database must not reapply migrations or lose data
+	reopened, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	_, exists := reopened.GetURL("pers1")
+	assert.True(t, exists, "Data should survive reopening the database")
+}
+
+func TestSQLStorage_CreateURL(t *testing.T) {
+	store := newTestSQLStorage(t)
+
+	shortCode, created, err := store.CreateURL(newURL("https://www.create.com", "crt1", time.Time{}))
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "crt1", shortCode)
+
+	// Test case: Same long URL returns the existing short code
+	shortCode, created, err = store.CreateURL(newURL("https://www.create.com", "crt2", time.Time{}))
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "crt1", shortCode)
+
+	// Test case: Short code taken by a different long URL
+	_, _, err = store.CreateURL(newURL("https://www.other.com", "crt1", time.Time{}))
+	assert.ErrorIs(t, err, ErrShortCodeExists)
+}
+
+func TestSQLStorage_UpgradeFromReadmeSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shorty.db")
+
+	// Build a database at the original README schema with some data in it
+	db, err := sql.Open(sqliteDriver, sqliteDSN(path))
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	require.NoError(t, applyMigrations(db, sqlMigrations[:2]))
+	_, err = db.Exec(`INSERT INTO URLMappings (long_url, short_code, access_count) VALUES ('https://www.old.com', 'old1', 2)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO AccessLogs (short_code) VALUES ('old1'), ('old1')`)
+	require.NoError(t, err)
+
+	// Opening the store migrates it to the latest schema in place
+	store, err := NewSQLStorage(db)
+	require.NoError(t, err)
+	defer store.Close()
+
+	urlModel, exists := store.GetURL("old1")
+	assert.True(t, exists, "Existing links should survive the upgrade")
+	assert.Equal(t, 2, urlModel.AccessCount)
+	shortCode, exists := store.GetShortCode("https://www.old.com", nil)
+	assert.True(t, exists, "Existing links should stay deduplicated")
+	assert.Equal(t, "old1", shortCode)
+	logs, err := store.AccessLogCount("old1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, logs, "Access logs should survive the upgrade")
+
+	// Foreign keys must still point at the rebuilt URLMappings table
+	assert.NoError(t, store.IncrementAccessCount("old1"))
+	assert.NoError(t, store.DeleteURL("old1"))
+	var violations int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM pragma_foreign_key_check`).Scan(&violations))
+	assert.Zero(t, violations)
+}
+
+func TestSQLStorage_WriteClicks(t *testing.T) {
+	store := newTestSQLStorage(t)
+	assert.NoError(t, store.AddURL("https://www.clicks.com", "clk1", time.Time{}))
+
+	accessedAt := time.Now().Add(-time.Minute)
+	assert.NoError(t, store.WriteClicks([]models.ClickEvent{
+		{
+			ShortCode:      "clk1",
+			AccessedAt:     accessedAt,
+			Referrer:       "https://news.example.com/",
+			UserAgent:      "curl/8.0",
+			IPAddress:      "203.0.113.7",
+			AcceptLanguage: "en-GB,en;q=0.9",
+		},
+		// Clicks on links deleted in the meantime are skipped instead of failing the batch
+		{ShortCode: "gone1", AccessedAt: accessedAt},
+	}))
+
+	var (
+		logged                                         time.Time
+		referrer, userAgent, ipAddress, acceptLanguage string
+	)
+	err := store.db.QueryRow(
+		`SELECT accessed_at, referrer, user_agent, ip_address, accept_language FROM AccessLogs WHERE short_code = 'clk1'`,
+	).Scan(&logged, &referrer, &userAgent, &ipAddress, &acceptLanguage)
+	require.NoError(t, err)
+	assert.WithinDuration(t, accessedAt, logged, time.Millisecond)
+	assert.Equal(t, "https://news.example.com/", referrer)
+	assert.Equal(t, "curl/8.0", userAgent)
+	assert.Equal(t, "203.0.113.7", ipAddress)
+	assert.Equal(t, "en-GB,en;q=0.9", acceptLanguage)
+
+	logs, err := store.AccessLogCount("gone1")
+	assert.NoError(t, err)
+	assert.Zero(t, logs)
+}
@@ -5,83 +5,256 @@ import (
 	"time"
 
 	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
 )
 
 // Storage defines the in-memory storage structure.
 type Storage struct {
-	Mu         sync.RWMutex
-	URLMap     map[string]*models.URL
-	LongURLMap map[string]string
+	mu         sync.RWMutex
+	urlMap     map[string]*models.URL
+	longURLMap map[string]string
+	expiry     expiryIndex
+	clicks     *clickCounts
 }
 
 // NewStorage initializes and returns a new Storage instance.
 func NewStorage() *Storage {
 	return &Storage{
-		URLMap:     make(map[string]*models.URL),
-		LongURLMap: make(map[string]string),
+		urlMap:     make(map[string]*models.URL),
+		longURLMap: make(map[string]string),
+		clicks:     newClickCounts(),
 	}
 }
 
 // AddURL adds a new URL mapping to the storage.
-func (s *Storage) AddURL(url string, shortCode string, expiresAt time.Time) {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-	s.URLMap[shortCode] = &models.URL{
-		BaseURL: models.BaseURL{
-			LongURL:     url,
-			AccessCount: 0,
-			CreatedAt:   time.Now(),
-			ExpiresAt:   expiresAt,
-		},
-		ShortCode: shortCode,
-	}
-	s.LongURLMap[url] = shortCode
-}
-
-// GetURL retrieves a URL model by its short code.
+func (s *Storage) AddURL(url string, shortCode string, expiresAt time.Time) error {
+	s.putURL(newURL(url, shortCode, expiresAt))
+	return nil
+}
+
+// CreateURL atomically stores a copy of urlModel, deduplicating generated links by long URL and tags.
+func (s *Storage) CreateURL(urlModel *models.URL) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if deduplicated(urlModel) {
+		if existing, exists := s.longURLMap[dedupKey(urlModel)]; exists {
+			return existing, false, nil
+		}
+	}
+	if _, exists := s.urlMap[urlModel.ShortCode]; exists {
+		return "", false, ErrShortCodeExists
+	}
+	copied := *urlModel
+	s.putLocked(&copied)
+	return urlModel.ShortCode, true, nil
+}
+
+// putURL stores a fully populated URL model, replacing any existing mapping for its short code.
+func (s *Storage) putURL(urlModel *models.URL) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putLocked(urlModel)
+}
+
+// putLocked stores urlModel and indexes it. Aliases and disabled links are kept
+// out of the long URL index so they are never returned for duplicate submissions.
+// Callers must hold s.mu.
+func (s *Storage) putLocked(urlModel *models.URL) {
+	s.urlMap[urlModel.ShortCode] = urlModel
+	if deduplicated(urlModel) {
+		s.longURLMap[dedupKey(urlModel)] = urlModel.ShortCode
+	}
+	s.expiry.schedule(urlModel.ShortCode, urlModel.ExpiresAt)
+}
+
+// GetURL retrieves a copy of the URL model by its short code.
 func (s *Storage) GetURL(shortCode string) (*models.URL, bool) {
-	s.Mu.RLock()
-	defer s.Mu.RUnlock()
-	urlModel, exists := s.URLMap[shortCode]
-	return urlModel, exists
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	urlModel, exists := s.urlMap[shortCode]
+	if !exists {
+		return nil, false
+	}
+	copied := *urlModel
+	return &copied, true
 }
 
-// GetShortCode retrieves the short code for a given long URL.
-func (s *Storage) GetShortCode(url string) (string, bool) {
-	s.Mu.RLock()
-	defer s.Mu.RUnlock()
-	shortCode, exists := s.LongURLMap[url]
+// GetShortCode retrieves the short code for a given long URL and tag set.
+func (s *Storage) GetShortCode(url string, tags map[string]string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	shortCode, exists := s.longURLMap[services.DedupKey(url, tags)]
 	return shortCode, exists
 }
 
+// UpdateURL atomically applies update to the mapping for shortCode.
+func (s *Storage) UpdateURL(shortCode string, update func(*models.URL) error) (*models.URL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.urlMap[shortCode]
+	if !exists {
+		return nil, ErrURLNotFound
+	}
+	updated, err := applyUpdate(current, update)
+	if err != nil {
+		return nil, err
+	}
+	s.replaceLocked(current, updated)
+	copied := *updated
+	return &copied, nil
+}
+
+// replaceLocked swaps current for updated, moving its long URL index entry if the
+// destination changed. The index keeps pointing at an existing link for the new
+// destination, if there is one. Callers must hold s.mu.
+func (s *Storage) replaceLocked(current *models.URL, updated *models.URL) {
+	oldKey, newKey := dedupKey(current), dedupKey(updated)
+	if s.longURLMap[oldKey] == current.ShortCode && (!deduplicated(updated) || newKey != oldKey) {
+		delete(s.longURLMap, oldKey)
+	}
+	s.urlMap[updated.ShortCode] = updated
+	if deduplicated(updated) {
+		if _, taken := s.longURLMap[newKey]; !taken {
+			s.longURLMap[newKey] = updated.ShortCode
+		}
+	}
+	if !updated.ExpiresAt.Equal(current.ExpiresAt) {
+		s.expiry.schedule(updated.ShortCode, updated.ExpiresAt)
+	}
+}
+
 // DeleteURL removes a URL mapping from the storage.
-func (s *Storage) DeleteURL(shortCode string) {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-	if urlModel, exists := s.URLMap[shortCode]; exists {
-		delete(s.URLMap, shortCode)
-		delete(s.LongURLMap, urlModel.LongURL)
+func (s *Storage) DeleteURL(shortCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if urlModel, exists := s.urlMap[shortCode]; exists {
+		s.removeLocked(urlModel)
 	}
+	return nil
 }
 
 // IncrementAccessCount increments the access count for a given short code.
-func (s *Storage) IncrementAccessCount(shortCode string) {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-	if urlModel, exists := s.URLMap[shortCode]; exists {
+func (s *Storage) IncrementAccessCount(shortCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if urlModel, exists := s.urlMap[shortCode]; exists {
+		if !clicksLeft(urlModel, urlModel.AccessCount) {
+			return ErrClickLimitReached
+		}
 		urlModel.AccessCount++
 	}
+	return nil
+}
+
+// IncrementBotCount increments the bot count for a given short code.
+func (s *Storage) IncrementBotCount(shortCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if urlModel, exists := s.urlMap[shortCode]; exists {
+		urlModel.BotCount++
+	}
+	return nil
 }
 
-// CleanupExpiredURLs removes expired URLs from the storage.
-func (s *Storage) CleanupExpiredURLs() {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
+// CountClicks adds the human clicks among events to the click rollups of links that still exist.
+func (s *Storage) CountClicks(events []models.ClickEvent) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, event := range humanClicks(events) {
+		if _, exists := s.urlMap[event.ShortCode]; exists {
+			s.clicks.add(event)
+		}
+	}
+	return nil
+}
+
+// ClickSeries returns the click counts of shortCode per bucket of granularity over [from, to).
+func (s *Storage) ClickSeries(shortCode string, granularity string, from time.Time, to time.Time) ([]models.ClickBucket, error) {
+	g, starts, err := seriesBuckets(granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return s.clicks.series(shortCode, g, starts), nil
+}
+
+// UniqueVisitors estimates the distinct visitors of shortCode over its lifetime.
+func (s *Storage) UniqueVisitors(shortCode string) (int64, error) {
+	return s.clicks.uniqueVisitors(shortCode), nil
+}
+
+// Breakdowns returns the limit most clicked values of every breakdown dimension of shortCode.
+func (s *Storage) Breakdowns(shortCode string, limit int) (map[string][]models.BreakdownEntry, error) {
+	return s.clicks.topBreakdowns(shortCode, limit), nil
+}
+
+// CleanupExpiredURLs removes expired URLs and click rollups past their retention from the storage.
+func (s *Storage) CleanupExpiredURLs() error {
 	now := time.Now()
-	for shortCode, urlModel := range s.URLMap {
-		if !urlModel.ExpiresAt.IsZero() && now.After(urlModel.ExpiresAt) {
-			delete(s.URLMap, shortCode)
-			delete(s.LongURLMap, urlModel.LongURL)
+	s.removeExpired(now)
+	s.clicks.prune(now)
+	return nil
+}
+
+// removeExpired deletes every URL that expired before now and returns their short codes.
+// Due links are taken from the expiry index in small batches, releasing the lock
+// between batches instead of scanning the whole map.
+func (s *Storage) removeExpired(now time.Time) []string {
+	var removed []string
+	for {
+		batch, more := s.removeExpiredBatch(now)
+		removed = append(removed, batch...)
+		if !more {
+			return removed
 		}
 	}
 }
+
+// removeExpiredBatch removes up to expiryBatchSize due links and reports whether more may be due.
+func (s *Storage) removeExpiredBatch(now time.Time) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := s.expiry.popDue(now, expiryBatchSize)
+	var removed []string
+	for _, item := range due {
+		urlModel, exists := s.urlMap[item.shortCode]
+		// Skip stale index entries left behind by deletes or expiry changes
+		if !exists || !urlModel.ExpiresAt.Equal(item.expiresAt) {
+			continue
+		}
+		s.removeLocked(urlModel)
+		removed = append(removed, item.shortCode)
+	}
+	expiredLinks.Add(int64(len(removed)))
+	return removed, len(due) == expiryBatchSize
+}
+
+// removeLocked deletes urlModel from both maps along with its click rollups.
+// Callers must hold s.mu.
+func (s *Storage) removeLocked(urlModel *models.URL) {
+	delete(s.urlMap, urlModel.ShortCode)
+	s.clicks.remove(urlModel.ShortCode)
+	if key := dedupKey(urlModel); s.longURLMap[key] == urlModel.ShortCode {
+		delete(s.longURLMap, key)
+	}
+}
+
+// ListURLs returns copies of every URL model in the storage.
+func (s *Storage) ListURLs() ([]*models.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	urls := make([]*models.URL, 0, len(s.urlMap))
+	for _, urlModel := range s.urlMap {
+		copied := *urlModel
+		urls = append(urls, &copied)
+	}
+	return urls, nil
+}
+
+// QueryURLs filters, orders and pages a snapshot of every URL mapping.
+func (s *Storage) QueryURLs(query ListQuery) (*ListPage, error) {
+	urls, err := s.ListURLs()
+	if err != nil {
+		return nil, err
+	}
+	return queryURLs(urls, query)
+}
@@ -23,7 +23,7 @@ func TestAddURL(t *testing.T) {
 	assert.True(t, urlModel.ExpiresAt.IsZero(), "ExpiresAt should be zero for no expiration")
 
 	// Verify that LongURLMap has the url1
-	retrievedShortCode, exists := store.GetShortCode(url1)
+	retrievedShortCode, exists := store.GetShortCode(url1, nil)
 	assert.True(t, exists, "Long URL should exist in LongURLMap")
 	assert.Equal(t, shortCode1, retrievedShortCode, "Retrieved short code should match the input short code")
 
@@ -41,10 +41,9 @@ func TestAddURL(t *testing.T) {
 	assert.False(t, urlModel2.ExpiresAt.IsZero(), "ExpiresAt should be set for URL2")
 	assert.WithinDuration(t, expiration, urlModel2.ExpiresAt, time.Second, "ExpiresAt should be correctly set for URL2")
 
-	// Verify that LongURLMap has the url2
-	retrievedShortCode2, exists := store.GetShortCode(url2)
-	assert.True(t, exists, "Long URL2 should exist in LongURLMap")
-	assert.Equal(t, shortCode2, retrievedShortCode2, "Retrieved short code2 should match the input short code2")
+	// Verify that LongURLMap does not hand out the expiring url2 for duplicate submissions
+	_, exists = store.GetShortCode(url2, nil)
+	assert.False(t, exists, "Expiring long URL2 should not exist in LongURLMap")
 }
 
 func TestGetURL(t *testing.T) {
@@ -80,16 +79,16 @@ func TestGetShortCode(t *testing.T) {
 	store.AddURL(url2, shortCode2, time.Time{})
 
 	// Test case: Retrieve existing short codes by long URLs
-	retrievedShortCode1, exists := store.GetShortCode(url1)
+	retrievedShortCode1, exists := store.GetShortCode(url1, nil)
 	assert.True(t, exists, "Long URL1 should exist in storage")
 	assert.Equal(t, shortCode1, retrievedShortCode1, "Retrieved short code1 should match")
 
-	retrievedShortCode2, exists := store.GetShortCode(url2)
+	retrievedShortCode2, exists := store.GetShortCode(url2, nil)
 	assert.True(t, exists, "Long URL2 should exist in storage")
 	assert.Equal(t, shortCode2, retrievedShortCode2, "Retrieved short code2 should match")
 
 	// Test case: Retrieve non-existent short code by long URL
-	_, exists = store.GetShortCode("https://www.nonexistent.com")
+	_, exists = store.GetShortCode("https://www.nonexistent.com", nil)
 	assert.False(t, exists, "Non-existent long URL should not exist in storage")
 }
 
@@ -113,7 +112,7 @@ func TestDeleteURL(t *testing.T) {
 	assert.False(t, exists, "Short code1 should be deleted from URLMap")
 
 	// Verify that LongURLMap no longer has url1
-	_, exists = store.GetShortCode(url1)
+	_, exists = store.GetShortCode(url1, nil)
 	assert.False(t, exists, "Long URL1 should be deleted from LongURLMap")
 
 	// Test case: Delete non-existent URL
@@ -224,7 +223,7 @@ func TestStorageConcurrency(t *testing.T) {
 		assert.True(t, exists, "Short code %s should exist in storage", shortCodes[i])
 		assert.Equal(t, urls[i], urlModel.LongURL, "Long URL should match for short code %s", shortCodes[i])
 
-		retrievedShortCode, exists := store.GetShortCode(urls[i])
+		retrievedShortCode, exists := store.GetShortCode(urls[i], nil)
 		assert.True(t, exists, "Long URL %s should exist in LongURLMap", urls[i])
 		assert.Equal(t, shortCodes[i], retrievedShortCode, "Retrieved short code should match for URL %s", urls[i])
 	}
@@ -249,3 +248,48 @@ func TestStorageConcurrency(t *testing.T) {
 		assert.Equal(t, 1, urlModel.AccessCount, "Access count should be 1 for short code %s", shortCodes[i])
 	}
 }
+
+func TestListURLs(t *testing.T) {
+	store := NewStorage()
+
+	// Test case: Empty storage returns no URLs
+	urls, err := store.ListURLs()
+	assert.NoError(t, err)
+	assert.Empty(t, urls, "Empty storage should list no URLs")
+
+	// Add URLs to storage
+	store.AddURL("https://www.list1.com", "list1", time.Time{})
+	store.AddURL("https://www.list2.com", "list2", time.Time{})
+
+	urls, err = store.ListURLs()
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2, "All stored URLs should be listed")
+
+	// Mutating a listed copy must not affect the stored model
+	urls[0].AccessCount = 99
+	urlModel, exists := store.GetURL(urls[0].ShortCode)
+	assert.True(t, exists, "Listed short code should exist in storage")
+	assert.Equal(t, 0, urlModel.AccessCount, "Listed URLs should be copies")
+}
+
+func TestCreateURL(t *testing.T) {
+	store := NewStorage()
+
+	// Test case: New long URL and free short code
+	shortCode, created, err := store.CreateURL(newURL("https://www.create.com", "crt1", time.Time{}))
+	assert.NoError(t, err)
+	assert.True(t, created, "Mapping should be created")
+	assert.Equal(t, "crt1", shortCode)
+
+	// Test case: Same long URL returns the existing short code
+	shortCode, created, err = store.CreateURL(newURL("https://www.create.com", "crt2", time.Time{}))
+	assert.NoError(t, err)
+	assert.False(t, created, "Duplicate long URL should not create a mapping")
+	assert.Equal(t, "crt1", shortCode, "Existing short code should be returned")
+	_, exists := store.GetURL("crt2")
+	assert.False(t, exists, "Candidate short code should not be stored")
+
+	// Test case: Short code taken by a different long URL
+	_, _, err = store.CreateURL(newURL("https://www.other.com", "crt1", time.Time{}))
+	assert.ErrorIs(t, err, ErrShortCodeExists)
+}
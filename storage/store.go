@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/Codedude1/shorty/services"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store defines the operations every storage backend must support.
+// Handlers depend on this interface so backends can be swapped without touching them.
+type Store interface {
+	// AddURL adds a new URL mapping to the store.
+	AddURL(url string, shortCode string, expiresAt time.Time) error
+	// CreateURL atomically stores urlModel, deduplicating it by long URL and tags.
+	// If the long URL is already shortened with the same tags, the existing short
+	// code is returned and nothing is stored. Aliases, disabled links and links
+	// with options of their own, such as a click limit, schedule, expiry,
+	// password, redirect status or passthrough, are never deduplicated. The
+	// second result reports whether urlModel was stored. ErrShortCodeExists is
+	// returned if urlModel.ShortCode is already taken.
+	CreateURL(urlModel *models.URL) (string, bool, error)
+	// GetURL retrieves a URL model by its short code.
+	GetURL(shortCode string) (*models.URL, bool)
+	// GetShortCode retrieves the short code for a given long URL and tag set.
+	// Links for the same URL with other tags, or none, are not returned.
+	GetShortCode(url string, tags map[string]string) (string, bool)
+	// UpdateURL atomically applies update to the mapping for shortCode and returns
+	// the stored result. update may be called more than once if the mapping
+	// changes concurrently. Changes to ShortCode, AccessCount and BotCount are
+	// ignored. The long URL index follows changes to the long URL and tags.
+	// ErrURLNotFound is returned if shortCode does not exist. Any error returned
+	// by update aborts the change.
+	UpdateURL(shortCode string, update func(*models.URL) error) (*models.URL, error)
+	// DeleteURL removes a URL mapping from the store.
+	DeleteURL(shortCode string) error
+	// IncrementAccessCount increments the access count for a given short code.
+	// Once the access count has reached the link's MaxClicks, nothing is counted
+	// and ErrClickLimitReached is returned. The check and increment are atomic.
+	IncrementAccessCount(shortCode string) error
+	// IncrementBotCount increments the count of bot redirects for a given short code.
+	IncrementBotCount(shortCode string) error
+	// CleanupExpiredURLs removes expired URLs from the store.
+	CleanupExpiredURLs() error
+	// ListURLs returns a snapshot of every URL mapping in the store.
+	ListURLs() ([]*models.URL, error)
+	// QueryURLs returns one page of the links matching query, in the requested order.
+	// ErrInvalidQuery and ErrInvalidCursor are returned for malformed queries.
+	QueryURLs(query ListQuery) (*ListPage, error)
+	// CountClicks adds events to the per-minute, per-hour and per-day click rollups
+	// of their links, including HyperLogLog sketches of their visitor IDs, and to
+	// their referrer, browser, OS, device and country breakdowns. Events for links
+	// that no longer exist and events of bots are ignored.
+	CountClicks(events []models.ClickEvent) error
+	// ClickSeries returns the click counts of shortCode for every bucket of
+	// granularity overlapping [from, to), oldest first and zero-filled.
+	// ErrInvalidSeries is returned for unknown granularities and bad ranges.
+	ClickSeries(shortCode string, granularity string, from time.Time, to time.Time) ([]models.ClickBucket, error)
+	// UniqueVisitors estimates how many distinct visitors clicked shortCode over
+	// its lifetime, from the visitor IDs of counted click events.
+	UniqueVisitors(shortCode string) (int64, error)
+	// Breakdowns returns, for each of analytics.Dimensions, the limit values of
+	// shortCode with the most clicks, most clicked first.
+	Breakdowns(shortCode string, limit int) (map[string][]models.BreakdownEntry, error)
+}
+
+// ErrShortCodeExists is returned by CreateURL when the requested short code is already in use.
+var ErrShortCodeExists = errors.New("short code already exists")
+
+// ErrURLNotFound is returned by UpdateURL when the short code does not exist.
+var ErrURLNotFound = errors.New("short URL not found")
+
+// ErrClickLimitReached is returned by IncrementAccessCount when a link has used up its clicks.
+var ErrClickLimitReached = errors.New("click limit reached")
+
+// Supported storage types for Config.Type.
+const (
+	TypeMemory  = "memory"
+	TypeSharded = "sharded"
+	TypeFile    = "file"
+	TypeSQLite  = "sqlite"
+	TypeRedis   = "redis"
+)
+
+// Config holds the settings used to construct a Store.
+type Config struct {
+	Type string
+
+	// ShardCount is the number of lock shards used by the sharded store.
+	ShardCount int
+
+	// DataDir is the directory holding the WAL and snapshots of the file store.
+	DataDir string
+	// SnapshotEvery is the number of WAL records after which the file store compacts.
+	SnapshotEvery int
+	// SyncWrites makes the file store fsync the WAL after every record.
+	SyncWrites bool
+
+	// DatabasePath is the SQLite database file used by the sqlite store.
+	DatabasePath string
+
+	// RedisAddr, RedisPassword and RedisDB locate the server used by the redis store.
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+}
+
+// New returns the Store selected by cfg.Type. An empty type selects the in-memory store.
+func New(cfg Config) (Store, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "", TypeMemory:
+		return NewStorage(), nil
+	case TypeSharded:
+		return NewShardedStorage(cfg.ShardCount), nil
+	case TypeFile:
+		return NewFileStorage(cfg.DataDir, cfg.SnapshotEvery, cfg.SyncWrites)
+	case TypeSQLite:
+		return NewSQLiteStorage(cfg.DatabasePath)
+	case TypeRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+		return NewRedisStorage(client, DefaultRedisKeyPrefix)
+	default:
+		return nil, fmt.Errorf("unsupported storage type %q", cfg.Type)
+	}
+}
+
+// newURL builds the URL model stored for a freshly shortened link.
+func newURL(url string, shortCode string, expiresAt time.Time) *models.URL {
+	return &models.URL{
+		BaseURL: models.BaseURL{
+			LongURL:     url,
+			AccessCount: 0,
+			CreatedAt:   time.Now(),
+			ExpiresAt:   expiresAt,
+		},
+		ShortCode: shortCode,
+	}
+}
+
+// applyUpdate runs update on a copy of current, keeping the fields owned by the
+// store unchanged.
+func applyUpdate(current *models.URL, update func(*models.URL) error) (*models.URL, error) {
+	updated := *current
+	if err := update(&updated); err != nil {
+		return nil, err
+	}
+	updated.ShortCode = current.ShortCode
+	updated.AccessCount = current.AccessCount
+	updated.BotCount = current.BotCount
+	return &updated, nil
+}
+
+// dedupKey returns the long URL index key of urlModel, which includes its tags.
+func dedupKey(urlModel *models.URL) string {
+	return services.DedupKey(urlModel.LongURL, urlModel.Tags)
+}
+
+// deduplicated reports whether urlModel belongs in the long URL index. Aliases,
+// disabled, click-limited, scheduled, expiring and password-protected links, and
+// links with their own redirect status or passthrough options, are never handed
+// out for duplicate submissions, nor returned for them.
+func deduplicated(urlModel *models.URL) bool {
+	return !urlModel.Alias && !urlModel.Disabled && urlModel.MaxClicks == 0 && urlModel.ActivatesAt.IsZero() &&
+		urlModel.ExpiresAt.IsZero() && urlModel.PasswordHash == "" && urlModel.RedirectCode == 0 &&
+		urlModel.QueryMode == "" && !urlModel.ForwardPath
+}
+
+// clicksLeft reports whether urlModel may be visited once more after accessCount visits.
+func clicksLeft(urlModel *models.URL, accessCount int) bool {
+	return urlModel.MaxClicks == 0 || accessCount < urlModel.MaxClicks
+}
@@ -0,0 +1,523 @@
+package storage
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Codedude1/shorty/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	// Test case: Empty type defaults to the in-memory store
+	store, err := New(Config{})
+	assert.NoError(t, err)
+	assert.IsType(t, &Storage{}, store, "Default storage should be in-memory")
+
+	// Test case: Explicit memory type is case-insensitive
+	store, err = New(Config{Type: "Memory"})
+	assert.NoError(t, err)
+	assert.IsType(t, &Storage{}, store, "Memory storage type should be in-memory")
+
+	// Test case: Sharded type uses the lock-sharded in-memory store
+	store, err = New(Config{Type: TypeSharded, ShardCount: 8})
+	assert.NoError(t, err)
+	assert.IsType(t, &ShardedStorage{}, store, "Sharded storage type should be sharded")
+
+	// Test case: File type opens a durable store in the data directory
+	store, err = New(Config{Type: TypeFile, DataDir: t.TempDir()})
+	assert.NoError(t, err)
+	assert.IsType(t, &FileStorage{}, store, "File storage type should be file-backed")
+
+	// Test case: SQLite type opens and migrates a database file
+	store, err = New(Config{Type: TypeSQLite, DatabasePath: filepath.Join(t.TempDir(), "shorty.db")})
+	assert.NoError(t, err)
+	assert.IsType(t, &SQLStorage{}, store, "SQLite storage type should be SQL-backed")
+
+	// Test case: Unknown types are rejected
+	_, err = New(Config{Type: "carrier-pigeon"})
+	assert.Error(t, err, "Unknown storage type should return an error")
+}
+
+// forEachBackend runs fn against a fresh instance of every Store implementation.
+func forEachBackend(t *testing.T, fn func(t *testing.T, store Store)) {
+	backends := map[string]func(t *testing.T) Store{
+		TypeMemory:  func(t *testing.T) Store { return NewStorage() },
+		TypeSharded: func(t *testing.T) Store { return NewShardedStorage(4) },
+		TypeFile: func(t *testing.T) Store {
+			store, err := NewFileStorage(t.TempDir(), 100, false)
+			require.NoError(t, err)
+			return store
+		},
+		TypeSQLite: func(t *testing.T) Store { return newTestSQLStorage(t) },
+		TypeRedis: func(t *testing.T) Store {
+			store, _ := newTestRedisStorage(t)
+			return store
+		},
+	}
+	for name, newStore := range backends {
+		t.Run(name, func(t *testing.T) {
+			fn(t, newStore(t))
+		})
+	}
+}
+
+// newAlias builds a custom alias model for url.
+func newAlias(url string, alias string) *models.URL {
+	urlModel := newURL(url, alias, time.Time{})
+	urlModel.Alias = true
+	return urlModel
+}
+
+func TestStore_Aliases(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		// Shorten the URL normally first
+		shortCode, created, err := store.CreateURL(newURL("https://www.sale.com", "gen1", time.Time{}))
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, "gen1", shortCode)
+
+		// Test case: An alias for an already shortened URL gets its own code
+		shortCode, created, err = store.CreateURL(newAlias("https://www.sale.com", "spring-sale"))
+		require.NoError(t, err)
+		assert.True(t, created, "Alias should not be deduplicated")
+		assert.Equal(t, "spring-sale", shortCode)
+
+		urlModel, exists := store.GetURL("spring-sale")
+		assert.True(t, exists)
+		assert.True(t, urlModel.Alias, "Alias flag should be stored")
+		assert.Equal(t, "https://www.sale.com", urlModel.LongURL)
+
+		// Test case: Aliases never become the dedup target
+		shortCode, exists = store.GetShortCode("https://www.sale.com", nil)
+		assert.True(t, exists)
+		assert.Equal(t, "gen1", shortCode, "Dedup index should keep the generated code")
+
+		// Test case: Taken aliases are rejected
+		_, _, err = store.CreateURL(newAlias("https://www.other.com", "spring-sale"))
+		assert.ErrorIs(t, err, ErrShortCodeExists)
+
+		// Test case: Deleting the alias leaves the generated code indexed
+		require.NoError(t, store.DeleteURL("spring-sale"))
+		shortCode, exists = store.GetShortCode("https://www.sale.com", nil)
+		assert.True(t, exists)
+		assert.Equal(t, "gen1", shortCode)
+
+		// Test case: An alias for a fresh URL does not claim the dedup index
+		_, _, err = store.CreateURL(newAlias("https://www.fresh.com", "fresh"))
+		require.NoError(t, err)
+		_, exists = store.GetShortCode("https://www.fresh.com", nil)
+		assert.False(t, exists, "Alias should not be indexed by long URL")
+	})
+}
+
+func TestStore_Tags(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		spring := map[string]string{"utm_source": "newsletter", "utm_campaign": "spring"}
+		summer := map[string]string{"utm_source": "newsletter", "utm_campaign": "summer"}
+		_, _, err := store.CreateURL(newURL("https://www.shop.com", "plain1", time.Time{}))
+		require.NoError(t, err)
+
+		// Test case: A tagged link for an already shortened URL gets its own code
+		tagged := newURL("https://www.shop.com", "spring1", time.Time{})
+		tagged.Tags = spring
+		shortCode, created, err := store.CreateURL(tagged)
+		require.NoError(t, err)
+		assert.True(t, created, "Tagged link should not be deduplicated against the untagged one")
+		assert.Equal(t, "spring1", shortCode)
+
+		urlModel, exists := store.GetURL("spring1")
+		assert.True(t, exists)
+		assert.Equal(t, spring, urlModel.Tags, "Tags should be stored")
+
+		// Test case: The same tags are deduplicated
+		again := newURL("https://www.shop.com", "spring2", time.Time{})
+		again.Tags = map[string]string{"utm_campaign": "spring", "utm_source": "newsletter"}
+		shortCode, created, err = store.CreateURL(again)
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, "spring1", shortCode)
+
+		// Test case: Lookups take the tag set into account
+		shortCode, _ = store.GetShortCode("https://www.shop.com", nil)
+		assert.Equal(t, "plain1", shortCode)
+		shortCode, _ = store.GetShortCode("https://www.shop.com", spring)
+		assert.Equal(t, "spring1", shortCode)
+		_, exists = store.GetShortCode("https://www.shop.com", summer)
+		assert.False(t, exists)
+
+		// Test case: The index follows updated tags
+		_, err = store.UpdateURL("spring1", func(u *models.URL) error {
+			u.Tags = summer
+			return nil
+		})
+		require.NoError(t, err)
+		_, exists = store.GetShortCode("https://www.shop.com", spring)
+		assert.False(t, exists, "Old tags should no longer be indexed")
+		shortCode, _ = store.GetShortCode("https://www.shop.com", summer)
+		assert.Equal(t, "spring1", shortCode)
+
+		// Test case: Deleting the tagged link frees its index entry only
+		require.NoError(t, store.DeleteURL("spring1"))
+		_, exists = store.GetShortCode("https://www.shop.com", summer)
+		assert.False(t, exists)
+		shortCode, _ = store.GetShortCode("https://www.shop.com", nil)
+		assert.Equal(t, "plain1", shortCode)
+	})
+}
+
+func TestStore_UpdateURL(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		_, _, err := store.CreateURL(newURL("https://www.old.com", "upd1", time.Time{}))
+		require.NoError(t, err)
+		_, _, err = store.CreateURL(newURL("https://www.taken.com", "upd2", time.Time{}))
+		require.NoError(t, err)
+		require.NoError(t, store.IncrementAccessCount("upd1"))
+
+		// Test case: Retargeting moves the long URL index entry
+		urlModel, err := store.UpdateURL("upd1", func(u *models.URL) error {
+			u.LongURL = "https://www.new.com"
+			u.AccessCount = 100 // Owned by the store; must be ignored
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "https://www.new.com", urlModel.LongURL)
+		assert.Equal(t, 1, urlModel.AccessCount, "Access count should survive the update")
+		_, exists := store.GetShortCode("https://www.old.com", nil)
+		assert.False(t, exists, "Old destination should no longer be indexed")
+		shortCode, exists := store.GetShortCode("https://www.new.com", nil)
+		assert.True(t, exists)
+		assert.Equal(t, "upd1", shortCode)
+
+		// Test case: Retargeting onto an indexed URL keeps the existing index entry
+		_, err = store.UpdateURL("upd1", func(u *models.URL) error {
+			u.LongURL = "https://www.taken.com"
+			return nil
+		})
+		require.NoError(t, err)
+		shortCode, _ = store.GetShortCode("https://www.taken.com", nil)
+		assert.Equal(t, "upd2", shortCode, "Index should keep pointing at the original link")
+		_, exists = store.GetShortCode("https://www.new.com", nil)
+		assert.False(t, exists)
+
+		// Test case: Setting and clearing the expiry
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		urlModel, err = store.UpdateURL("upd2", func(u *models.URL) error {
+			u.ExpiresAt = expiresAt
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, expiresAt.Equal(urlModel.ExpiresAt))
+		_, err = store.UpdateURL("upd2", func(u *models.URL) error {
+			u.ExpiresAt = time.Time{}
+			return nil
+		})
+		require.NoError(t, err)
+		urlModel, _ = store.GetURL("upd2")
+		assert.True(t, urlModel.ExpiresAt.IsZero(), "Expiry should be cleared")
+
+		// Test case: Disabled links leave the index until re-enabled
+		_, err = store.UpdateURL("upd2", func(u *models.URL) error {
+			u.Disabled = true
+			return nil
+		})
+		require.NoError(t, err)
+		urlModel, _ = store.GetURL("upd2")
+		assert.True(t, urlModel.Disabled)
+		_, exists = store.GetShortCode("https://www.taken.com", nil)
+		assert.False(t, exists, "Disabled links should not be handed out for duplicates")
+		_, err = store.UpdateURL("upd2", func(u *models.URL) error {
+			u.Disabled = false
+			return nil
+		})
+		require.NoError(t, err)
+		shortCode, exists = store.GetShortCode("https://www.taken.com", nil)
+		assert.True(t, exists)
+		assert.Equal(t, "upd2", shortCode)
+
+		// Test case: Flagged links are stored and stay in the index
+		_, err = store.UpdateURL("upd2", func(u *models.URL) error {
+			u.Flagged = true
+			return nil
+		})
+		require.NoError(t, err)
+		urlModel, _ = store.GetURL("upd2")
+		assert.True(t, urlModel.Flagged)
+		shortCode, _ = store.GetShortCode("https://www.taken.com", nil)
+		assert.Equal(t, "upd2", shortCode)
+
+		// Test case: Redirect codes are stored with the link
+		_, err = store.UpdateURL("upd2", func(u *models.URL) error {
+			u.RedirectCode = 308
+			return nil
+		})
+		require.NoError(t, err)
+		urlModel, _ = store.GetURL("upd2")
+		assert.Equal(t, 308, urlModel.RedirectCode)
+
+		// Test case: Passthrough options are stored with the link
+		_, err = store.UpdateURL("upd2", func(u *models.URL) error {
+			u.QueryMode = "override"
+			u.ForwardPath = true
+			return nil
+		})
+		require.NoError(t, err)
+		urlModel, _ = store.GetURL("upd2")
+		assert.Equal(t, "override", urlModel.QueryMode)
+		assert.True(t, urlModel.ForwardPath)
+
+		// Test case: Errors from the update abort the change
+		errAbort := assert.AnError
+		_, err = store.UpdateURL("upd2", func(u *models.URL) error {
+			u.LongURL = "https://www.aborted.com"
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+		urlModel, _ = store.GetURL("upd2")
+		assert.Equal(t, "https://www.taken.com", urlModel.LongURL)
+
+		// Test case: Missing short codes
+		_, err = store.UpdateURL("nonexist", func(*models.URL) error { return nil })
+		assert.ErrorIs(t, err, ErrURLNotFound)
+	})
+}
+
+func TestStore_UpdateURLExpiry(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		_, _, err := store.CreateURL(newURL("https://www.extend.com", "ext1", time.Now().Add(50*time.Millisecond)))
+		require.NoError(t, err)
+
+		// Extending the expiry must keep the link past its old deadline
+		_, err = store.UpdateURL("ext1", func(u *models.URL) error {
+			u.ExpiresAt = time.Now().Add(time.Hour)
+			return nil
+		})
+		require.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, store.CleanupExpiredURLs())
+		_, exists := store.GetURL("ext1")
+		assert.True(t, exists, "Extended link should survive the sweep")
+	})
+}
+
+func TestStore_Scheduled(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		activatesAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		scheduled := newURL("https://www.launch.com", "launch1", time.Time{})
+		scheduled.ActivatesAt = activatesAt
+		_, created, err := store.CreateURL(scheduled)
+		require.NoError(t, err)
+		assert.True(t, created)
+
+		// Test case: The activation time is stored
+		urlModel, exists := store.GetURL("launch1")
+		require.True(t, exists)
+		assert.True(t, activatesAt.Equal(urlModel.ActivatesAt), "Activation time should be stored")
+
+		// Test case: Scheduled links are not handed out for duplicate submissions
+		_, exists = store.GetShortCode("https://www.launch.com", nil)
+		assert.False(t, exists, "Scheduled link should not be indexed")
+		shortCode, created, err := store.CreateURL(newURL("https://www.launch.com", "open1", time.Time{}))
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, "open1", shortCode)
+
+		// Test case: Clearing the activation time keeps the link
+		urlModel, err = store.UpdateURL("launch1", func(u *models.URL) error {
+			u.ActivatesAt = time.Time{}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, urlModel.ActivatesAt.IsZero())
+		urlModel, _ = store.GetURL("launch1")
+		assert.True(t, urlModel.ActivatesAt.IsZero(), "Cleared activation time should be stored")
+	})
+}
+
+func TestStore_Password(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		protected := newURL("https://www.docs.com", "docs1", time.Time{})
+		protected.PasswordHash = "$2a$10$hash"
+		_, _, err := store.CreateURL(protected)
+		require.NoError(t, err)
+
+		// Test case: The password hash is stored
+		urlModel, exists := store.GetURL("docs1")
+		require.True(t, exists)
+		assert.Equal(t, "$2a$10$hash", urlModel.PasswordHash)
+
+		// Test case: Protected links are not handed out for duplicate submissions
+		_, exists = store.GetShortCode("https://www.docs.com", nil)
+		assert.False(t, exists, "Protected link should not be indexed")
+
+		// Test case: Removing the password keeps the link
+		_, err = store.UpdateURL("docs1", func(u *models.URL) error {
+			u.PasswordHash = ""
+			return nil
+		})
+		require.NoError(t, err)
+		urlModel, _ = store.GetURL("docs1")
+		assert.Empty(t, urlModel.PasswordHash, "Removed password should be stored")
+	})
+}
+
+func TestStore_RedirectCode(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		permanent := newURL("https://www.moved.com", "moved1", time.Time{})
+		permanent.RedirectCode = 301
+		_, created, err := store.CreateURL(permanent)
+		require.NoError(t, err)
+		assert.True(t, created)
+
+		// Test case: Links with their own redirect status are not handed out for duplicate submissions
+		_, exists := store.GetShortCode("https://www.moved.com", nil)
+		assert.False(t, exists, "Link with a redirect status should not be indexed")
+
+		// Test case: A plain link for the same URL is stored apart
+		shortCode, created, err := store.CreateURL(newURL("https://www.moved.com", "moved2", time.Time{}))
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, "moved2", shortCode)
+
+		// Test case: Reverting to the server default indexes the link, unless another link holds the URL
+		_, err = store.UpdateURL("moved1", func(u *models.URL) error {
+			u.RedirectCode = 0
+			return nil
+		})
+		require.NoError(t, err)
+		shortCode, exists = store.GetShortCode("https://www.moved.com", nil)
+		assert.True(t, exists)
+		assert.Equal(t, "moved2", shortCode)
+	})
+}
+
+func TestStore_OptionsNotDeduplicated(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		passthrough := newURL("https://www.guide.com", "guide1", time.Time{})
+		passthrough.QueryMode = "merge"
+		passthrough.ForwardPath = true
+		_, _, err := store.CreateURL(passthrough)
+		require.NoError(t, err)
+		require.NoError(t, store.AddURL("https://www.guide.com", "guide2", time.Now().Add(time.Hour)))
+
+		// Test case: Links with passthrough options or an expiry are not handed out for duplicate submissions
+		_, exists := store.GetShortCode("https://www.guide.com", nil)
+		assert.False(t, exists, "Links with options should not be indexed")
+
+		// Test case: Clearing the options indexes the link
+		_, err = store.UpdateURL("guide1", func(u *models.URL) error {
+			u.QueryMode = ""
+			u.ForwardPath = false
+			return nil
+		})
+		require.NoError(t, err)
+		shortCode, exists := store.GetShortCode("https://www.guide.com", nil)
+		assert.True(t, exists)
+		assert.Equal(t, "guide1", shortCode)
+	})
+}
+
+func TestStore_ClickLimit(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		limited := newURL("https://www.secret.com", "once1", time.Time{})
+		limited.MaxClicks = 2
+		_, _, err := store.CreateURL(limited)
+		require.NoError(t, err)
+
+		// Test case: Clicks are counted up to the limit
+		require.NoError(t, store.IncrementAccessCount("once1"))
+		require.NoError(t, store.IncrementAccessCount("once1"))
+		assert.ErrorIs(t, store.IncrementAccessCount("once1"), ErrClickLimitReached)
+		urlModel, exists := store.GetURL("once1")
+		require.True(t, exists)
+		assert.Equal(t, 2, urlModel.AccessCount, "Refused clicks should not be counted")
+
+		// Test case: Click-limited links are not deduplicated
+		_, exists = store.GetShortCode("https://www.secret.com", nil)
+		assert.False(t, exists, "Click-limited link should not be indexed by long URL")
+		shortCode, created, err := store.CreateURL(newURL("https://www.secret.com", "open1", time.Time{}))
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, "open1", shortCode)
+
+		// Test case: Raising the limit allows further clicks
+		_, err = store.UpdateURL("once1", func(u *models.URL) error {
+			u.MaxClicks = 3
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, store.IncrementAccessCount("once1"))
+		assert.ErrorIs(t, store.IncrementAccessCount("once1"), ErrClickLimitReached)
+
+		// Test case: Concurrent redirects cannot exceed the limit
+		racy := newURL("https://www.race.com", "race1", time.Time{})
+		racy.MaxClicks = 5
+		_, _, err = store.CreateURL(racy)
+		require.NoError(t, err)
+		var allowed atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 40; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if store.IncrementAccessCount("race1") == nil {
+					allowed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(5), allowed.Load())
+		urlModel, _ = store.GetURL("race1")
+		assert.Equal(t, 5, urlModel.AccessCount)
+
+		// Test case: Missing short codes are ignored
+		assert.NoError(t, store.IncrementAccessCount("nonexist"))
+	})
+}
+
+func TestStore_BotCount(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		require.NoError(t, store.AddURL("https://www.example.com", "bots1", time.Time{}))
+		require.NoError(t, store.IncrementAccessCount("bots1"))
+		require.NoError(t, store.IncrementBotCount("bots1"))
+		require.NoError(t, store.IncrementBotCount("bots1"))
+
+		// Test case: Bots are counted apart from the access count
+		urlModel, exists := store.GetURL("bots1")
+		require.True(t, exists)
+		assert.Equal(t, 1, urlModel.AccessCount)
+		assert.Equal(t, 2, urlModel.BotCount)
+
+		// Test case: Updates cannot change the bot count
+		urlModel, err := store.UpdateURL("bots1", func(u *models.URL) error {
+			u.BotCount = 100 // Owned by the store; must be ignored
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, urlModel.BotCount)
+
+		// Test case: Bot clicks stay out of the rollups
+		hour := time.Now().UTC().Truncate(time.Hour)
+		events := clicksAt("bots1", hour, hour)
+		events[1].Bot = true
+		require.NoError(t, store.CountClicks(events))
+		series, err := store.ClickSeries("bots1", GranularityHour, hour, hour.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1}, seriesCounts(series))
+
+		// Test case: Missing short codes are ignored
+		assert.NoError(t, store.IncrementBotCount("nonexist"))
+		_, exists = store.GetURL("nonexist")
+		assert.False(t, exists)
+
+		// Test case: Re-adding a deleted link starts from zero
+		require.NoError(t, store.DeleteURL("bots1"))
+		require.NoError(t, store.AddURL("https://www.example.com", "bots1", time.Time{}))
+		urlModel, _ = store.GetURL("bots1")
+		assert.Equal(t, 0, urlModel.BotCount)
+	})
+}